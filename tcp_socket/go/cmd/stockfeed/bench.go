@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"ifin/internal/cli"
+	"ifin/internal/latency"
+	"ifin/internal/secrets"
+	"ifin/pkg/feedclient"
+)
+
+// bench connects -connections clients to a feed server, each subscribed to
+// the same symbols, for -duration or until SIGINT or SIGTERM, then reports
+// how many updates they received and how late, from the time the server
+// generated them. The auth token is read as by consume.
+func bench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	servers := fs.String("servers", "localhost:9501", "Comma-separated feed server addresses, primary first")
+	network := fs.String("network", "tcp", "Network of the feed servers: tcp, or unix for socket paths in -servers")
+	connections := fs.Int("connections", 10, "Clients connected at once")
+	symbols := fs.String("symbols", "", "Comma-separated symbols each client subscribes to (empty for all)")
+	format := fs.String("format", "json", "Format the server is asked to send updates in")
+	duration := fs.Duration("duration", 10*time.Second, "How long to receive updates")
+	if err := cli.Parse(fs, "BENCH_", args); err != nil {
+		log.Fatalf("Error in configuration: %v", err)
+	}
+
+	token, err := secrets.FromEnv("FEED_AUTH_TOKEN")
+	if err != nil {
+		log.Fatalf("Error loading feed token: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+
+	// Latency from the server's timestamp to the update being decoded here
+	lag := latency.New()
+	handle := func(ctx context.Context, update feedclient.Update) error {
+		if update.Timestamp > 0 {
+			lag.Observe(time.Since(time.UnixMilli(update.Timestamp)))
+		}
+		return nil
+	}
+
+	var clients []*feedclient.Client
+	for range *connections {
+		c, err := feedclient.New(feedclient.Options{
+			Servers: strings.Split(*servers, ","),
+			Network: *network,
+			Token:   token.Value,
+			Symbols: splitSymbols(*symbols),
+			Format:  *format,
+			Logf:    log.Printf,
+		})
+		if err != nil {
+			log.Fatalf("Error in server configuration: %v", err)
+		}
+		clients = append(clients, c)
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Run(ctx, handle)
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	var total feedclient.Stats
+	connected := 0
+	for _, c := range clients {
+		s := c.Stats()
+		total.Messages += s.Messages
+		total.Bytes += s.Bytes
+		total.DecodeErrors += s.DecodeErrors
+		if s.Connects > 0 {
+			connected++
+		}
+	}
+	l := lag.Snapshot()
+	fmt.Printf("%d/%d clients connected over %v\n", connected, len(clients), elapsed.Round(time.Millisecond))
+	fmt.Printf("%d updates (%.1f/s), %d bytes (%.0f B/s), %d decode errors\n",
+		total.Messages, float64(total.Messages)/elapsed.Seconds(), total.Bytes, float64(total.Bytes)/elapsed.Seconds(), total.DecodeErrors)
+	fmt.Printf("latency avg %.2fms max %.2fms\n", l.AvgMs, l.MaxMs)
+	for _, le := range latency.Buckets {
+		fmt.Printf("  <= %-8v %d\n", le, l.Buckets[le.String()])
+	}
+	fmt.Printf("  <= %-8s %d\n", "+Inf", l.Buckets["+Inf"])
+}
+
+// splitSymbols splits a comma-separated symbol list, dropping empty items.
+func splitSymbols(list string) []string {
+	var symbols []string
+	for _, symbol := range strings.Split(list, ",") {
+		if symbol = strings.TrimSpace(symbol); symbol != "" {
+			symbols = append(symbols, symbol)
+		}
+	}
+	return symbols
+}
@@ -0,0 +1,94 @@
+// Command stockfeed is the stock feed in one binary: the server
+// broadcasting prices, the client consuming them into a store it serves
+// over HTTP, and the tools around them.
+//
+//	stockfeed serve [flags]                    run the feed server
+//	stockfeed consume [flags]                  run the feed client
+//	stockfeed bench [flags]                    measure a server's throughput and latency
+//	stockfeed replay [flags] FILE              serve the prices recorded in a CSV file
+//	stockfeed healthcheck serve|consume [flags] probe a running server or client
+//
+// serve and consume read every flag from the environment too, prefixed
+// with SERVER_ and CLIENT_ respectively.
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"ifin/internal/consume"
+	"ifin/internal/serve"
+)
+
+// command is a subcommand, run with the arguments after its name.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string)
+}
+
+var commands = []command{
+	{"serve", "Run the feed server", serve.Main},
+	{"consume", "Run the feed client, storing the prices and serving them over HTTP", consume.Main},
+	{"bench", "Connect many clients to a feed server and report throughput and latency", bench},
+	{"replay", "Serve the prices recorded in a CSV file: serve -source csv -source-file FILE", replay},
+	{"healthcheck", "Probe the server or client the same flags configure, exiting 0 when healthy", healthcheck},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	name, args := os.Args[1], os.Args[2:]
+	for _, c := range commands {
+		if c.name == name {
+			c.run(args)
+			return
+		}
+	}
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		usage()
+		return
+	}
+	fmt.Fprintf(os.Stderr, "stockfeed: unknown command %q\n", name)
+	usage()
+	os.Exit(2)
+}
+
+// usage lists the commands.
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: stockfeed <command> [flags]\n\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun stockfeed <command> -h for the flags of a command.")
+}
+
+// replay serves the CSV file given after the flags, which are those of
+// serve.
+func replay(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[len(args)-1], "-") {
+		fmt.Fprintln(os.Stderr, "Usage: stockfeed replay [serve flags] FILE")
+		os.Exit(2)
+	}
+	flags, file := args[:len(args)-1], args[len(args)-1]
+	serve.Main(append([]string{"-source", "csv", "-source-file", file}, flags...))
+}
+
+// healthcheck probes the server or client named by its first argument.
+func healthcheck(args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "serve":
+			serve.Healthcheck(args[1:])
+			return
+		case "consume":
+			consume.Healthcheck(args[1:])
+			return
+		}
+	}
+	fmt.Fprintln(os.Stderr, "Usage: stockfeed healthcheck serve|consume [flags]")
+	os.Exit(2)
+}
@@ -0,0 +1,43 @@
+// Package audit records connection lifecycle events (connects, disconnects,
+// authentication outcomes) to a structured sink for later review.
+package audit
+
+import (
+	"context"
+	"time"
+)
+
+// Event kinds.
+const (
+	Connect    = "connect"
+	AuthOK     = "auth_ok"
+	AuthFailed = "auth_failed"
+	Disconnect = "disconnect"
+	Rejected   = "rejected" // Refused before the handshake, e.g. by flood protection
+)
+
+// Event is one audit record.
+type Event struct {
+	Time       time.Time `json:"time"`
+	Kind       string    `json:"kind"`
+	RemoteAddr string    `json:"remote_addr"`
+	Identity   string    `json:"identity,omitempty"`
+	DurationMs int64     `json:"duration_ms,omitempty"` // Connection lifetime, set on disconnect
+	BytesIn    int64     `json:"bytes_in,omitempty"`
+	BytesOut   int64     `json:"bytes_out,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+}
+
+// Sink stores audit events. Record gives up when ctx is done.
+type Sink interface {
+	Record(ctx context.Context, e Event) error
+	Close() error
+}
+
+// Discard is a Sink that drops every event.
+var Discard Sink = discard{}
+
+type discard struct{}
+
+func (discard) Record(context.Context, Event) error { return nil }
+func (discard) Close() error                        { return nil }
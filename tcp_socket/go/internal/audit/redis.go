@@ -0,0 +1,49 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const redisTimeout = 2 * time.Second // Upper bound for a single XADD
+
+// RedisSink appends events to a Redis stream capped at roughly maxLen entries.
+type RedisSink struct {
+	rdb    *redis.Client
+	stream string
+	maxLen int64
+}
+
+// NewRedisSink writes to stream on rdb.
+func NewRedisSink(rdb *redis.Client, stream string, maxLen int64) *RedisSink {
+	return &RedisSink{rdb: rdb, stream: stream, maxLen: maxLen}
+}
+
+// Record adds the event as a stream entry.
+func (s *RedisSink) Record(ctx context.Context, e Event) error {
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+
+	return s.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.stream,
+		MaxLen: s.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"time":        e.Time.Format(time.RFC3339Nano),
+			"kind":        e.Kind,
+			"remote_addr": e.RemoteAddr,
+			"identity":    e.Identity,
+			"duration_ms": e.DurationMs,
+			"bytes_in":    e.BytesIn,
+			"bytes_out":   e.BytesOut,
+			"reason":      e.Reason,
+		},
+	}).Err()
+}
+
+// Close closes the Redis client.
+func (s *RedisSink) Close() error {
+	return s.rdb.Close()
+}
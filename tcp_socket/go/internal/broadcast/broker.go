@@ -0,0 +1,75 @@
+package broadcast
+
+import (
+	"context"
+	"time"
+
+	"ifin/internal/feed"
+)
+
+// Broker carries updates from the price generator to the transports
+// delivering them. The generator only publishes; how and to whom updates
+// are sent is the broker's business, so a WebSocket, NATS or Kafka broker
+// can replace or sit beside the Hub without the generator changing.
+type Broker interface {
+	// Publish delivers update to every subscriber wanting its symbol and
+	// returns it as delivered, numbered and carrying the trace context of
+	// ctx. generated is when the update was made, for latency metrics.
+	Publish(ctx context.Context, update feed.Update, generated time.Time) feed.Update
+
+	// Subscribe returns the updates of symbols, or of every symbol when
+	// none are given, published from now on. The channel is closed when ctx
+	// is done. A subscriber too slow to keep up misses updates rather than
+	// holding up the others.
+	Subscribe(ctx context.Context, symbols ...string) <-chan feed.Update
+}
+
+// subscriberBuffer is how many updates an in-process subscriber may fall
+// behind before it misses some
+const subscriberBuffer = 64
+
+// subscriber is an in-process subscriber of the hub, see Hub.Subscribe.
+type subscriber struct {
+	sub     Subscription
+	updates chan feed.Update
+}
+
+// Subscribe implements Broker for consumers in the same process, alongside
+// the TCP clients.
+func (h *Hub) Subscribe(ctx context.Context, symbols ...string) <-chan feed.Update {
+	s := &subscriber{updates: make(chan feed.Update, subscriberBuffer)}
+	if len(symbols) > 0 {
+		s.sub.subscribe(symbols)
+	}
+
+	h.mu.Lock()
+	h.subscribers[s] = struct{}{}
+	h.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		h.mu.Lock()
+		delete(h.subscribers, s)
+		h.mu.Unlock()
+		close(s.updates)
+	}()
+	return s.updates
+}
+
+// notify hands update to the in-process subscribers wanting it, skipping
+// those whose buffer is full. The hub must be locked.
+func (h *Hub) notify(update feed.Update) {
+	for s := range h.subscribers {
+		if !s.sub.wants(update.Symbol) {
+			continue
+		}
+		select {
+		case s.updates <- update:
+		default:
+			h.broadcasterLog.Warnf("In-process subscriber behind, dropping tick %s", update.ID)
+		}
+	}
+}
+
+// The hub is the TCP implementation
+var _ Broker = (*Hub)(nil)
@@ -0,0 +1,235 @@
+// Package broadcast is the delivery side of the feed server: the registry of
+// connected clients and the symbols they subscribed to, the journal of
+// recent updates clients can replay, the commands clients send, and the
+// fan-out of every update to the clients that want it.
+package broadcast
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"ifin/internal/clock"
+	"ifin/internal/feed"
+	"ifin/internal/hooks"
+	"ifin/internal/latency"
+	"ifin/internal/logging"
+	"ifin/internal/tracing"
+	"ifin/pkg/codec"
+)
+
+// Loggers of the hub unless NewHub is given one, whose levels are set by
+// -log-level and overridden by -log-components
+var (
+	broadcasterLog = logging.New("broadcaster", log.Printf) // A line per update sent
+	commandLog     = logging.New("commands", log.Printf)    // SUBSCRIBE and other client commands
+	journalLog     = logging.New("journal", log.Printf)     // Replays of missed updates
+)
+
+// tracer records the broadcast span of every traced tick
+var tracer = tracing.Tracer("feed-server")
+
+// Hub is the TCP Broker: the set of connected clients. It numbers every
+// update published in its journal and writes it to each client subscribed
+// to its symbol, and to the in-process subscribers.
+type Hub struct {
+	journal *journal
+	clock   clock.Clock // Measures the fan-out and write latencies
+
+	broadcasterLog *logging.Logger
+	commandLog     *logging.Logger
+	journalLog     *logging.Logger
+
+	// mu guards clients, subscribers and their subscriptions, and is held
+	// while queueing writes for them so replays and live updates are never
+	// interleaved
+	mu          sync.Mutex
+	clients     map[net.Conn]*client
+	subscribers map[*subscriber]struct{}
+
+	broadcasts atomic.Uint64 // Updates published
+	sent       atomic.Uint64 // Updates written to clients
+	sendErrors atomic.Uint64 // Clients dropped on a failed write or for falling behind
+
+	Fanout      *latency.Histogram // Time from generating an update to queueing it for the last subscribed client
+	ClientWrite *latency.Histogram // Time from queueing an update for a client to having written it
+
+	// BeforeBroadcast runs on every update published, before it is numbered,
+	// and may change or drop it. Set it before publishing.
+	BeforeBroadcast hooks.Chain[feed.Update]
+}
+
+// NewHub returns a hub keeping journalSize updates per symbol for replays
+// and timing its writes with clk. It logs to logger, or the standard logger
+// when nil.
+func NewHub(journalSize int, clk clock.Clock, logger *slog.Logger) *Hub {
+	return &Hub{
+		journal:        newJournal(journalSize),
+		clock:          clk,
+		broadcasterLog: broadcasterLog.To(logger),
+		commandLog:     commandLog.To(logger),
+		journalLog:     journalLog.To(logger),
+		clients:        make(map[net.Conn]*client),
+		subscribers:    make(map[*subscriber]struct{}),
+		Fanout:         latency.New(),
+		ClientWrite:    latency.New(),
+	}
+}
+
+// Join registers an authenticated client, subscribed to every symbol until
+// it sends SUBSCRIBE, and starts its writer: from now on everything written
+// to conn must go through the hub. Call Leave when its connection ends.
+func (h *Hub) Join(conn net.Conn) *Subscription {
+	c := &client{sub: &Subscription{}, queue: make(chan write, sendQueue), done: make(chan struct{})}
+	h.mu.Lock()
+	h.clients[conn] = c
+	h.mu.Unlock()
+	go h.writeLoop(conn, c)
+	return c.sub
+}
+
+// Leave unregisters a client, unless it was dropped already, and waits for
+// its writer to write out what is queued.
+func (h *Hub) Leave(conn net.Conn) {
+	h.mu.Lock()
+	c, ok := h.clients[conn]
+	if ok {
+		delete(h.clients, conn)
+		close(c.queue)
+	}
+	h.mu.Unlock()
+	if ok {
+		<-c.done
+	}
+}
+
+// Clients returns the number of registered clients.
+func (h *Hub) Clients() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients)
+}
+
+// Counters are the hub's totals since it was created.
+type Counters struct {
+	Broadcasts uint64 // Updates published
+	Sent       uint64 // Updates written to clients
+	SendErrors uint64 // Clients dropped on a failed write or for falling behind
+}
+
+func (h *Hub) Counters() Counters {
+	return Counters{Broadcasts: h.broadcasts.Load(), Sent: h.sent.Load(), SendErrors: h.sendErrors.Load()}
+}
+
+// Each calls fn with every registered client and the symbols it subscribed
+// to, sorted, or nil for every symbol. The hub is locked meanwhile.
+func (h *Hub) Each(fn func(conn net.Conn, symbols []string)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for conn, c := range h.clients {
+		fn(conn, c.sub.Symbols())
+	}
+}
+
+// Close closes the connection of every client.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for conn := range h.clients {
+		conn.Close()
+	}
+}
+
+// Publish numbers update, keeps it in the journal and sends it to every
+// client subscribed to its symbol, in the format each asked for (JSON, one
+// message per line, by default), recording the fan-out latency from
+// generated. The update carries the trace context of ctx to the clients. It
+// returns the update as sent, with no Seq when BeforeBroadcast dropped it.
+func (h *Hub) Publish(ctx context.Context, update feed.Update, generated time.Time) feed.Update {
+	if err := h.BeforeBroadcast.Run(ctx, &update); err != nil {
+		if err != hooks.Skip {
+			h.broadcasterLog.Warnf("Tick %s dropped by a hook: %v", update.ID, err)
+		}
+		return update
+	}
+
+	// Numbered, journaled and queued under one lock, so a replay either
+	// includes the update or comes before it on the connection, never both
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	update.Seq = h.journal.nextSeq(update.Symbol)
+	update.TraceParent = tracing.TraceParent(ctx)
+
+	message := "{}" // An empty JSON object if the update cannot be encoded
+	if data, err := json.Marshal(update); err != nil {
+		h.broadcasterLog.Errorf("Error marshaling tick %s: %v", update.ID, err)
+	} else {
+		message = string(data)
+	}
+
+	entry := journalEntry{update: update, message: message}
+	h.journal.add(update, message)
+	h.broadcast(ctx, entry, generated)
+	return update
+}
+
+// encode returns the update of entry in format.
+func encode(entry journalEntry, format codec.Codec) ([]byte, error) {
+	if format == codec.JSON {
+		return []byte(entry.message), nil
+	}
+	return format.Marshal(entry.update)
+}
+
+// broadcast queues the update of entry for the subscribed clients, encoding
+// it once per format, and drops those too far behind to take it, then hands
+// it to the in-process subscribers. Their writers write it. The hub must be
+// locked.
+func (h *Hub) broadcast(ctx context.Context, entry journalEntry, generated time.Time) {
+	update := entry.update
+	_, span := tracer.Start(ctx, "broadcast")
+	defer span.End()
+
+	h.broadcasts.Add(1)
+	frames := make(map[codec.Codec][]byte) // Format -> the update framed in it
+	queued, dropped := 0, 0
+	defer func() {
+		span.SetAttributes(attribute.Int("clients.queued", queued), attribute.Int("clients.dropped", dropped))
+	}()
+	now := h.clock.Now()
+	for conn, c := range h.clients {
+		sub := c.sub
+		if !sub.wants(update.Symbol) {
+			continue
+		}
+		frame, ok := frames[sub.Format()]
+		if !ok {
+			if data, err := encode(entry, sub.Format()); err != nil {
+				h.broadcasterLog.Errorf("Error encoding tick %s as %s: %v", update.ID, sub.Format().Name(), err)
+			} else {
+				frame = codec.AppendFrame(nil, sub.Format(), data)
+			}
+			frames[sub.Format()] = frame
+		}
+		if frame == nil {
+			continue // Clients of this format miss the update
+		}
+		if h.enqueue(conn, write{data: frame, entry: &entry, queued: now}) {
+			queued++
+		} else {
+			dropped++
+		}
+	}
+	if queued+dropped > 0 {
+		h.Fanout.Observe(h.clock.Now().Sub(generated))
+	}
+	h.notify(update)
+}
@@ -0,0 +1,78 @@
+package broadcast
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"ifin/internal/clock"
+	"ifin/internal/feed"
+)
+
+func TestSlowClientIsDroppedWithoutHoldingUpOthers(t *testing.T) {
+	h := NewHub(10, clock.Real, nil)
+	defer h.Close()
+
+	// A client that never reads, over an unbuffered pipe, and one that does
+	slow, slowServer := net.Pipe()
+	defer slow.Close()
+	h.Join(slowServer)
+	fast, fastServer := tcpPair(t)
+	h.Join(fastServer)
+
+	// Each update is published once the reading client has the previous
+	// one, so only the other falls behind
+	updates := sendQueue + 10
+	received := make(chan struct{})
+	go func() {
+		scanner := bufio.NewScanner(fast)
+		for scanner.Scan() {
+			received <- struct{}{}
+		}
+	}()
+	for i := range updates {
+		h.Publish(context.Background(), feed.Update{ID: fmt.Sprint(i), Symbol: "AAPL", Price: 190}, time.Now())
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("the reading client did not receive update %d", i)
+		}
+	}
+
+	if clients := h.Clients(); clients != 1 {
+		t.Errorf("%d clients registered, want only the reading one", clients)
+	}
+	if errors := h.Counters().SendErrors; errors != 1 {
+		t.Errorf("%d clients dropped, want 1", errors)
+	}
+	if _, err := slow.Read(make([]byte, 1)); err == nil {
+		t.Error("the connection of the dropped client is still open")
+	}
+}
+
+// tcpPair returns both ends of a loopback TCP connection, closed when the
+// test is done.
+func tcpPair(t *testing.T) (client, server net.Conn) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	client, err = net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err = listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
@@ -0,0 +1,135 @@
+package broadcast
+
+import (
+	"cmp"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+
+	"ifin/internal/feed"
+	"ifin/pkg/codec"
+)
+
+// journal numbers the updates of each symbol and keeps the most recent ones,
+// so clients that missed some (e.g. while reconnecting) can ask for a replay.
+type journal struct {
+	size int // Entries kept per symbol
+
+	mu      sync.Mutex
+	seq     map[string]uint64         // Symbol -> last sequence number issued
+	entries map[string][]journalEntry // Symbol -> recent updates, oldest first
+}
+
+type journalEntry struct {
+	update  feed.Update
+	message string // The update as JSON
+}
+
+func newJournal(size int) *journal {
+	return &journal{size: size, seq: make(map[string]uint64), entries: make(map[string][]journalEntry)}
+}
+
+// nextSeq issues the sequence number for the next update of symbol.
+func (j *journal) nextSeq(symbol string) uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.seq[symbol]++
+	return j.seq[symbol]
+}
+
+// add keeps update and its JSON, dropping the oldest entry of its symbol
+// once there are size.
+func (j *journal) add(update feed.Update, message string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entries := append(j.entries[update.Symbol], journalEntry{update: update, message: message})
+	if len(entries) > j.size {
+		entries = entries[len(entries)-j.size:]
+	}
+	j.entries[update.Symbol] = entries
+}
+
+// since returns the kept updates of symbol numbered from or later.
+func (j *journal) since(symbol string, from uint64) []journalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var entries []journalEntry
+	for _, entry := range j.entries[symbol] {
+		if entry.update.Seq >= from {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// replay answers "REPLAY <symbol> <from>" on conn, in the format of sub.
+// The kept updates are queued between
+// "REPLAYING <symbol> <from>" and "REPLAYED <symbol> <last>" markers while
+// the hub is locked, so no live update of any symbol is interleaved and
+// every live update sent afterwards is newer than the replay. Updates older
+// than the journal cannot be replayed; the client sees that from the first
+// sequence number it receives.
+func (h *Hub) replay(conn net.Conn, sub *Subscription, args []string) string {
+	symbols := parseSymbols(args[:min(len(args), 1)])
+	if len(args) != 2 || len(symbols) != 1 {
+		return "ERR usage: REPLAY <symbol> <from-seq>\n"
+	}
+	symbol := symbols[0]
+	from, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return "ERR invalid sequence number\n"
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := h.journal.since(symbol, from)
+	buf := fmt.Appendf(nil, "REPLAYING %s %d\n", symbol, from)
+	var last uint64
+	for _, entry := range entries {
+		data, err := encode(entry, sub.Format())
+		if err != nil {
+			h.journalLog.Errorf("Error encoding tick %s for %s: %v", entry.update.ID, conn.RemoteAddr(), err)
+			continue
+		}
+		buf = codec.AppendFrame(buf, sub.Format(), data)
+		last = entry.update.Seq
+	}
+	buf = fmt.Appendf(buf, "REPLAYED %s %d\n", symbol, last)
+
+	if !h.enqueue(conn, write{data: buf}) {
+		h.journalLog.Errorf("Error replaying to %s: the client was dropped", conn.RemoteAddr())
+	} else {
+		h.journalLog.Infof("Replayed %d %s updates from %d to %s", len(entries), symbol, from, conn.RemoteAddr())
+	}
+	return ""
+}
+
+// JournalState is one symbol of the journal.
+type JournalState struct {
+	Symbol  string   `json:"symbol"`
+	LastSeq uint64   `json:"last_seq"`
+	Kept    int      `json:"kept"`   // Updates kept for replay
+	Recent  []uint64 `json:"recent"` // Latest sequence numbers, oldest first
+}
+
+// Journal returns the state of every symbol, sorted, with its recent latest
+// sequence numbers.
+func (h *Hub) Journal(recent int) []JournalState {
+	j := h.journal
+	j.mu.Lock()
+	states := make([]JournalState, 0, len(j.seq))
+	for symbol, seq := range j.seq {
+		entries := j.entries[symbol]
+		s := JournalState{Symbol: symbol, LastSeq: seq, Kept: len(entries)}
+		for _, entry := range entries[max(len(entries)-recent, 0):] {
+			s.Recent = append(s.Recent, entry.update.Seq)
+		}
+		states = append(states, s)
+	}
+	j.mu.Unlock()
+	slices.SortFunc(states, func(a, b JournalState) int { return cmp.Compare(a.Symbol, b.Symbol) })
+	return states
+}
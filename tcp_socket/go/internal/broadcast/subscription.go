@@ -0,0 +1,167 @@
+package broadcast
+
+import (
+	"bufio"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+
+	"ifin/pkg/codec"
+)
+
+// Subscription is the set of symbols a client wants to receive, and the
+// format it wants them in. A nil set means every symbol, which is what
+// clients get until they SUBSCRIBE, and they get JSON until they ask for
+// another FORMAT. It is guarded by the hub's lock.
+type Subscription struct {
+	symbols map[string]bool
+	format  codec.Codec
+}
+
+// Format returns the codec updates are sent to the client in.
+func (s *Subscription) Format() codec.Codec {
+	if s.format == nil {
+		return codec.JSON
+	}
+	return s.format
+}
+
+// Symbols returns the subscribed symbols, sorted, or nil for every symbol.
+func (s *Subscription) Symbols() []string {
+	if s.symbols == nil {
+		return nil
+	}
+	return slices.Sorted(maps.Keys(s.symbols))
+}
+
+// wants reports whether updates for symbol should be sent to the client.
+func (s *Subscription) wants(symbol string) bool {
+	return s.symbols == nil || s.symbols[symbol]
+}
+
+// subscribe adds symbols; "*" goes back to receiving everything.
+func (s *Subscription) subscribe(symbols []string) {
+	for _, symbol := range symbols {
+		if symbol == "*" {
+			s.symbols = nil
+			return
+		}
+	}
+	if s.symbols == nil {
+		s.symbols = make(map[string]bool)
+	}
+	for _, symbol := range symbols {
+		s.symbols[symbol] = true
+	}
+}
+
+// unsubscribe removes symbols; "*" stops everything.
+func (s *Subscription) unsubscribe(symbols []string) {
+	if s.symbols == nil {
+		s.symbols = make(map[string]bool)
+	}
+	for _, symbol := range symbols {
+		if symbol == "*" {
+			clear(s.symbols)
+			return
+		}
+		delete(s.symbols, symbol)
+	}
+}
+
+// parseSymbols accepts symbols separated by commas and/or spaces.
+func parseSymbols(args []string) []string {
+	var symbols []string
+	for _, arg := range args {
+		for _, symbol := range strings.Split(arg, ",") {
+			if symbol = strings.ToUpper(strings.TrimSpace(symbol)); symbol != "" {
+				symbols = append(symbols, symbol)
+			}
+		}
+	}
+	return symbols
+}
+
+// Serve registers the client on conn, subscribed to every symbol, and
+// executes the commands read from reader, one per line, until the client
+// disconnects, then unregisters it. Replies are queued behind the updates
+// already queued for the client. It returns ErrDropped when the client was
+// dropped before a reply, or nil when the client went away.
+func (h *Hub) Serve(conn net.Conn, reader *bufio.Reader) error {
+	sub := h.Join(conn)
+	defer h.Leave(conn)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil // The client disconnected
+		}
+		response := h.Handle(conn, sub, strings.TrimSpace(line))
+		if response == "" {
+			continue
+		}
+		h.mu.Lock()
+		queued := h.enqueue(conn, write{data: []byte(response)})
+		h.mu.Unlock()
+		if !queued {
+			return ErrDropped
+		}
+	}
+}
+
+// Handle executes one line sent by the client on conn and returns the reply.
+//
+//	PING [id]               -> PONG [id]
+//	SUBSCRIBE AAPL,TSLA     -> OK (only these symbols from now on; * for all)
+//	UNSUBSCRIBE TSLA        -> OK
+//	REPLAY AAPL 42          -> updates of AAPL from sequence 42 (see replay)
+//	FORMAT application/cbor -> OK (updates in this format from now on, see codec.AppendFrame)
+func (h *Hub) Handle(conn net.Conn, sub *Subscription, line string) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	switch strings.ToUpper(fields[0]) {
+	case "PING":
+		// Lets clients measure latency and detect dead connections
+		return strings.TrimSpace("PONG "+strings.Join(fields[1:], " ")) + "\n"
+
+	case "SUBSCRIBE", "UNSUBSCRIBE":
+		symbols := parseSymbols(fields[1:])
+		if len(symbols) == 0 {
+			return "ERR no symbols given\n"
+		}
+		h.mu.Lock()
+		if strings.EqualFold(fields[0], "SUBSCRIBE") {
+			sub.subscribe(symbols)
+		} else {
+			sub.unsubscribe(symbols)
+		}
+		h.mu.Unlock()
+		h.commandLog.Infof("Client %s: %s %s", conn.RemoteAddr(), strings.ToUpper(fields[0]), strings.Join(symbols, ","))
+		return "OK\n"
+
+	case "REPLAY":
+		return h.replay(conn, sub, fields[1:])
+
+	case "FORMAT":
+		if len(fields) != 2 {
+			return "ERR usage: FORMAT <content-type>\n"
+		}
+		format, err := codec.Lookup(fields[1])
+		if err != nil {
+			return "ERR " + err.Error() + "\n"
+		}
+		h.mu.Lock()
+		sub.format = format
+		h.mu.Unlock()
+		h.commandLog.Infof("Client %s: FORMAT %s", conn.RemoteAddr(), format.ContentType())
+		return "OK\n"
+
+	default:
+		h.commandLog.Debugf("Received from %s: %s", conn.RemoteAddr(), line)
+		return "Hello from server\n"
+	}
+}
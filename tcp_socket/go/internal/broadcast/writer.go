@@ -0,0 +1,99 @@
+package broadcast
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+const (
+	sendQueue    = 256              // Writes a client may fall behind before it is dropped
+	writeTimeout = 10 * time.Second // How long one write to a client may take before it is dropped
+)
+
+// ErrDropped is returned by Serve when the client was dropped for falling
+// sendQueue writes behind, or because a write to it failed.
+var ErrDropped = errors.New("client dropped: too slow or write failed")
+
+// client is a registered client: its subscription, and the writes queued
+// for its writer goroutine, so a slow client only holds up itself.
+type client struct {
+	sub   *Subscription
+	queue chan write
+	done  chan struct{} // Closed when the writer has returned
+}
+
+// write is a frame queued for a client.
+type write struct {
+	data   []byte
+	entry  *journalEntry // The update framed in data; nil for a reply or replay
+	queued time.Time     // When it was queued, for ClientWrite
+}
+
+// enqueue queues w for the client on conn without waiting, dropping the
+// client when its queue is full. It reports false when the client is
+// dropped or was already. The hub must be locked.
+func (h *Hub) enqueue(conn net.Conn, w write) bool {
+	c, ok := h.clients[conn]
+	if !ok {
+		return false
+	}
+	select {
+	case c.queue <- w:
+		return true
+	default:
+		h.sendErrors.Add(1)
+		h.broadcasterLog.Warnf("Client %s is %d writes behind, dropping it", conn.RemoteAddr(), sendQueue)
+		h.drop(conn, c)
+		return false
+	}
+}
+
+// drop unregisters the client on conn and closes its connection, which ends
+// its writer and the Serve reading its commands. The hub must be locked.
+func (h *Hub) drop(conn net.Conn, c *client) {
+	if h.clients[conn] != c {
+		return // Already dropped
+	}
+	delete(h.clients, conn)
+	close(c.queue)
+	conn.Close()
+}
+
+// writeLoop writes what is queued for the client on conn, each write
+// bounded by writeTimeout, until its queue is closed or a write fails.
+func (h *Hub) writeLoop(conn net.Conn, c *client) {
+	defer close(c.done)
+	for w := range c.queue {
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		_, err := conn.Write(w.data)
+		if w.entry != nil {
+			h.ClientWrite.Observe(h.clock.Now().Sub(w.queued))
+		}
+		if err != nil {
+			h.writeFailed(conn, c, w, err)
+			return
+		}
+		if w.entry != nil {
+			h.sent.Add(1)
+			h.broadcasterLog.Eventf(w.entry.update.Symbol, "Sent to client %s: %s", conn.RemoteAddr(), w.entry.message)
+		}
+	}
+}
+
+// writeFailed drops the client on conn after w failed to be written to it,
+// unless it was dropped already, which is why the write failed.
+func (h *Hub) writeFailed(conn net.Conn, c *client, w write, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clients[conn] != c {
+		return
+	}
+	h.sendErrors.Add(1)
+	if w.entry != nil {
+		h.broadcasterLog.Errorf("Error sending tick %s to client %s: %v", w.entry.update.ID, conn.RemoteAddr(), err)
+	} else {
+		h.broadcasterLog.Errorf("Error writing to client %s: %v", conn.RemoteAddr(), err)
+	}
+	h.drop(conn, c)
+}
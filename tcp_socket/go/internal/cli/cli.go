@@ -0,0 +1,68 @@
+// Package cli is the plumbing shared by the subcommands of the stockfeed
+// binary: flags that can also be set from the environment, and the log
+// flags every subcommand configures package logging with.
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"ifin/internal/logging"
+)
+
+// Parse parses args into fs, after setting each flag from its environment
+// variable, if present: envPrefix followed by the upper-cased flag name, so
+// -redis-addr is CLIENT_REDIS_ADDR with the prefix CLIENT_. Flags given on
+// the command line win over the environment.
+func Parse(fs *flag.FlagSet, envPrefix string, args []string) error {
+	if err := applyEnv(fs, envPrefix); err != nil {
+		return err
+	}
+	return fs.Parse(args)
+}
+
+// applyEnv sets each flag of fs from its environment variable, if present.
+func applyEnv(fs *flag.FlagSet, envPrefix string) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		name := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		value, ok := os.LookupEnv(name)
+		if !ok || err != nil {
+			return
+		}
+		if setErr := f.Value.Set(value); setErr != nil {
+			err = fmt.Errorf("invalid %s: %w", name, setErr)
+		}
+	})
+	return err
+}
+
+// LogFlags are the -log-level, -log-components and -log-sample flags.
+type LogFlags struct {
+	Level      string
+	Components string
+	Sample     string
+}
+
+// Register defines the log flags in fs. components lists the components
+// whose level can be set, for the help text, and example overrides them.
+func (l *LogFlags) Register(fs *flag.FlagSet, components, example string) {
+	fs.StringVar(&l.Level, "log-level", "debug", "Lowest level logged: debug (a line per message), info (connection events), warn or error")
+	fs.StringVar(&l.Components, "log-components", "", "Per-component log levels overriding -log-level, e.g. "+example+" (components: "+components+")")
+	fs.StringVar(&l.Sample, "log-sample", "", "Sampling of per-message debug lines: N logs 1 in N, a period such as 1s the first per symbol in each period (all when empty)")
+}
+
+// Configure sets the levels and sampling of every logger from the flags.
+func (l LogFlags) Configure() error {
+	cfg, err := logging.Parse(l.Level, l.Components)
+	if err != nil {
+		return err
+	}
+	if cfg.Sampling, err = logging.ParseSampling(l.Sample); err != nil {
+		return err
+	}
+	logging.Configure(cfg)
+	return nil
+}
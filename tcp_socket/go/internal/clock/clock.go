@@ -0,0 +1,183 @@
+// Package clock abstracts reading the time and waiting for it to pass, so
+// what runs on a timer, such as the server's broadcast loop, can be driven
+// step by step by a Fake clock instead of real sleeps.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time and makes tickers and timers.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+	NewTimer(d time.Duration) Timer
+}
+
+// Ticker is a time.Ticker of a Clock.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Timer is a time.Timer of a Clock.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Real is the system clock
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTicker struct{ *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.Ticker.C }
+
+type realTimer struct{ *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.Timer.C }
+
+// Fake is a clock standing still until Advance moves it. It is safe for
+// concurrent use.
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers map[*fakeTicker]struct{}
+	timers  map[*fakeTimer]struct{} // Those not fired or stopped yet
+}
+
+// NewFake returns a fake clock reading now.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now, tickers: make(map[*fakeTicker]struct{}), timers: make(map[*fakeTimer]struct{})}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// NewTicker returns a ticker firing every d of fake time.
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t := &fakeTicker{clock: f, c: make(chan time.Time, 1), period: d, next: f.now.Add(d)}
+	f.tickers[t] = struct{}{}
+	return t
+}
+
+// NewTimer returns a timer firing once d of fake time has passed.
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t := &fakeTimer{clock: f, c: make(chan time.Time, 1)}
+	f.start(t, d)
+	return t
+}
+
+// start sets t to fire after d, at once when d is not positive. f.mu must
+// be held.
+func (f *Fake) start(t *fakeTimer, d time.Duration) {
+	t.when = f.now.Add(d)
+	if d <= 0 {
+		t.fire()
+		return
+	}
+	f.timers[t] = struct{}{}
+}
+
+// Advance moves the clock forward by d, firing the tickers and timers that
+// fall due on the way. Like a time.Ticker, a ticker whose last tick was not
+// received yet drops the new ones.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+	for t := range f.tickers {
+		for !t.next.After(f.now) {
+			select {
+			case t.c <- t.next:
+			default:
+			}
+			t.next = t.next.Add(t.period)
+		}
+	}
+	for t := range f.timers {
+		if !t.when.After(f.now) {
+			delete(f.timers, t)
+			t.fire()
+		}
+	}
+}
+
+type fakeTicker struct {
+	clock  *Fake
+	c      chan time.Time
+	period time.Duration
+	next   time.Time // When it fires next; guarded by the clock's lock
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.c }
+
+func (t *fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	delete(t.clock.tickers, t)
+}
+
+type fakeTimer struct {
+	clock *Fake
+	c     chan time.Time
+	when  time.Time // When it fires; guarded by the clock's lock
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+// fire sends the time it was due at, unless the last one was not received.
+func (t *fakeTimer) fire() {
+	select {
+	case t.c <- t.when:
+	default:
+	}
+}
+
+// Stop reports whether it stopped the timer before it fired.
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	_, active := t.clock.timers[t]
+	delete(t.clock.timers, t)
+	return active
+}
+
+// Reset sets the timer to fire after d from now, reporting whether it was
+// active. Like a time.Timer since Go 1.23, a time not received yet is
+// discarded.
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	_, active := t.clock.timers[t]
+	select {
+	case <-t.c:
+	default:
+	}
+	t.clock.start(t, d)
+	return active
+}
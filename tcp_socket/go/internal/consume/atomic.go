@@ -0,0 +1,72 @@
+package consume
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// updateScript stores one update in a single atomic step: it sets the
+// latest price, appends to the history stream and sorted set, and publishes
+// the update, so subscribers never see an update the cache does not hold.
+//
+// KEYS: latest price key (or hash), history stream, history sorted set.
+// ARGV: hash field ("" for a plain key), value to store, TTL in ms (0 for
+// none), stream max length (0 to skip), timestamp, sorted-set cutoff ("" to
+// skip), channel ("" to skip), encoded update to publish.
+var updateScript = redis.NewScript(`
+local field, value, ttl, maxlen = ARGV[1], ARGV[2], tonumber(ARGV[3]), tonumber(ARGV[4])
+local ts, cutoff, channel, message = ARGV[5], ARGV[6], ARGV[7], ARGV[8]
+
+if field == '' then
+	if ttl > 0 then
+		redis.call('SET', KEYS[1], value, 'PX', ttl)
+	else
+		redis.call('SET', KEYS[1], value)
+	end
+else
+	redis.call('HSET', KEYS[1], field, value)
+	if ttl > 0 then
+		redis.call('HPEXPIRE', KEYS[1], ttl, 'FIELDS', 1, field)
+	end
+end
+
+if maxlen > 0 then
+	-- Same entry layout as pricestream.Add
+	redis.call('XADD', KEYS[2], 'MAXLEN', '~', maxlen, '*', 'data', value)
+end
+if cutoff ~= '' then
+	redis.call('ZADD', KEYS[3], ts, value)
+	redis.call('ZREMRANGEBYSCORE', KEYS[3], '-inf', '(' .. cutoff)
+end
+if channel ~= '' then
+	redis.call('PUBLISH', channel, message)
+end
+return 1
+`)
+
+// loadUpdateScript caches the script in Redis, so the EVALSHA sent in
+// pipelines finds it. Outside pipelines a missing script is sent again.
+func loadUpdateScript(ctx context.Context, rdb redis.UniversalClient) error {
+	return updateScript.Load(ctx, rdb).Err()
+}
+
+// writeAtomically runs updateScript for w through s, a client or pipeline.
+// The history is only appended to when update is set; batched writes
+// coalesced per symbol pass a zero update.
+func (c *priceCache) writeAtomically(ctx context.Context, s redis.Scripter, w pendingWrite, update StockUpdate) *redis.Cmd {
+	// Unused history keys repeat w.key, which keeps them in its cluster slot
+	keys := []string{w.key, w.key, w.key}
+	var maxLen int64
+	cutoff := ""
+	if update.Symbol != "" {
+		keys[1], keys[2] = c.keys.Stream(update.Symbol), c.keys.History(update.Symbol)
+		maxLen = c.streamMaxLen
+		if c.historyRetention > 0 && update.Timestamp != 0 {
+			cutoff = strconv.FormatInt(time.UnixMilli(update.Timestamp).Add(-c.historyRetention).UnixMilli(), 10)
+		}
+	}
+	return updateScript.Run(ctx, s, keys, w.field, c.encode(w.value), c.ttl.Milliseconds(), maxLen, update.Timestamp, cutoff, c.channel, w.value)
+}
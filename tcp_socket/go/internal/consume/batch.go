@@ -0,0 +1,143 @@
+package consume
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// batchWriter is a write-behind layer: it collects cache writes for a short
+// window and sends them to Redis in one pipeline from its own goroutine, so
+// the feed's read loop never waits on Redis and a round trip per update is
+// saved at high tick rates. Within a window only the latest value of each
+// key is written.
+type batchWriter struct {
+	cache  *priceCache // Where the writes go, and how
+	window time.Duration
+
+	mu      sync.Mutex
+	pending map[string]pendingWrite // Symbol -> latest write
+	order   []string                // Symbols in the order they were first written
+	history []historyEntry          // Every update, when history is kept
+}
+
+func newBatchWriter(cache *priceCache, window time.Duration) *batchWriter {
+	return &batchWriter{cache: cache, window: window, pending: make(map[string]pendingWrite)}
+}
+
+// Add queues a write of update for the next flush.
+func (b *batchWriter) Add(update StockUpdate, w pendingWrite) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.pending[update.Symbol]; ok {
+		b.cache.metrics.coalesced.Add(1)
+	} else {
+		b.order = append(b.order, update.Symbol)
+	}
+	b.pending[update.Symbol] = w
+	if b.cache.keepsHistory() {
+		b.history = append(b.history, historyEntry{update: update, message: w.value})
+	}
+}
+
+// Pending reports whether a write of symbol is waiting for the next flush.
+func (b *batchWriter) Pending(symbol string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.pending[symbol]
+	return ok
+}
+
+// take empties the batch, returning its writes in order and the updates
+// for the history.
+func (b *batchWriter) take() (writes []pendingWrite, history []historyEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	writes = make([]pendingWrite, 0, len(b.order))
+	for _, symbol := range b.order {
+		writes = append(writes, b.pending[symbol])
+	}
+	history = b.history
+	clear(b.pending)
+	b.order = b.order[:0]
+	b.history = nil
+	return writes, history
+}
+
+// Flush writes the batch in a single pipeline. When that fails the writes go
+// to the retry buffer, like individual writes do.
+func (b *batchWriter) Flush(ctx context.Context) {
+	writes, history := b.take()
+	if len(writes) == 0 {
+		return
+	}
+	cache := b.cache
+
+	// Queue behind earlier failures so writes reach Redis in order
+	if cache.deferring() {
+		for _, w := range writes {
+			cache.buffer.Add(w)
+		}
+		return
+	}
+
+	start := time.Now()
+	_, err := cache.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		if cache.atomic {
+			cache.flushAtomically(ctx, pipe, writes, history)
+			return nil
+		}
+		for _, w := range writes {
+			cache.write(ctx, pipe, w)
+			if cache.channel != "" {
+				pipe.Publish(ctx, cache.channel, w.value)
+			}
+		}
+		for _, h := range history {
+			cache.recordHistory(ctx, pipe, h.update, h.message)
+		}
+		return nil
+	})
+	cache.metrics.observeRedisWrite(time.Since(start))
+	if err != nil {
+		if !cache.health.fail(err) {
+			redisLog.Errorf("Error writing batch to Redis, buffering until it recovers: %v", err)
+		}
+		for _, w := range writes {
+			cache.buffer.Add(w)
+		}
+		return
+	}
+	redisLog.Eventf("", "Cached %d messages in one batch", len(writes))
+}
+
+// flushAtomically queues updateScript runs for a batch. With history kept,
+// every update is run in order (the last one per symbol leaving the latest
+// price); otherwise only the coalesced writes are.
+func (c *priceCache) flushAtomically(ctx context.Context, pipe redis.Pipeliner, writes []pendingWrite, history []historyEntry) {
+	if !c.keepsHistory() {
+		for _, w := range writes {
+			c.writeAtomically(ctx, pipe, w, StockUpdate{})
+		}
+		return
+	}
+	for _, h := range history {
+		c.writeAtomically(ctx, pipe, c.newWrite(h.update.Symbol, h.message), h.update)
+	}
+}
+
+// Run flushes the batch every window of the cache's clock until ctx is done.
+func (b *batchWriter) Run(ctx context.Context) {
+	ticker := b.cache.clock.NewTicker(b.window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			b.Flush(ctx)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package consume
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"ifin/internal/clock"
+)
+
+// Overflow policies for retryBuffer
+const (
+	overflowDropOldest = "drop-oldest" // Make room by discarding the oldest buffered write
+	overflowDropNewest = "drop-newest" // Discard the write that didn't fit
+)
+
+// pendingWrite is a latest-price write that has not been applied yet: a
+// SET of key, or an HSET of field in key when field is set.
+type pendingWrite struct {
+	key   string
+	field string
+	value string
+}
+
+// writeTarget identifies what a write overwrites.
+type writeTarget struct {
+	key   string
+	field string
+}
+
+func (w pendingWrite) target() writeTarget {
+	return writeTarget{key: w.key, field: w.field}
+}
+
+// retryBuffer is a bounded FIFO of cache writes that failed while Redis was
+// unavailable. While it holds anything, new writes queue behind it so an
+// older value can never overwrite a newer one once Redis is back. Writes to
+// the same target are coalesced: a new value replaces the buffered one, as
+// only the latest price of a symbol needs to reach Redis.
+type retryBuffer struct {
+	capacity int
+	policy   string
+
+	mu        sync.Mutex
+	items     []pendingWrite
+	first     uint64                 // Position of items[0] among all writes ever queued
+	index     map[writeTarget]uint64 // Position of the buffered write to each target
+	total     uint64                 // Writes ever buffered
+	coalesced uint64                 // Writes that replaced a buffered one
+	dropped   uint64                 // Writes lost to the overflow policy
+	flushed   uint64                 // Buffered writes later stored in Redis
+}
+
+func newRetryBuffer(capacity int, policy string) (*retryBuffer, error) {
+	if policy != overflowDropOldest && policy != overflowDropNewest {
+		return nil, fmt.Errorf("unknown overflow policy %q", policy)
+	}
+	return &retryBuffer{capacity: capacity, policy: policy, index: make(map[writeTarget]uint64)}, nil
+}
+
+// Empty reports whether there is nothing waiting to be retried.
+func (b *retryBuffer) Empty() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.items) == 0
+}
+
+// Add queues a write, applying the overflow policy when the buffer is full.
+func (b *retryBuffer) Add(w pendingWrite) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.total++
+	if position, ok := b.index[w.target()]; ok {
+		b.items[position-b.first] = w
+		b.coalesced++
+		return
+	}
+	if len(b.items) >= b.capacity {
+		b.dropped++
+		if b.policy == overflowDropNewest || b.capacity == 0 {
+			return
+		}
+		b.pop()
+	}
+	b.index[w.target()] = b.first + uint64(len(b.items))
+	b.items = append(b.items, w)
+}
+
+// pop removes the oldest write. b.mu must be held.
+func (b *retryBuffer) pop() {
+	delete(b.index, b.items[0].target())
+	b.items = b.items[1:]
+	b.first++
+}
+
+// Flush applies buffered entries in order with write, stopping at the first
+// failure so the rest stay queued for the next attempt.
+func (b *retryBuffer) Flush(ctx context.Context, write func(context.Context, pendingWrite) error) (int, error) {
+	flushed := 0
+	for {
+		b.mu.Lock()
+		if len(b.items) == 0 {
+			b.mu.Unlock()
+			return flushed, nil
+		}
+		item := b.items[0]
+		b.mu.Unlock()
+
+		if err := write(ctx, item); err != nil {
+			return flushed, err
+		}
+
+		b.mu.Lock()
+		// Add may have dropped the head under drop-oldest, or replaced it with
+		// a newer value to write next, while we were writing
+		if len(b.items) > 0 && b.items[0] == item {
+			b.pop()
+		}
+		b.flushed++
+		b.mu.Unlock()
+		flushed++
+	}
+}
+
+// bufferStats is a snapshot of the retry buffer counters.
+type bufferStats struct {
+	Pending   int    `json:"pending"`
+	Total     uint64 `json:"buffered_total"`
+	Coalesced uint64 `json:"coalesced_total"`
+	Dropped   uint64 `json:"dropped_total"`
+	Flushed   uint64 `json:"flushed_total"`
+}
+
+func (b *retryBuffer) Stats() bufferStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return bufferStats{Pending: len(b.items), Total: b.total, Coalesced: b.coalesced, Dropped: b.dropped, Flushed: b.flushed}
+}
+
+// retryBufferedWrites flushes the cache's buffer every interval of clk until
+// ctx is done.
+func retryBufferedWrites(ctx context.Context, cache *priceCache, clk clock.Clock, interval time.Duration) {
+	buffer := cache.buffer
+	ticker := clk.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		if buffer.Empty() || !cache.health.Available() {
+			continue
+		}
+		flushed, err := buffer.Flush(ctx, cache.writeNow)
+		stats := buffer.Stats()
+		if err != nil {
+			redisLog.Warnf("Redis still unavailable, %d writes buffered (%d dropped so far)", stats.Pending, stats.Dropped)
+			continue
+		}
+		redisLog.Infof("Redis recovered, flushed %d buffered writes (%d dropped so far)", flushed, stats.Dropped)
+	}
+}
+
+// drainWrites is called on shutdown, once the feed has stopped, to send
+// whatever is still batched or buffered to Redis. ctx bounds how long it may
+// take; anything left after that is lost.
+func drainWrites(ctx context.Context, cache *priceCache) {
+	if cache.batch != nil {
+		cache.batch.Flush(ctx)
+	}
+	if cache.buffer.Empty() {
+		return
+	}
+
+	flushed, err := cache.buffer.Flush(ctx, cache.writeNow)
+	if err != nil {
+		redisLog.Errorf("Error draining buffered writes, %d lost: %v", cache.buffer.Stats().Pending, err)
+		return
+	}
+	redisLog.Infof("Drained %d buffered writes to Redis", flushed)
+}
@@ -0,0 +1,411 @@
+package consume
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"ifin/internal/clock"
+	"ifin/internal/tracing"
+	"ifin/pkg/codec"
+	"ifin/pkg/compression"
+	"ifin/pkg/keyspace"
+	"ifin/pkg/store"
+)
+
+// priceCache is the Redis implementation of store.Store: Redis, backed by
+// the retry buffer for failed writes, plus an in-process copy of the latest
+// update per symbol so readers keep getting data while Redis is down.
+type priceCache struct {
+	rdb              redis.UniversalClient
+	keys             keyspace.Namespace
+	layout           string // layoutHash or layoutKeys
+	buffer           *retryBuffer
+	health           *redisHealth  // Circuit breaker; nil when Redis is not checked
+	batch            *batchWriter  // Nil when every update is written on its own
+	channel          string        // Pub/Sub channel updates are published on; "" to disable
+	streamMaxLen     int64         // Length of the per-symbol history streams; 0 to disable
+	historyRetention time.Duration // How long the per-symbol sorted sets keep updates; 0 to disable
+	ttl              time.Duration // Expiry of the latest-price keys; 0 keeps them forever
+	atomic           bool          // Store and publish each update with updateScript
+	keyspaceEvents   bool          // Subscribe follows keyspace notifications instead of the channel
+	compression      string        // Algorithm stored values are compressed with
+	format           codec.Codec   // Codec stored and published values are encoded with
+	clock            clock.Clock   // Tells which latest prices are past the TTL
+	metrics          *clientMetrics
+
+	mu     sync.RWMutex
+	latest map[string]StockUpdate // Symbol -> latest update
+}
+
+var _ store.Store = (*priceCache)(nil)
+
+// Layouts of the latest prices in Redis
+const (
+	layoutHash = "hash" // One hash, <prefix>.data, with a field per symbol
+	layoutKeys = "keys" // A key per symbol, <prefix>.data.<SYMBOL>
+)
+
+// mgetChunk is the most keys read by one MGET in the keys layout
+const mgetChunk = 500
+
+func newPriceCache(rdb redis.UniversalClient, keys keyspace.Namespace, buffer *retryBuffer, layout string, clk clock.Clock, metrics *clientMetrics) (*priceCache, error) {
+	if layout != layoutHash && layout != layoutKeys {
+		return nil, fmt.Errorf("unknown cache layout %q", layout)
+	}
+	return &priceCache{rdb: rdb, keys: keys, layout: layout, buffer: buffer, format: codec.JSON, clock: clk, metrics: metrics, latest: make(map[string]StockUpdate)}, nil
+}
+
+// priceWriter is satisfied by both redis.UniversalClient and redis.Pipeliner.
+type priceWriter interface {
+	Set(ctx context.Context, key string, value any, expiration time.Duration) *redis.StatusCmd
+	HSet(ctx context.Context, key string, values ...any) *redis.IntCmd
+	HExpire(ctx context.Context, key string, expiration time.Duration, fields ...string) *redis.IntSliceCmd
+}
+
+// newWrite returns the write storing message as symbol's latest price.
+func (c *priceCache) newWrite(symbol, message string) pendingWrite {
+	if c.layout == layoutHash {
+		return pendingWrite{key: c.keys.Data(), field: symbol, value: message}
+	}
+	return pendingWrite{key: c.keys.Latest(symbol), value: message}
+}
+
+// write applies w through rdb, a client or a pipeline. In the hash layout
+// the TTL is set per field, which needs Redis 7.4 or later.
+func (c *priceCache) write(ctx context.Context, rdb priceWriter, w pendingWrite) error {
+	value := c.encode(w.value)
+	if w.field == "" {
+		return rdb.Set(ctx, w.key, value, c.ttl).Err()
+	}
+	err := rdb.HSet(ctx, w.key, w.field, value).Err()
+	if err == nil && c.ttl > 0 {
+		err = rdb.HExpire(ctx, w.key, c.ttl, w.field).Err()
+	}
+	return err
+}
+
+// writeNow applies w straight away.
+func (c *priceCache) writeNow(ctx context.Context, w pendingWrite) error {
+	return c.write(ctx, c.rdb, w)
+}
+
+// Put stores the update as its symbol's latest price. Writes that fail are
+// kept in the retry buffer until Redis recovers, and the in-memory copy is
+// updated either way.
+func (c *priceCache) Put(ctx context.Context, update StockUpdate) error {
+	if update.TraceParent != "" {
+		var span trace.Span
+		ctx, span = startSpan(ctx, update, "redis.write", trace.WithAttributes(attribute.Bool("batched", c.batch != nil)))
+		defer span.End()
+		update.TraceParent = tracing.TraceParent(ctx)
+	}
+	c.remember(update)
+
+	data, err := codec.Encode(c.format, update)
+	if err != nil {
+		return err
+	}
+	message := string(data)
+	write := c.newWrite(update.Symbol, message)
+
+	// Queue behind earlier failures so writes reach Redis in order
+	if c.deferring() {
+		c.buffer.Add(write)
+		return nil
+	}
+	if c.batch != nil {
+		c.batch.Add(update, write)
+		return nil
+	}
+
+	start := time.Now()
+	if c.atomic {
+		err = c.writeAtomically(ctx, c.rdb, write, update).Err()
+	} else {
+		err = c.writeNow(ctx, write)
+	}
+	c.metrics.observeRedisWrite(time.Since(start))
+	if err != nil {
+		if !c.health.fail(err) {
+			redisLog.Errorf("Error caching message in Redis, buffering until it recovers: %v", err)
+		}
+		c.buffer.Add(write)
+		return nil
+	}
+	redisLog.Eventf(update.Symbol, "Cached update %s for %s", update.ID, update.Symbol)
+	if c.atomic {
+		return nil // Published and added to the history by the script
+	}
+
+	if c.channel != "" {
+		if err := c.rdb.Publish(ctx, c.channel, message).Err(); err != nil {
+			redisLog.Errorf("Error publishing update: %v", err)
+		}
+	}
+	if c.keepsHistory() {
+		_, err := c.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			c.recordHistory(ctx, pipe, update, message)
+			return nil
+		})
+		if err != nil {
+			redisLog.Errorf("Error recording price history: %v", err)
+		}
+	}
+	return nil
+}
+
+// GetAll reads the latest updates through to Redis, refreshing the
+// in-memory copy with what it finds. While Redis is unreachable, or still has
+// buffered writes to catch up on, the in-memory copy is served instead.
+func (c *priceCache) GetAll(ctx context.Context) ([]StockUpdate, error) {
+	if c.deferring() {
+		return c.localSnapshot(), nil
+	}
+
+	values, err := c.readAll(ctx)
+	if err != nil {
+		redisLog.Warnf("Error reading prices from Redis, serving in-memory prices: %v", err)
+		return c.localSnapshot(), nil
+	}
+
+	var updates []StockUpdate
+	for _, data := range values {
+		var update StockUpdate
+		if unmarshalStored(data, &update) == nil {
+			updates = append(updates, update)
+		}
+	}
+
+	c.reconcile(updates)
+	return c.localSnapshot(), nil
+}
+
+// GetLatest reads symbol's latest update through to Redis like GetAll.
+func (c *priceCache) GetLatest(ctx context.Context, symbol string) (StockUpdate, bool, error) {
+	if !c.deferring() {
+		data, err := c.readOne(ctx, symbol)
+		var update StockUpdate
+		switch {
+		case err == nil:
+			if unmarshalStored(data, &update) == nil {
+				c.reconcile([]StockUpdate{update})
+			}
+		case !errors.Is(err, redis.Nil):
+			redisLog.Warnf("Error reading %s from Redis, serving in-memory price: %v", symbol, err)
+		}
+	}
+
+	for _, update := range c.localSnapshot() {
+		if update.Symbol == symbol {
+			return update, true, nil
+		}
+	}
+	return StockUpdate{}, false, nil
+}
+
+// Subscribe delivers the updates published on the cache's channel, by this
+// client or any other sharing the Redis, or with keyspace events those
+// written by anyone. It returns store.ErrUnsupported when both are disabled.
+func (c *priceCache) Subscribe(ctx context.Context) (<-chan StockUpdate, error) {
+	if c.keyspaceEvents {
+		return c.subscribeKeyspace(ctx)
+	}
+	if c.channel == "" {
+		return nil, store.ErrUnsupported
+	}
+	return forwardMessages(ctx, c.rdb.Subscribe(ctx, c.channel), func(msg *redis.Message) []StockUpdate {
+		var update StockUpdate
+		if err := codec.Decode([]byte(msg.Payload), &update); err != nil {
+			return nil
+		}
+		return []StockUpdate{update}
+	})
+}
+
+// forwardMessages turns the messages of sub into updates with decode until
+// ctx is done. It fails if the subscription cannot be made.
+func forwardMessages(ctx context.Context, sub *redis.PubSub, decode func(*redis.Message) []StockUpdate) (<-chan StockUpdate, error) {
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, err
+	}
+
+	updates := make(chan StockUpdate)
+	go func() {
+		defer close(updates)
+		defer sub.Close()
+		messages := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				for _, update := range decode(msg) {
+					select {
+					case updates <- update:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+	return updates, nil
+}
+
+// encode compresses message for storage as configured.
+func (c *priceCache) encode(message string) string {
+	if c.compression == "" || c.compression == compression.None {
+		return message
+	}
+	return string(compression.Compress(c.compression, []byte(message)))
+}
+
+// unmarshalStored decodes an update as stored in Redis, compressed or not,
+// in whichever format it was encoded.
+func unmarshalStored(value string, update *StockUpdate) error {
+	data, err := compression.Decompress([]byte(value))
+	if err != nil {
+		return err
+	}
+	return codec.Decode(data, update)
+}
+
+// deferring reports whether Redis is bypassed: it is known to be down, or
+// earlier writes are still waiting in the retry buffer.
+func (c *priceCache) deferring() bool {
+	return !c.health.Available() || !c.buffer.Empty()
+}
+
+// readOne returns symbol's latest price as stored in Redis.
+func (c *priceCache) readOne(ctx context.Context, symbol string) (string, error) {
+	if c.layout == layoutHash {
+		return c.rdb.HGet(ctx, c.keys.Data(), symbol).Result()
+	}
+	return c.rdb.Get(ctx, c.keys.Latest(symbol)).Result()
+}
+
+// readAll returns the latest price of every symbol as stored in Redis.
+func (c *priceCache) readAll(ctx context.Context) ([]string, error) {
+	if c.layout == layoutHash {
+		fields, err := c.rdb.HGetAll(ctx, c.keys.Data()).Result()
+		if err != nil {
+			return nil, err
+		}
+		values := make([]string, 0, len(fields))
+		for _, value := range fields {
+			values = append(values, value)
+		}
+		return values, nil
+	}
+
+	keys, err := scanKeys(ctx, c.rdb, c.keys.Pattern("data"))
+	if err != nil {
+		return nil, err
+	}
+	if clustered(c.rdb) {
+		return c.pipelinedGet(ctx, keys)
+	}
+
+	// One MGET per chunk of keys rather than a GET (and round trip) each
+	var values []string
+	for chunk := range slices.Chunk(keys, mgetChunk) {
+		results, err := c.rdb.MGet(ctx, chunk...).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range results {
+			if data, ok := result.(string); ok { // nil when the key expired meanwhile
+				values = append(values, data)
+			}
+		}
+	}
+	return values, nil
+}
+
+// remember records an update in the in-process copy.
+func (c *priceCache) remember(update StockUpdate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.latest[update.Symbol] = update
+}
+
+// reconcile merges updates read back from Redis into the in-process copy, so
+// it also reflects writes made by other client instances. An update does not
+// replace a newer one, or one still waiting in the batch, whose write has not
+// reached Redis yet.
+func (c *priceCache) reconcile(updates []StockUpdate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, update := range updates {
+		if c.batch != nil && c.batch.Pending(update.Symbol) {
+			continue
+		}
+		if local, ok := c.latest[update.Symbol]; ok && !newer(update, local) {
+			continue
+		}
+		c.latest[update.Symbol] = update
+	}
+}
+
+// newer reports whether a is a later update of its symbol than b: by
+// sequence number when both have one, by timestamp otherwise.
+func newer(a, b StockUpdate) bool {
+	if a.Seq != 0 && b.Seq != 0 {
+		return a.Seq > b.Seq
+	}
+	return a.Timestamp > b.Timestamp
+}
+
+// localSnapshot returns the in-process copy ordered by symbol. Like the
+// Redis keys, entries older than the TTL are left out.
+func (c *priceCache) localSnapshot() []StockUpdate {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	expired := c.clock.Now().Add(-c.ttl).UnixMilli()
+	updates := make([]StockUpdate, 0, len(c.latest))
+	for _, update := range c.latest {
+		if c.ttl > 0 && update.Timestamp != 0 && update.Timestamp < expired {
+			continue
+		}
+		updates = append(updates, update)
+	}
+	sort.Slice(updates, func(i, j int) bool { return updates[i].Symbol < updates[j].Symbol })
+	return updates
+}
+
+// pipelinedGet reads keys with one pipeline of GETs. Unlike MGET it works
+// when the keys are spread over cluster nodes.
+func (c *priceCache) pipelinedGet(ctx context.Context, keys []string) ([]string, error) {
+	cmds := make([]*redis.StringCmd, len(keys))
+	_, err := c.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Get(ctx, key)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	values := make([]string, 0, len(keys))
+	for _, cmd := range cmds {
+		if data, err := cmd.Result(); err == nil { // redis.Nil when the key expired meanwhile
+			values = append(values, data)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,103 @@
+package consume
+
+import (
+	"testing"
+	"time"
+
+	"ifin/internal/clock"
+	"ifin/pkg/keyspace"
+)
+
+func TestLocalSnapshotLeavesOutExpiredByClock(t *testing.T) {
+	clk := clock.NewFake(time.UnixMilli(1_700_000_000_000))
+	cache, err := newPriceCache(nil, keyspace.Default, nil, layoutHash, clk, newClientMetrics())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.ttl = time.Minute
+
+	cache.remember(StockUpdate{Symbol: "AAPL", Price: 190, Timestamp: clk.Now().UnixMilli()})
+	clk.Advance(30 * time.Second)
+	cache.remember(StockUpdate{Symbol: "MSFT", Price: 410, Timestamp: clk.Now().UnixMilli()})
+	if got := symbols(cache.localSnapshot()); got != "AAPL,MSFT" {
+		t.Fatalf("snapshot %s, want AAPL,MSFT", got)
+	}
+
+	// A minute after AAPL's update, only MSFT's is within the TTL
+	clk.Advance(31 * time.Second)
+	if got := symbols(cache.localSnapshot()); got != "MSFT" {
+		t.Fatalf("snapshot %s, want MSFT", got)
+	}
+
+	cache.ttl = 0
+	if got := symbols(cache.localSnapshot()); got != "AAPL,MSFT" {
+		t.Fatalf("snapshot %s without a TTL, want AAPL,MSFT", got)
+	}
+}
+
+func TestReconcileKeepsNewerLocalUpdate(t *testing.T) {
+	cache, err := newPriceCache(nil, keyspace.Default, nil, layoutHash, clock.Real, newClientMetrics())
+	if err != nil {
+		t.Fatal(err)
+	}
+	price := func(symbol string) float64 {
+		t.Helper()
+		for _, update := range cache.localSnapshot() {
+			if update.Symbol == symbol {
+				return update.Price
+			}
+		}
+		t.Fatalf("no %s in the snapshot", symbol)
+		return 0
+	}
+
+	// Written here but not in Redis yet: Redis still has the previous update
+	cache.remember(StockUpdate{Symbol: "AAPL", Price: 191, Seq: 5, Timestamp: 2000})
+	cache.remember(StockUpdate{Symbol: "MSFT", Price: 411, Timestamp: 2000})
+	cache.reconcile([]StockUpdate{
+		{Symbol: "AAPL", Price: 190, Seq: 4, Timestamp: 1000},
+		{Symbol: "MSFT", Price: 410, Timestamp: 1000},
+	})
+	if aapl, msft := price("AAPL"), price("MSFT"); aapl != 191 || msft != 411 {
+		t.Fatalf("after reconciling older updates: AAPL %v, MSFT %v; want 191 and 411", aapl, msft)
+	}
+
+	// Written by another instance
+	cache.reconcile([]StockUpdate{
+		{Symbol: "AAPL", Price: 192, Seq: 6, Timestamp: 3000},
+		{Symbol: "MSFT", Price: 412, Timestamp: 3000},
+	})
+	if aapl, msft := price("AAPL"), price("MSFT"); aapl != 192 || msft != 412 {
+		t.Errorf("after reconciling newer updates: AAPL %v, MSFT %v; want 192 and 412", aapl, msft)
+	}
+}
+
+func TestReconcileSkipsBatchedWrites(t *testing.T) {
+	cache, err := newPriceCache(nil, keyspace.Default, nil, layoutHash, clock.Real, newClientMetrics())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.batch = newBatchWriter(cache, time.Second)
+
+	// Without a sequence number or time, only the pending write tells which
+	// is newer
+	update := StockUpdate{Symbol: "AAPL", Price: 191}
+	cache.remember(update)
+	cache.batch.Add(update, cache.newWrite(update.Symbol, "{}"))
+	cache.reconcile([]StockUpdate{{Symbol: "AAPL", Price: 190, Timestamp: 1000}})
+	if snapshot := cache.localSnapshot(); len(snapshot) != 1 || snapshot[0].Price != 191 {
+		t.Errorf("snapshot %+v, want the batched price 191", snapshot)
+	}
+}
+
+// symbols joins the symbols of updates with commas.
+func symbols(updates []StockUpdate) string {
+	var list string
+	for i, update := range updates {
+		if i > 0 {
+			list += ","
+		}
+		list += update.Symbol
+	}
+	return list
+}
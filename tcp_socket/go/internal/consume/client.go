@@ -0,0 +1,186 @@
+package consume
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"ifin/internal/clock"
+	"ifin/internal/debug"
+	"ifin/internal/httpapi"
+	"ifin/internal/logging"
+	"ifin/internal/secrets"
+	"ifin/pkg/feedclient"
+)
+
+// httpShutdownTimeout is how long requests in flight may take to finish on
+// shutdown before their connections are closed
+const httpShutdownTimeout = 5 * time.Second
+
+// client is the feed client: it consumes the feed into the store and serves
+// the store over HTTP, and gRPC when configured.
+type client struct {
+	cfg         *config
+	logger      *slog.Logger    // Passed on to the HTTP API; nil for its own loggers
+	log         *logging.Logger // The HTTP and gRPC servers
+	clientLog   *logging.Logger // Shutdown
+	pipelineLog *logging.Logger // A line per update skipped
+	statsLog    *logging.Logger // The periodic stats line
+	clock       clock.Clock     // Measures how late updates arrive and which are stale, and times the stats
+	st          *storage
+	feed        *feedclient.Group
+	buffer      *retryBuffer   // Writes waiting for Redis, reported by /metrics
+	metrics     *clientMetrics // Reported by /stats and /metrics
+	events      *eventLog      // Served on /events; nil records nothing
+	hooks       clientHooks    // Run on every update, see registerHooks
+	plugins     []*sinkPlugin
+}
+
+// newClient returns a client consuming feed into st, through the registered
+// hooks, counting in metrics and logging to logger. A nil logger prints to
+// stdout like the rest of the client, and a nil clk is the system clock.
+func newClient(cfg *config, logger *slog.Logger, clk clock.Clock, st *storage, feed *feedclient.Group, buffer *retryBuffer, metrics *clientMetrics, events *eventLog) *client {
+	if clk == nil {
+		clk = clock.Real
+	}
+	return &client{
+		cfg:         cfg,
+		logger:      logger,
+		log:         httpLog.To(logger),
+		clientLog:   clientLog.To(logger),
+		pipelineLog: pipelineLog.To(logger),
+		statsLog:    statsLog.To(logger),
+		clock:       clk,
+		st:          st,
+		feed:        feed,
+		buffer:      buffer,
+		metrics:     metrics,
+		events:      events,
+		hooks:       registeredHooks(),
+		plugins:     newSinkPlugins(cfg.SinkPlugins, cfg.SinkBuffer, metrics, pluginLog.To(logger)),
+	}
+}
+
+// run serves HTTP, over HTTPS when tlsConfig is set, and gRPC, and consumes
+// the feed until ctx is done or one of them fails, re-reading refreshers
+// every -secret-refresh meanwhile. It then waits for all of them to stop and
+// writes out whatever has not been stored yet, for up to -drain-timeout, and
+// returns the failure.
+func (c *client) run(ctx context.Context, tlsConfig *tls.Config, refreshers ...secrets.Refresher) error {
+	// Everything below stops on the first failure as on a shutdown signal
+	g, ctx := errgroup.WithContext(ctx)
+
+	// The gRPC service, also served as REST+JSON under /v1/ by the gateway
+	feedService := newPriceFeedServer(ctx, c.st, c.cfg.StaleAfter, c.clock)
+	gateway, err := newGateway(ctx, g, feedService)
+	if err != nil {
+		return fmt.Errorf("starting the gRPC gateway: %w", err)
+	}
+	proxies, err := httpapi.NewProxyPolicy(c.cfg.TrustedProxies, c.cfg.BasePath)
+	if err != nil {
+		return fmt.Errorf("reverse proxy configuration: %w", err)
+	}
+	router := c.newRouter(httpapi.NewCORSPolicy(c.cfg.CORSOrigins, c.cfg.CORSMethods, c.cfg.CORSHeaders), proxies, gateway)
+
+	g.Go(func() error {
+		secrets.Watch(ctx, c.cfg.SecretRefresh, func(name string) { c.events.Record(eventReloaded, name, "") }, refreshers...)
+		return nil
+	})
+	if c.cfg.StatsInterval > 0 {
+		g.Go(func() error {
+			reportMetrics(ctx, c.statsLog, c.clock, c.metrics, c.feed, c.buffer, c.cfg.StatsInterval)
+			return nil
+		})
+	}
+	for _, work := range c.st.workers {
+		g.Go(func() error {
+			work(ctx)
+			return nil
+		})
+	}
+	if c.events != nil {
+		g.Go(func() error {
+			c.events.Run(ctx)
+			return nil
+		})
+	}
+	for _, plugin := range c.plugins {
+		g.Go(func() error {
+			plugin.Run(ctx)
+			return nil
+		})
+	}
+	g.Go(func() error { return c.serveHTTP(ctx, router, tlsConfig) })
+	if c.cfg.DebugAddr != "" {
+		c.log.Infof("Profiles served on %s/debug/pprof/, runtime stats on %s/debug/stats", c.cfg.DebugAddr, c.cfg.DebugAddr)
+		g.Go(func() error { return debug.Serve(ctx, c.cfg.DebugAddr) })
+	}
+	if c.cfg.GRPCAddr != "" {
+		g.Go(func() error { return c.startGRPCServer(ctx, feedService, tlsConfig) })
+	}
+
+	// Consume the feed, with failover and retry logic
+	g.Go(func() error {
+		c.feed.Run(ctx, newUpdateHandler(c.st, c.plugins, c.cfg.SkipUnchanged, c.clock, c.metrics, c.hooks, c.pipelineLog))
+		return nil
+	})
+
+	<-ctx.Done()
+	c.clientLog.Infof("Shutting down gracefully...")
+
+	// Wait for the TCP loop, the HTTP and gRPC servers, the store's writers
+	// and the event log to return, then write out whatever has not been
+	// stored yet
+	err = g.Wait()
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), c.cfg.DrainTimeout)
+	defer cancelDrain()
+	c.st.close(drainCtx)
+	return err
+}
+
+// serveHTTP serves handler on -http-addr, over HTTPS when tlsConfig is set.
+// Request contexts derive from ctx, so cancelling it ends every SSE and
+// WebSocket stream; the server is then shut down, letting requests in
+// flight finish for up to httpShutdownTimeout, and serveHTTP returns once
+// it is. It fails when the server cannot listen or stops on its own.
+func (c *client) serveHTTP(ctx context.Context, handler http.Handler, tlsConfig *tls.Config) error {
+	addr := c.cfg.HTTPAddr
+	server := &http.Server{
+		Addr:        addr,
+		Handler:     handler,
+		TLSConfig:   tlsConfig,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	shutdown := make(chan struct{})
+	stopShutdown := context.AfterFunc(ctx, func() {
+		defer close(shutdown)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			c.log.Errorf("Error shutting down the HTTP server, closing it: %v", err)
+			server.Close()
+		}
+	})
+	defer stopShutdown()
+
+	var err error
+	if tlsConfig != nil {
+		c.log.Infof("HTTPS server started on %s", addr)
+		// The certificate comes from TLSConfig, so no files are passed here
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		c.log.Infof("HTTP server started on %s", addr)
+		err = server.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		return fmt.Errorf("HTTP server: %w", err)
+	}
+	<-shutdown
+	return nil
+}
@@ -0,0 +1,115 @@
+package consume
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ifin/internal/feed"
+	"ifin/internal/feedtest"
+	"ifin/internal/httpapi"
+	"ifin/pkg/feedclient"
+	"ifin/pkg/keyspace"
+)
+
+// syncBuffer is a bytes.Buffer a logger can write to from any goroutine.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestClientRunsOnInjectedClockLoggerAndStore(t *testing.T) {
+	cfg, err := loadConfig([]string{"-store", storeMemory, "-http-addr", "127.0.0.1:0", "-stats-interval", "0", "-stale-after", "10s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The harness's fake clock stamps the updates and is the client's clock
+	h := feedtest.New(10)
+	defer h.Close()
+	group, err := feedclient.NewGroup(h.Options(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := openStore(ctx, cfg, h.Clock, nil, keyspace.Default, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs syncBuffer
+	c := newClient(cfg, slog.New(slog.NewTextHandler(&logs, nil)), h.Clock, st, group, nil, newClientMetrics(), nil)
+
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() { done <- c.run(runCtx, nil) }()
+	if err := h.Connected(ctx, 1); err != nil {
+		t.Fatalf("waiting for the client to connect: %v", err)
+	}
+
+	// Updates reach the injected store
+	published := h.Publish(feed.Update{ID: "a1", Symbol: "AAPL", Price: 190})
+	for {
+		update, ok, _ := st.GetLatest(ctx, "AAPL")
+		if ok && update.Seq == published.Seq {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("AAPL #%d never stored, latest %+v", published.Seq, update)
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+
+	// The API tells staleness by the injected clock
+	proxies, err := httpapi.NewProxyPolicy("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := c.newRouter(httpapi.NewCORSPolicy("", "", ""), proxies, http.NotFoundHandler())
+	stale := func() bool {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/prices", nil))
+		var views []httpapi.PriceView
+		if err := json.Unmarshal(rec.Body.Bytes(), &views); err != nil || len(views) != 1 {
+			t.Fatalf("/api/prices: %s (%v)", rec.Body, err)
+		}
+		return views[0].Stale
+	}
+	if stale() {
+		t.Error("AAPL stale as soon as it is stored")
+	}
+	h.Clock.Advance(11 * time.Second)
+	if !stale() {
+		t.Error("AAPL not stale 11s after it was generated")
+	}
+
+	stop()
+	if err := <-done; err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	// The component loggers write to the injected logger
+	if out := logs.String(); !strings.Contains(out, "HTTP server started on 127.0.0.1:0") || !strings.Contains(out, "component=http") {
+		t.Errorf("logged %q, want the HTTP server's start from the http component", out)
+	}
+}
@@ -0,0 +1,245 @@
+package consume
+
+import (
+	"errors"
+	"flag"
+	"strings"
+	"time"
+
+	"ifin/internal/cli"
+	"ifin/pkg/codec"
+	"ifin/pkg/compression"
+	"ifin/pkg/feedclient"
+	"ifin/pkg/keyspace"
+)
+
+// Default configuration
+const (
+	serverAddress  = "localhost:9501"
+	redisAddress   = "localhost:6379"
+	httpAddress    = ":8080"
+	reconnectDelay = 5 * time.Second // Initial delay; doubles on each failed attempt
+	secretRefresh  = 30 * time.Second
+)
+
+// envPrefix is prepended to the upper-cased flag name to form the environment
+// variable that can set it, e.g. -redis-addr becomes CLIENT_REDIS_ADDR.
+const envPrefix = "CLIENT_"
+
+// config holds everything the client can be told from the command line or
+// the environment.
+type config struct {
+	Servers          string
+	Network          string
+	Proxy            string
+	Symbols          string
+	GapRecovery      bool
+	FeedFormat       string
+	Connections      int
+	Failover         string
+	FailbackInterval time.Duration
+	ReconnectDelay   time.Duration
+	ReconnectMax     time.Duration
+	ReconnectStable  time.Duration
+	PingInterval     time.Duration
+	PingTimeout      time.Duration
+	MaxSilence       time.Duration
+	FeedTLS          bool
+	FeedCA           string
+	FeedCert         string
+	FeedKey          string
+	FeedServerName   string
+	FeedInsecure     bool
+
+	Store            string
+	BoltFile         string
+	SQLiteFile       string
+	SQLiteFlush      time.Duration
+	PostgresDSN      string
+	PostgresFlush    time.Duration
+	MemcachedServers string
+	RedisAddr        string
+	RedisCluster     string
+	RedisSentinels   string
+	RedisMaster      string
+	RedisHealth      time.Duration
+	RedisSlow        time.Duration
+	KeyPrefix        string
+	CacheLayout      string
+	BufferSize       int
+	BufferOverflow   string
+	BufferRetry      time.Duration
+	BatchWindow      time.Duration
+	DrainTimeout     time.Duration
+	PubSubChannel    string
+	StreamMaxLen     int64
+	HistoryRetention time.Duration
+	KeyTTL           time.Duration
+	StaleAfter       time.Duration
+	DeadLetterKey    string
+	DeadLetterMax    int64
+	DeadLetterFile   string
+	EventKey         string
+	EventMax         int64
+	EventFile        string
+	SkipUnchanged    bool
+	SinkPlugins      string
+	SinkBuffer       int
+	AtomicWrites     bool
+	KeyspaceEvents   bool
+	Compression      string
+	StoreFormat      string
+
+	HTTPAddr      string
+	TLSCert       string
+	TLSKey        string
+	AutocertHost  string
+	AutocertCache string
+	ACMEHTTPAddr  string
+	CORSOrigins   string
+	CORSMethods   string
+	CORSHeaders   string
+	DebugAddr     string
+
+	HTTPCompression bool
+	SSEPingInterval time.Duration
+	HTTPRate        float64
+	HTTPBurst       int
+	MaxStreams      int
+	TrustedProxies  string
+	BasePath        string
+	GRPCAddr        string
+
+	SecretRefresh time.Duration
+	StatsInterval time.Duration
+	Log           cli.LogFlags
+	OTLPEndpoint  string
+	TraceSample   float64
+
+	OTLPMetricsInterval time.Duration
+	SentryDSN           string
+}
+
+// loadConfig parses the flags in args and configures logging. Every flag
+// can also be set through its environment variable; the command line wins
+// when both are given.
+func loadConfig(args []string) (*config, error) {
+	cfg := &config{}
+	fs := flag.NewFlagSet("consume", flag.ExitOnError)
+
+	fs.StringVar(&cfg.Servers, "servers", serverAddress, "Comma-separated feed server addresses, primary first")
+	fs.StringVar(&cfg.Network, "network", "tcp", "Network of the feed servers: tcp, or unix for socket paths in -servers")
+	fs.StringVar(&cfg.Proxy, "proxy", "", "Reach the feed servers through this proxy, e.g. socks5://host:1080")
+	fs.StringVar(&cfg.Symbols, "symbols", "", "Comma-separated symbols to subscribe to (empty for all)")
+	fs.BoolVar(&cfg.GapRecovery, "gap-recovery", true, "Ask the server to replay updates missed while disconnected")
+	fs.StringVar(&cfg.FeedFormat, "feed-format", "json", "Format the server sends updates in: "+strings.Join(codec.Names(), ", ")+" (servers that cannot send it keep sending JSON)")
+	fs.IntVar(&cfg.Connections, "connections", 1, "Feed connections to read in parallel, each subscribed to a share of -symbols")
+	fs.StringVar(&cfg.Failover, "failover", feedclient.FailoverPriority, "How to pick the next server: priority (fail back to the primary) or round-robin")
+	fs.DurationVar(&cfg.FailbackInterval, "failback-interval", 30*time.Second, "How often the primary is probed while connected to a backup server")
+	fs.DurationVar(&cfg.ReconnectDelay, "reconnect-delay", reconnectDelay, "Delay before the first reconnect attempt; doubles on each failure")
+	fs.DurationVar(&cfg.ReconnectMax, "reconnect-max", time.Minute, "Upper bound on the delay between reconnect attempts")
+	fs.DurationVar(&cfg.ReconnectStable, "reconnect-stable", 30*time.Second, "Connection uptime after which the reconnect delay resets")
+	fs.DurationVar(&cfg.PingInterval, "ping-interval", 10*time.Second, "How often to ping the server (0 disables pings)")
+	fs.DurationVar(&cfg.PingTimeout, "ping-timeout", 5*time.Second, "How long to wait for a PONG before reconnecting")
+	fs.DurationVar(&cfg.MaxSilence, "max-silence", 30*time.Second, "Reconnect when nothing arrives from the server for this long (0 disables)")
+	fs.BoolVar(&cfg.FeedTLS, "feed-tls", false, "Connect to the feed servers over TLS")
+	fs.StringVar(&cfg.FeedCA, "feed-ca", "", "CA bundle used to verify the feed servers (default: system roots)")
+	fs.StringVar(&cfg.FeedCert, "feed-cert", "", "Client certificate presented to the feed servers")
+	fs.StringVar(&cfg.FeedKey, "feed-key", "", "Private key for -feed-cert")
+	fs.StringVar(&cfg.FeedServerName, "feed-server-name", "", "Server name to verify instead of the host in -servers")
+	fs.BoolVar(&cfg.FeedInsecure, "feed-insecure", false, "Skip verification of the feed server certificate (testing only)")
+
+	fs.StringVar(&cfg.Store, "store", storeRedis, "Where prices are stored: redis, memory (nothing persisted, for demos), bolt or sqlite (local files), postgres or memcached")
+	fs.StringVar(&cfg.BoltFile, "bolt-file", "prices.db", "BoltDB file used by -store bolt")
+	fs.StringVar(&cfg.SQLiteFile, "sqlite-file", "prices.sqlite", "SQLite database used by -store sqlite")
+	fs.DurationVar(&cfg.SQLiteFlush, "sqlite-flush", time.Second, "How often updates are written to SQLite, in one transaction")
+	fs.StringVar(&cfg.PostgresDSN, "postgres-dsn", "", "PostgreSQL/TimescaleDB connection string; every tick is written to its ticks table, alongside -store unless that is postgres")
+	fs.DurationVar(&cfg.PostgresFlush, "postgres-flush", time.Second, "How often ticks are inserted into PostgreSQL, in one batch")
+	fs.StringVar(&cfg.MemcachedServers, "memcached-servers", "localhost:11211", "Comma-separated memcached servers used by -store memcached")
+	fs.StringVar(&cfg.RedisAddr, "redis-addr", redisAddress, "Redis server address")
+	fs.StringVar(&cfg.RedisCluster, "redis-cluster", "", "Comma-separated Redis Cluster seed nodes; replaces -redis-addr when set")
+	fs.StringVar(&cfg.RedisSentinels, "redis-sentinels", "", "Comma-separated Sentinel addresses used to find the -redis-master; replaces -redis-addr when set")
+	fs.StringVar(&cfg.RedisMaster, "redis-master", "mymaster", "Name of the master monitored by -redis-sentinels")
+	fs.DurationVar(&cfg.RedisHealth, "redis-health-interval", 2*time.Second, "How often Redis is PINGed; while it is down writes are buffered without trying Redis (0 disables the checks)")
+	fs.DurationVar(&cfg.RedisSlow, "redis-slow", 100*time.Millisecond, "Log Redis commands and pipelines taking at least this long (0 disables)")
+	fs.StringVar(&cfg.KeyPrefix, "key-prefix", keyspace.DefaultPrefix, "Prefix of every Redis key and channel, so several clients can share one Redis")
+	fs.StringVar(&cfg.CacheLayout, "cache-layout", layoutHash, "How latest prices are stored: hash (one <prefix>.data hash) or keys (a <prefix>.data.<SYMBOL> key each)")
+	fs.IntVar(&cfg.BufferSize, "buffer-size", 10000, "Maximum cache writes held in memory while Redis is unavailable")
+	fs.StringVar(&cfg.BufferOverflow, "buffer-overflow", overflowDropOldest, "What to discard when the buffer is full: drop-oldest or drop-newest")
+	fs.DurationVar(&cfg.BufferRetry, "buffer-retry", time.Second, "How often buffered writes are retried")
+	fs.DurationVar(&cfg.BatchWindow, "batch-window", 50*time.Millisecond, "Write-behind window: cache writes are coalesced per symbol for this long, then sent in one Redis pipeline off the read loop (0 writes each update inline)")
+	fs.DurationVar(&cfg.DrainTimeout, "drain-timeout", 5*time.Second, "How long pending cache writes may take to reach Redis on shutdown")
+	fs.StringVar(&cfg.PubSubChannel, "pubsub-channel", "updates", "Redis channel, under -key-prefix, updates are published on and /sse listens to (empty to poll Redis every second instead)")
+	fs.Int64Var(&cfg.StreamMaxLen, "stream-maxlen", 10000, "Approximate number of updates kept in each symbol's history stream (0 disables the streams)")
+	fs.DurationVar(&cfg.HistoryRetention, "history-retention", time.Hour, "How long each symbol's price history is kept for /history queries, by every store (0 disables it)")
+	fs.DurationVar(&cfg.KeyTTL, "key-ttl", 0, "Expiry of each symbol's latest price, so dead symbols disappear; the hash layout needs Redis 7.4+ (0 keeps them forever)")
+	fs.DurationVar(&cfg.StaleAfter, "stale-after", 30*time.Second, "Mark prices older than this as stale in /sse output (0 disables)")
+	fs.StringVar(&cfg.DeadLetterKey, "dead-letter-key", "deadletter", "Redis list, under -key-prefix, that keeps lines which could not be decoded")
+	fs.Int64Var(&cfg.DeadLetterMax, "dead-letter-max", 1000, "Maximum entries kept in the dead-letter list")
+	fs.StringVar(&cfg.DeadLetterFile, "dead-letter-file", "", "Append undecodable lines to this file instead of Redis")
+	fs.StringVar(&cfg.EventKey, "event-key", "events", "Redis stream, under -key-prefix, that keeps connection, Redis and reload events for /events")
+	fs.Int64Var(&cfg.EventMax, "event-max", 10000, "Approximate number of entries kept in the event stream")
+	fs.StringVar(&cfg.EventFile, "event-file", "", "Append connection, Redis and reload events to this file instead of Redis")
+	fs.BoolVar(&cfg.AtomicWrites, "atomic-writes", false, "Store, add to the history and publish each update in one Lua script, so Redis and Pub/Sub never disagree")
+	fs.StringVar(&cfg.Compression, "compression", compression.None, "Compress prices and history stored in Redis: none, snappy or zstd (readers detect it, so it can be changed at any time)")
+	fs.StringVar(&cfg.StoreFormat, "store-format", "json", "Format of the prices and history stored in Redis: "+strings.Join(codec.Names(), ", ")+" (readers detect it, so it can be changed at any time)")
+	fs.BoolVar(&cfg.KeyspaceEvents, "keyspace-events", false, "Push to /sse every latest price written to Redis, by any client instance, using keyspace notifications instead of -pubsub-channel")
+	fs.BoolVar(&cfg.SkipUnchanged, "skip-unchanged", false, "Skip writes and SSE events when a symbol's price has not changed")
+	fs.StringVar(&cfg.SinkPlugins, "sink-plugins", "", "Comma-separated commands, with space-separated arguments, run alongside the client and sent every update as a JSON line on their stdin")
+	fs.IntVar(&cfg.SinkBuffer, "sink-buffer", 1000, "Updates queued for each sink plugin; newer ones are dropped while it is that far behind")
+
+	fs.StringVar(&cfg.HTTPAddr, "http-addr", httpAddress, "Address the HTTP server listens on, e.g. 127.0.0.1:8080 to accept local connections only")
+	fs.StringVar(&cfg.TLSCert, "tls-cert", "", "TLS certificate file for the HTTP server (HTTPS is enabled when set together with -tls-key)")
+	fs.StringVar(&cfg.TLSKey, "tls-key", "", "TLS private key file for the HTTP server")
+	fs.StringVar(&cfg.AutocertHost, "autocert-host", "", "Obtain a Let's Encrypt certificate for this hostname instead of using -tls-cert")
+	fs.StringVar(&cfg.AutocertCache, "autocert-cache", "autocert-cache", "Directory where autocert stores certificates")
+	fs.StringVar(&cfg.ACMEHTTPAddr, "acme-http-addr", ":80", "Address answering ACME HTTP-01 challenges when -autocert-host is set")
+	fs.StringVar(&cfg.CORSOrigins, "cors-origins", "http://localhost:63342", "Comma-separated origins allowed to use the HTTP endpoints, or * for any")
+	fs.StringVar(&cfg.CORSMethods, "cors-methods", "GET, POST, OPTIONS", "Comma-separated methods allowed in CORS requests")
+	fs.StringVar(&cfg.CORSHeaders, "cors-headers", "Content-Type,Last-Event-ID", "Comma-separated request headers allowed in CORS requests")
+	fs.BoolVar(&cfg.HTTPCompression, "http-compression", true, "Compress HTTP responses, SSE streams included, with brotli or gzip when the client accepts it")
+	fs.DurationVar(&cfg.SSEPingInterval, "sse-ping-interval", 15*time.Second, "Send a comment on /sse after this long without data, so proxies keep idle streams open (0 disables)")
+	fs.Float64Var(&cfg.HTTPRate, "http-rate", 20, "HTTP requests per second allowed from each client IP, answered with 429 beyond (0 disables the limit)")
+	fs.IntVar(&cfg.HTTPBurst, "http-burst", 40, "HTTP requests a client IP may make at once before -http-rate applies")
+	fs.IntVar(&cfg.MaxStreams, "max-streams", 1000, "Most SSE, WebSocket and /v1/ticks streams open at once, answered with 503 beyond (0 for no limit)")
+	fs.StringVar(&cfg.TrustedProxies, "trusted-proxies", "", "Comma-separated addresses or CIDR ranges of reverse proxies whose X-Forwarded-For, -Proto and -Host headers are honoured")
+	fs.StringVar(&cfg.BasePath, "base-path", "", "Path prefix the HTTP endpoints are served under when proxied, e.g. /prices")
+	fs.StringVar(&cfg.GRPCAddr, "grpc-addr", "", "Address serving the PriceFeed gRPC service (proto/feed/v1/feed.proto), e.g. :9090 (disabled when empty)")
+	fs.StringVar(&cfg.DebugAddr, "debug-addr", "", "Address serving pprof profiles under /debug/pprof/ and runtime stats on /debug/stats, e.g. localhost:6060 (disabled when empty)")
+
+	fs.DurationVar(&cfg.SecretRefresh, "secret-refresh", secretRefresh, "How often secrets and certificates are re-read (0 disables)")
+	fs.DurationVar(&cfg.StatsInterval, "stats-interval", 10*time.Second, "How often throughput and lag stats are logged and refreshed for /stats (0 disables)")
+	cfg.Log.Register(fs, "client, feed, pipeline, plugins, redis, store, sse, http, stats", "redis=warn,sse=debug")
+	fs.StringVar(&cfg.OTLPEndpoint, "otlp-endpoint", "", "host:port of an OTLP/gRPC collector receiving trace spans and metrics, e.g. localhost:4317 (both are disabled when empty)")
+	fs.Float64Var(&cfg.TraceSample, "trace-sample", 1, "Fraction of traces started here that are kept; ticks traced by the server follow its decision")
+	fs.DurationVar(&cfg.OTLPMetricsInterval, "otlp-metrics-interval", 15*time.Second, "How often the /metrics counters are pushed to -otlp-endpoint (0 disables metrics export)")
+	fs.StringVar(&cfg.SentryDSN, "sentry-dsn", "", "Report panics and Redis outages to this Sentry, or Sentry-compatible, DSN (disabled when empty)")
+
+	if err := cli.Parse(fs, envPrefix, args); err != nil {
+		return nil, err
+	}
+	if err := cfg.Log.Configure(); err != nil {
+		return nil, err
+	}
+	if cfg.BufferRetry <= 0 {
+		return nil, errors.New("-buffer-retry must be positive")
+	}
+	if cfg.SQLiteFlush <= 0 {
+		return nil, errors.New("-sqlite-flush must be positive")
+	}
+	if cfg.PostgresFlush <= 0 {
+		return nil, errors.New("-postgres-flush must be positive")
+	}
+	return cfg, nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,80 @@
+package consume
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// deadLetter is a feed line the client could not decode, kept so protocol
+// bugs can be diagnosed after the fact.
+type deadLetter struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+	Raw   string    `json:"raw"`
+}
+
+// deadLetterQueue stores dead letters in a file (as JSON lines) when one is
+// configured, otherwise in a Redis list capped at maxLen entries, newest
+// first. With neither (a storage-free client) they are only logged.
+type deadLetterQueue struct {
+	rdb    redis.UniversalClient
+	key    string
+	maxLen int64
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newDeadLetterQueue(rdb redis.UniversalClient, key string, maxLen int64, path string) (*deadLetterQueue, error) {
+	q := &deadLetterQueue{rdb: rdb, key: key, maxLen: maxLen}
+	if path != "" {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		q.file = file
+	}
+	return q, nil
+}
+
+// Add records one undecodable line.
+func (q *deadLetterQueue) Add(ctx context.Context, raw []byte, decodeErr error) error {
+	entry, err := json.Marshal(deadLetter{Time: time.Now(), Error: decodeErr.Error(), Raw: string(raw)})
+	if err != nil {
+		return err
+	}
+
+	if q.file != nil {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		_, err := q.file.Write(append(entry, '\n'))
+		return err
+	}
+	if q.rdb == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	_, err = q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, q.key, entry)
+		pipe.LTrim(ctx, q.key, 0, q.maxLen-1)
+		return nil
+	})
+	return err
+}
+
+// Close closes the file, if any.
+func (q *deadLetterQueue) Close() error {
+	if q.file == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.file.Close()
+}
@@ -0,0 +1,244 @@
+package consume
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"ifin/internal/httpapi"
+	"ifin/pkg/feedclient"
+)
+
+// opsEvent is one operational event: a feed connection change, Redis going
+// down or coming back, or a secret or certificate being reloaded.
+type opsEvent struct {
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"`
+	Target string    `json:"target,omitempty"` // Server, secret or file concerned
+	Detail string    `json:"detail,omitempty"` // Error, or delay before reconnecting
+}
+
+// Kinds of event besides the feedclient.Event* ones
+const (
+	eventRedisDown = "redis_down"
+	eventRedisUp   = "redis_up"
+	eventReloaded  = "config_reloaded"
+)
+
+// Limits of /events
+const (
+	defaultEventLimit = 100
+	maxEventLimit     = 1000
+)
+
+// eventLog stores events in a file (as JSON lines) when one is configured,
+// otherwise in a Redis stream capped at about maxLen entries. With neither
+// (a storage-free client) nothing is kept. Events are written by Run, so
+// recording one never waits, not even on the Redis outage it reports; they
+// are dropped when the queue is full.
+type eventLog struct {
+	rdb    redis.UniversalClient
+	key    string
+	maxLen int64
+	path   string
+
+	queue chan opsEvent
+	file  *os.File // Written by Run only
+}
+
+func newEventLog(rdb redis.UniversalClient, key string, maxLen int64, path string) (*eventLog, error) {
+	l := &eventLog{rdb: rdb, key: key, maxLen: maxLen, path: path, queue: make(chan opsEvent, 100)}
+	if path != "" {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		l.file = file
+	}
+	return l, nil
+}
+
+// Record queues an event.
+func (l *eventLog) Record(kind, target, detail string) {
+	if l == nil {
+		return
+	}
+	select {
+	case l.queue <- opsEvent{Time: time.Now(), Kind: kind, Target: target, Detail: detail}:
+	default:
+		clientLog.Warnf("Event queue full, dropping %s event", kind)
+	}
+}
+
+// recordFeed records a change in a feed connection.
+func (l *eventLog) recordFeed(e feedclient.Event) {
+	var detail string
+	switch {
+	case e.Err != nil:
+		detail = e.Err.Error()
+	case e.Delay > 0:
+		detail = e.Delay.Round(time.Millisecond).String()
+	}
+	l.Record(e.Kind, e.Server, detail)
+}
+
+// Run writes queued events until ctx is done, then the ones still queued,
+// and closes the file.
+func (l *eventLog) Run(ctx context.Context) {
+	for {
+		select {
+		case e := <-l.queue:
+			l.write(e)
+		case <-ctx.Done():
+			for {
+				select {
+				case e := <-l.queue:
+					l.write(e)
+				default:
+					if l.file != nil {
+						l.file.Close()
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+func (l *eventLog) write(e opsEvent) {
+	entry, err := json.Marshal(e)
+	if err != nil {
+		clientLog.Errorf("Error recording event: %v", err)
+		return
+	}
+
+	if l.file != nil {
+		_, err = l.file.Write(append(entry, '\n'))
+	} else if l.rdb != nil {
+		// Not under Run's context, so the events of a shutdown are kept too
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		err = l.rdb.XAdd(ctx, &redis.XAddArgs{
+			Stream: l.key,
+			MaxLen: l.maxLen,
+			Approx: true,
+			Values: map[string]any{"event": entry},
+		}).Err()
+		cancel()
+	}
+	if err != nil {
+		clientLog.Errorf("Error recording %s event: %v", e.Kind, err)
+	}
+}
+
+// Query returns up to limit events, newest first, of the given kind (any
+// when empty) since the given time (any when zero).
+func (l *eventLog) Query(ctx context.Context, kind string, since time.Time, limit int) ([]opsEvent, error) {
+	match := func(e opsEvent) bool {
+		return (kind == "" || e.Kind == kind) && !e.Time.Before(since)
+	}
+	switch {
+	case l.path != "":
+		return l.queryFile(match, limit)
+	case l.rdb != nil:
+		return l.queryStream(ctx, match, since, limit)
+	}
+	return nil, nil
+}
+
+// queryFile scans the whole file, keeping the last limit matches.
+func (l *eventLog) queryFile(match func(opsEvent) bool, limit int) ([]opsEvent, error) {
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var found []opsEvent
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e opsEvent
+		if json.Unmarshal(scanner.Bytes(), &e) != nil || !match(e) {
+			continue // Skips a line cut short by a crash, too
+		}
+		found = append(found, e)
+		if len(found) > limit {
+			found = found[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	slices.Reverse(found)
+	return found, nil
+}
+
+// queryStream reads the stream backwards a page at a time until limit
+// events match or it reaches since.
+func (l *eventLog) queryStream(ctx context.Context, match func(opsEvent) bool, since time.Time, limit int) ([]opsEvent, error) {
+	start := "-"
+	if !since.IsZero() {
+		start = strconv.FormatInt(since.UnixMilli(), 10)
+	}
+	page := int64(max(limit, defaultEventLimit))
+
+	var found []opsEvent
+	end := "+"
+	for len(found) < limit {
+		messages, err := l.rdb.XRevRangeN(ctx, l.key, end, start, page).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, message := range messages {
+			var e opsEvent
+			raw, _ := message.Values["event"].(string)
+			if json.Unmarshal([]byte(raw), &e) == nil && match(e) && len(found) < limit {
+				found = append(found, e)
+			}
+		}
+		if int64(len(messages)) < page {
+			break
+		}
+		end = "(" + messages[len(messages)-1].ID
+	}
+	return found, nil
+}
+
+// eventsHandler serves the events recorded in events, newest first,
+// optionally filtered by kind and since (Unix milliseconds or RFC 3339).
+func eventsHandler(events *eventLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		since, err := httpapi.ParseTime(query.Get("since"))
+		if err != nil {
+			http.Error(w, "invalid since: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		limit := defaultEventLimit
+		if value := query.Get("limit"); value != "" {
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > maxEventLimit {
+				http.Error(w, "limit must be between 1 and "+strconv.Itoa(maxEventLimit), http.StatusBadRequest)
+				return
+			}
+		}
+
+		found, err := events.Query(r.Context(), query.Get("kind"), since, limit)
+		if err != nil {
+			httpLog.Errorf("Error querying events: %v", err)
+			http.Error(w, "events unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if found == nil {
+			found = []opsEvent{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(found)
+	}
+}
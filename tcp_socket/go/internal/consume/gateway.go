@@ -0,0 +1,42 @@
+package consume
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"ifin/pkg/feedpb"
+)
+
+// newGateway returns the PriceFeed service as REST+JSON, translated by
+// grpc-gateway along the routes in proto/feed/v1/feed_gateway.yaml:
+// /v1/prices, /v1/history/{symbol} and /v1/ticks, which streams
+// newline-delimited JSON. Each request becomes a call to a plaintext gRPC
+// server on a loopback port running service, the same handlers as
+// -grpc-addr, so both APIs always agree. The server runs in g until ctx is
+// done.
+func newGateway(ctx context.Context, g *errgroup.Group, service *priceFeedServer) (http.Handler, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	server := grpc.NewServer()
+	feedpb.RegisterPriceFeedServer(server, service)
+	g.Go(func() error { return serveGRPC(ctx, server, listener) })
+
+	// Field names as in the proto, with zero values, like /api/prices
+	mux := runtime.NewServeMux(runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+		MarshalOptions: protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true},
+	}))
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if err := feedpb.RegisterPriceFeedHandlerFromEndpoint(ctx, mux, listener.Addr().String(), opts); err != nil {
+		return nil, err
+	}
+	return mux, nil
+}
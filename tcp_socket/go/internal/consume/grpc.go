@@ -0,0 +1,177 @@
+package consume
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	"ifin/internal/clock"
+	"ifin/internal/httpapi"
+	"ifin/pkg/feedpb"
+	"ifin/pkg/store"
+)
+
+// priceFeedServer implements the PriceFeed gRPC service on top of the store,
+// with the same semantics as /api/prices, /api/history and /ws.
+type priceFeedServer struct {
+	feedpb.UnimplementedPriceFeedServer
+	st         store.Store
+	staleAfter time.Duration
+	clock      clock.Clock     // Tells which prices are stale
+	shutdown   <-chan struct{} // Closed on shutdown, ending every StreamTicks
+}
+
+// toPrice converts an update to its protobuf message.
+func toPrice(view httpapi.PriceView) *feedpb.Price {
+	return &feedpb.Price{
+		Symbol: view.Symbol,
+		Price:  view.Price,
+		Ts:     view.Timestamp,
+		Seq:    view.Seq,
+		Stale:  view.Stale,
+	}
+}
+
+// toPrices converts updates, flagging the stale ones.
+func (s *priceFeedServer) toPrices(updates []StockUpdate) []*feedpb.Price {
+	views := httpapi.MarkStale(updates, s.staleAfter, s.clock.Now())
+	prices := make([]*feedpb.Price, len(views))
+	for i, view := range views {
+		prices[i] = toPrice(view)
+	}
+	return prices
+}
+
+// requestFilter limits a request to symbols, or allows every symbol when
+// none are given.
+func requestFilter(symbols []string) httpapi.SymbolFilter {
+	if len(symbols) == 0 {
+		return nil
+	}
+	return httpapi.NewSymbolFilter(symbols)
+}
+
+func (s *priceFeedServer) GetLatest(ctx context.Context, req *feedpb.GetLatestRequest) (*feedpb.GetLatestResponse, error) {
+	latest, err := s.st.GetAll(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, "prices unavailable")
+	}
+	latest = requestFilter(req.GetSymbols()).Apply(latest)
+	return &feedpb.GetLatestResponse{Prices: s.toPrices(latest)}, nil
+}
+
+func (s *priceFeedServer) GetHistory(ctx context.Context, req *feedpb.GetHistoryRequest) (*feedpb.GetHistoryResponse, error) {
+	if req.GetSymbol() == "" {
+		return nil, status.Error(codes.InvalidArgument, "symbol is required")
+	}
+	limit := int(req.GetLimit())
+	if limit == 0 {
+		limit = httpapi.DefaultHistoryLimit
+	}
+	if limit < 1 || limit > httpapi.MaxHistoryLimit {
+		return nil, status.Errorf(codes.InvalidArgument, "limit must be between 1 and %d", httpapi.MaxHistoryLimit)
+	}
+
+	var from, to time.Time
+	if req.GetFrom() != 0 {
+		from = time.UnixMilli(req.GetFrom())
+	}
+	if req.GetTo() != 0 {
+		to = time.UnixMilli(req.GetTo())
+	}
+	updates, err := s.st.History(ctx, req.GetSymbol(), from, to)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, "history unavailable")
+	}
+
+	resp := &feedpb.GetHistoryResponse{}
+	if len(updates) > limit {
+		resp.Next = updates[limit].Timestamp
+		updates = updates[:limit]
+	}
+	resp.Prices = s.toPrices(updates)
+	return resp, nil
+}
+
+func (s *priceFeedServer) StreamTicks(req *feedpb.StreamTicksRequest, stream grpc.ServerStreamingServer[feedpb.Price]) error {
+	ctx := stream.Context()
+	filter := requestFilter(req.GetSymbols())
+
+	updates, err := s.st.Subscribe(ctx)
+	if err != nil {
+		return status.Error(codes.Unavailable, "updates unavailable")
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.shutdown:
+			return status.Error(codes.Unavailable, "server shutting down")
+		case update, ok := <-updates:
+			if !ok {
+				return ctx.Err()
+			}
+			if !filter.Allows(update.Symbol) {
+				continue
+			}
+			if err := stream.Send(s.toPrices([]StockUpdate{update})[0]); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// newPriceFeedServer returns the PriceFeed service on top of st, telling
+// staleness by clk and ending its streams when ctx is done.
+func newPriceFeedServer(ctx context.Context, st store.Store, staleAfter time.Duration, clk clock.Clock) *priceFeedServer {
+	return &priceFeedServer{st: st, staleAfter: staleAfter, clock: clk, shutdown: ctx.Done()}
+}
+
+// startGRPCServer serves the PriceFeed service on -grpc-addr, over TLS when
+// tlsConfig is set, until ctx is cancelled, and returns once calls in
+// flight have finished. It fails when the server cannot listen or stops on
+// its own.
+func (c *client) startGRPCServer(ctx context.Context, service *priceFeedServer, tlsConfig *tls.Config) error {
+	addr := c.cfg.GRPCAddr
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("gRPC server: %w", err)
+	}
+
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	server := grpc.NewServer(opts...)
+	feedpb.RegisterPriceFeedServer(server, service)
+	reflection.Register(server) // For grpcurl and similar tools
+
+	c.log.Infof("gRPC server started on %s", addr)
+	return serveGRPC(ctx, server, listener)
+}
+
+// serveGRPC runs server on listener until ctx is cancelled, then stops it
+// gracefully. StreamTicks returns on shutdown, so that does not wait on
+// open streams.
+func serveGRPC(ctx context.Context, server *grpc.Server, listener net.Listener) error {
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+
+	if err := server.Serve(listener); err != nil {
+		return fmt.Errorf("gRPC server: %w", err)
+	}
+	<-stopped
+	return nil
+}
@@ -0,0 +1,208 @@
+package consume
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"ifin/internal/clock"
+	"ifin/internal/errreport"
+	"ifin/pkg/feedclient"
+)
+
+// redisHealth PINGs Redis periodically and acts as a circuit breaker around
+// it: once a PING or a write fails the breaker opens, writes go straight to
+// the retry buffer and reads are served from the in-memory copy, until a
+// PING succeeds again. A nil *redisHealth means no checks: Redis is always
+// tried.
+type redisHealth struct {
+	rdb      redis.UniversalClient
+	interval time.Duration
+	events   *eventLog   // Where outages are recorded; nil records nothing
+	clock    clock.Clock // Times the PINGs and the state changes
+
+	mu      sync.RWMutex
+	up      bool
+	since   time.Time // When up last changed
+	checked time.Time // Time of the last PING
+	lastErr error     // Why Redis is down
+}
+
+func newRedisHealth(rdb redis.UniversalClient, interval time.Duration, events *eventLog, clk clock.Clock) *redisHealth {
+	return &redisHealth{rdb: rdb, interval: interval, events: events, clock: clk, up: true, since: clk.Now()}
+}
+
+// Available reports whether Redis should be used, i.e. the breaker is closed.
+func (h *redisHealth) Available() bool {
+	if h == nil {
+		return true
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.up
+}
+
+// fail opens the breaker, logging only when it was closed. It reports
+// whether err was logged.
+func (h *redisHealth) fail(err error) bool {
+	if h == nil {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastErr = err
+	if h.up {
+		h.up = false
+		h.since = h.clock.Now()
+		redisLog.Errorf("Redis unavailable, buffering writes and serving in-memory prices: %v", err)
+		h.events.Record(eventRedisDown, "", err.Error())
+		errreport.Report(fmt.Errorf("redis unavailable: %w", err), map[string]string{"component": "redis"})
+	}
+	return true
+}
+
+// recover closes the breaker.
+func (h *redisHealth) recover() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastErr = nil
+	if !h.up {
+		h.up = true
+		h.since = h.clock.Now()
+		redisLog.Infof("Redis is reachable again")
+		h.events.Record(eventRedisUp, "", "")
+	}
+}
+
+// Run PINGs Redis every interval until ctx is done.
+func (h *redisHealth) Run(ctx context.Context) {
+	ticker := h.clock.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, h.interval)
+		err := h.rdb.Ping(pingCtx).Err()
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		h.mu.Lock()
+		h.checked = h.clock.Now()
+		h.mu.Unlock()
+		if err != nil {
+			h.fail(err)
+		} else {
+			h.recover()
+		}
+	}
+}
+
+// redisStatus is the health of Redis as served by /health.
+type redisStatus struct {
+	Status  string    `json:"status"` // up, down, or unchecked when there are no checks
+	Since   time.Time `json:"since,omitzero"`
+	Checked time.Time `json:"checked,omitzero"`
+	Error   string    `json:"error,omitempty"`
+}
+
+func (h *redisHealth) Status() redisStatus {
+	if h == nil {
+		return redisStatus{Status: "unchecked"}
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	s := redisStatus{Status: "up", Since: h.since, Checked: h.checked}
+	if !h.up {
+		s.Status = "down"
+		s.Error = h.lastErr.Error()
+	}
+	return s
+}
+
+// healthHandler serves the health of Redis as JSON, with status 503 while
+// the breaker is open.
+func healthHandler(h *redisHealth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := h.Status()
+		w.Header().Set("Content-Type", "application/json")
+		if status.Status == "down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(map[string]redisStatus{"redis": status})
+	}
+}
+
+// readyTimeout bounds the Redis PING of a readiness check
+const readyTimeout = time.Second
+
+// dependencyStatus is the state of one dependency as served by /readyz.
+type dependencyStatus struct {
+	Status      string `json:"status"`                // up or down
+	Connections int    `json:"connections,omitempty"` // Feed only
+	Error       string `json:"error,omitempty"`
+}
+
+// livenessHandler serves /healthz, which only shows the process is serving
+// HTTP.
+func livenessHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "alive"})
+}
+
+// readinessHandler serves /readyz: ready, with status 200, while at least
+// one feed connection is up and Redis, when prices are stored there, is
+// reachable, and 503 otherwise. Each dependency's status is in checks.
+// Redis is judged by the circuit breaker when -redis-health is set, and by
+// a PING otherwise.
+func readinessHandler(feed *feedclient.Group, st *storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		checks := make(map[string]dependencyStatus)
+		ready := true
+
+		feedStatus := dependencyStatus{Status: "up", Connections: feed.Connected()}
+		if feedStatus.Connections == 0 {
+			feedStatus.Status = "down"
+			ready = false
+		}
+		checks["feed"] = feedStatus
+
+		switch {
+		case st.health != nil:
+			status := st.health.Status()
+			checks["redis"] = dependencyStatus{Status: status.Status, Error: status.Error}
+			ready = ready && status.Status == "up"
+		case st.ping != nil:
+			ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+			err := st.ping(ctx)
+			cancel()
+			if err != nil {
+				checks["redis"] = dependencyStatus{Status: "down", Error: err.Error()}
+				ready = false
+			} else {
+				checks["redis"] = dependencyStatus{Status: "up"}
+			}
+		}
+
+		status := "ready"
+		w.Header().Set("Content-Type", "application/json")
+		if !ready {
+			status = "not ready"
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(struct {
+			Status string                      `json:"status"`
+			Checks map[string]dependencyStatus `json:"checks"`
+		}{status, checks})
+	}
+}
@@ -0,0 +1,74 @@
+package consume
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"ifin/pkg/pricestream"
+)
+
+// historyWriter is satisfied by both redis.UniversalClient and redis.Pipeliner.
+type historyWriter interface {
+	XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd
+	ZAdd(ctx context.Context, key string, members ...redis.Z) *redis.IntCmd
+	ZRemRangeByScore(ctx context.Context, key, min, max string) *redis.IntCmd
+}
+
+// historyEntry is an update waiting to be added to the history.
+type historyEntry struct {
+	update  StockUpdate
+	message string
+}
+
+// keepsHistory reports whether updates are recorded beyond the latest price.
+func (c *priceCache) keepsHistory() bool {
+	return c.streamMaxLen > 0 || c.historyRetention > 0
+}
+
+// recordHistory appends an update to the symbol's stream and sorted set
+// (scored by timestamp), as
+// configured, trimming the sorted set to the retention period. Errors are
+// reported through the commands (or the pipeline's Exec).
+func (c *priceCache) recordHistory(ctx context.Context, w historyWriter, update StockUpdate, message string) {
+	value := c.encode(message)
+	if c.streamMaxLen > 0 {
+		pricestream.Add(ctx, w, c.keys, update.Symbol, value, c.streamMaxLen)
+	}
+	if c.historyRetention > 0 && update.Timestamp != 0 {
+		key := c.keys.History(update.Symbol)
+		w.ZAdd(ctx, key, redis.Z{Score: float64(update.Timestamp), Member: value})
+		cutoff := time.UnixMilli(update.Timestamp).Add(-c.historyRetention).UnixMilli()
+		w.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(cutoff, 10))
+	}
+}
+
+// History returns symbol's updates from its sorted set, which holds them for
+// the retention period.
+func (c *priceCache) History(ctx context.Context, symbol string, from, to time.Time) ([]StockUpdate, error) {
+	members, err := c.rdb.ZRangeByScore(ctx, c.keys.History(symbol), &redis.ZRangeBy{
+		Min: scoreBound(from, "-inf"),
+		Max: scoreBound(to, "+inf"),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	updates := make([]StockUpdate, 0, len(members))
+	for _, member := range members {
+		var update StockUpdate
+		if unmarshalStored(member, &update) == nil {
+			updates = append(updates, update)
+		}
+	}
+	return updates, nil
+}
+
+// scoreBound turns t into a sorted-set score bound, unset when t is zero.
+func scoreBound(t time.Time, unset string) string {
+	if t.IsZero() {
+		return unset
+	}
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
@@ -0,0 +1,53 @@
+package consume
+
+import (
+	"context"
+	"fmt"
+
+	"ifin/internal/hooks"
+	"ifin/pkg/feedclient"
+)
+
+// clientHooks run user code in the client's update pipeline. Hooks are
+// registered with registerHooks from an init function in a file of their
+// own added to this package, so enrichment, filtering or auditing need no
+// change to the rest of it. Returning hooks.Skip drops an update quietly;
+// other errors are logged and counted as handler errors.
+type clientHooks struct {
+	OnReceive   hooks.Chain[StockUpdate] // Every update decoded from the feed, first thing
+	BeforeStore hooks.Chain[StockUpdate] // Every update about to be stored, after the other steps kept it
+}
+
+// hookSetups are the functions passed to registerHooks
+var hookSetups []func(*clientHooks)
+
+// registerHooks has setup add hooks to the client's pipeline. Call it from
+// init functions only.
+func registerHooks(setup func(*clientHooks)) {
+	hookSetups = append(hookSetups, setup)
+}
+
+// registeredHooks returns the hooks added by the registered setups.
+func registeredHooks() clientHooks {
+	var h clientHooks
+	for _, setup := range hookSetups {
+		setup(&h)
+	}
+	return h
+}
+
+// runHooks returns middleware running chain on every update and passing on
+// those it keeps.
+func runHooks(chain hooks.Chain[StockUpdate]) feedclient.Middleware {
+	return func(next feedclient.Handler) feedclient.Handler {
+		return func(ctx context.Context, update StockUpdate) error {
+			if err := chain.Run(ctx, &update); err != nil {
+				if err == hooks.Skip {
+					return nil
+				}
+				return fmt.Errorf("dropped by a hook: %w", err)
+			}
+			return next(ctx, update)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package consume
+
+import (
+	"fmt"
+
+	"ifin/internal/logging"
+)
+
+// Loggers of the client's components, whose levels are set by -log-level
+// and overridden by -log-components.
+var (
+	clientLog   = logging.New("client", printLine)   // Startup, shutdown and the event log
+	feedLog     = logging.New("feed", printLine)     // Connections to the price servers
+	pipelineLog = logging.New("pipeline", printLine) // A line per update skipped
+	pluginLog   = logging.New("plugins", printLine)  // Sink plugins starting
+	redisLog    = logging.New("redis", printLine)    // A line per update cached, and outages
+	storeLog    = logging.New("store", printLine)    // SQLite and PostgreSQL writes, and the archive
+	httpLog     = logging.New("http", printLine)     // HTTP and gRPC servers; see also httpapi
+	statsLog    = logging.New("stats", printLine)    // The periodic stats line
+)
+
+// printLine prints a log line to stdout.
+func printLine(format string, args ...any) {
+	fmt.Printf(format+"\n", args...)
+}
@@ -0,0 +1,208 @@
+// Package consume is the feed client run by "stockfeed consume": it reads
+// the feed into the configured store and serves the prices over HTTP, and
+// gRPC when configured.
+package consume
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/redis/go-redis/v9"
+
+	"ifin/internal/clock"
+	"ifin/internal/errreport"
+	"ifin/internal/healthcheck"
+	"ifin/internal/otlpmetrics"
+	"ifin/internal/secrets"
+	"ifin/internal/tracing"
+	"ifin/pkg/feedclient"
+)
+
+// StockUpdate represents the structure of the stock update message
+type StockUpdate = feedclient.Update
+
+// Healthcheck runs "stockfeed healthcheck consume": it probes the client
+// the same args and environment configure, instead of running one.
+func Healthcheck(args []string) {
+	cfg, err := loadConfig(args)
+	if err != nil {
+		clientLog.Errorf("Error in configuration: %v", err)
+		os.Exit(2)
+	}
+	secure := cfg.TLSCert != "" && cfg.TLSKey != "" || cfg.AutocertHost != ""
+	healthcheck.Exit(healthcheck.HTTP(cfg.HTTPAddr, "/healthz", secure))
+}
+
+// Main runs "stockfeed consume": it consumes the feed into the store and
+// serves it over HTTP, as args and the environment configure, until SIGINT
+// or SIGTERM. It exits with status 1 when the client stops on an error.
+func Main(args []string) {
+	if code := run(args); code != 0 {
+		os.Exit(code)
+	}
+}
+
+// run runs the client for Main and returns the status to exit with, once
+// everything it opened is closed.
+func run(args []string) int {
+	cfg, err := loadConfig(args)
+	if err != nil {
+		clientLog.Errorf("Error in configuration: %v", err)
+		return 2
+	}
+
+	// The root context is cancelled on SIGINT/SIGTERM and stops every goroutine
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.OTLPEndpoint, "feed-client", cfg.TraceSample)
+	if err != nil {
+		clientLog.Errorf("Error setting up tracing: %v", err)
+		return 1
+	}
+
+	if cfg.SentryDSN != "" {
+		reporter, err := errreport.NewSentry(cfg.SentryDSN, "feed-client")
+		if err != nil {
+			clientLog.Errorf("Error setting up error reporting: %v", err)
+			return 1
+		}
+		errreport.Use(reporter)
+	}
+
+	// Load credentials from REDIS_PASSWORD / FEED_AUTH_TOKEN or their *_FILE variants
+	redisPassword, err := secrets.FromEnv("REDIS_PASSWORD")
+	if err != nil {
+		clientLog.Errorf("Error loading Redis password: %v", err)
+		return 1
+	}
+	feedToken, err := secrets.FromEnv("FEED_AUTH_TOKEN")
+	if err != nil {
+		clientLog.Errorf("Error loading feed token: %v", err)
+		return 1
+	}
+	refreshers := []secrets.Refresher{redisPassword, feedToken}
+
+	tlsConfig, certRefreshers, err := httpTLSConfig(cfg.TLSCert, cfg.TLSKey, cfg.AutocertHost, cfg.AutocertCache, cfg.ACMEHTTPAddr)
+	if err != nil {
+		clientLog.Errorf("Error loading TLS certificate: %v", err)
+		return 1
+	}
+	refreshers = append(refreshers, certRefreshers...)
+
+	feedTLS, feedRefreshers, err := feedTLSConfig(cfg.FeedTLS, cfg.FeedCA, cfg.FeedCert, cfg.FeedKey, cfg.FeedServerName, cfg.FeedInsecure)
+	if err != nil {
+		clientLog.Errorf("Error loading feed TLS configuration: %v", err)
+		return 1
+	}
+	refreshers = append(refreshers, feedRefreshers...)
+
+	dialer, err := feedDialer(cfg.Network, cfg.Proxy)
+	if err != nil {
+		clientLog.Errorf("Error in proxy configuration: %v", err)
+		return 1
+	}
+
+	// Shared by Redis, the store, the update pipeline and the HTTP API
+	metrics := newClientMetrics()
+
+	// Connect to Redis, unless prices are stored elsewhere
+	var rdb redis.UniversalClient
+	if cfg.Store == storeRedis {
+		rdb, err = newRedisClient(cfg, redisPassword, metrics)
+		if err != nil {
+			clientLog.Errorf("Error in Redis configuration: %v", err)
+			return 1
+		}
+	}
+
+	keys := redisNamespace(rdb, cfg.KeyPrefix)
+
+	// Lines that fail to decode are kept for later diagnosis
+	deadLetters, err := newDeadLetterQueue(rdb, keys.Key(cfg.DeadLetterKey), cfg.DeadLetterMax, cfg.DeadLetterFile)
+	if err != nil {
+		clientLog.Errorf("Error opening dead-letter file: %v", err)
+		return 1
+	}
+	defer deadLetters.Close()
+
+	// Connection changes, Redis outages and reloads are kept for /events
+	events, err := newEventLog(rdb, keys.Key(cfg.EventKey), cfg.EventMax, cfg.EventFile)
+	if err != nil {
+		clientLog.Errorf("Error opening event file: %v", err)
+		return 1
+	}
+
+	feed, err := feedclient.NewGroup(feedclient.Options{
+		Servers:          strings.Split(cfg.Servers, ","),
+		Failover:         cfg.Failover,
+		FailbackInterval: cfg.FailbackInterval,
+		ReconnectDelay:   cfg.ReconnectDelay,
+		ReconnectMax:     cfg.ReconnectMax,
+		ReconnectStable:  cfg.ReconnectStable,
+		PingInterval:     cfg.PingInterval,
+		PingTimeout:      cfg.PingTimeout,
+		MaxSilence:       cfg.MaxSilence,
+		Network:          cfg.Network,
+		Dialer:           dialer,
+		TLS:              feedTLS,
+		Token:            feedToken.Value,
+		Symbols:          splitList(cfg.Symbols),
+		GapRecovery:      cfg.GapRecovery,
+		Format:           cfg.FeedFormat,
+		OnDecodeError: func(raw []byte, err error) {
+			feedLog.Errorf("Error unmarshaling message: %v", err)
+			if err := deadLetters.Add(ctx, raw, err); err != nil {
+				feedLog.Errorf("Error storing dead letter: %v", err)
+			}
+		},
+		OnEvent: events.recordFeed,
+		Logf:    feedLog.Infof,
+		Debugf: func(format string, args ...any) {
+			feedLog.Eventf("", format, args...) // A line per message
+		},
+	}, cfg.Connections)
+	if err != nil {
+		clientLog.Errorf("Error in server configuration: %v", err)
+		return 1
+	}
+
+	buffer, err := newRetryBuffer(cfg.BufferSize, cfg.BufferOverflow)
+	if err != nil {
+		clientLog.Errorf("Error in buffer configuration: %v", err)
+		return 1
+	}
+	st, err := openStore(ctx, cfg, clock.Real, rdb, keys, buffer, metrics, events)
+	if err != nil {
+		clientLog.Errorf("Error opening store: %v", err)
+		return 1
+	}
+
+	shutdownMetrics, err := otlpmetrics.Start(ctx, cfg.OTLPEndpoint, "feed-client", cfg.OTLPMetricsInterval, metricsWriter(feed, buffer, metrics))
+	if err != nil {
+		clientLog.Errorf("Error setting up metrics export: %v", err)
+		return 1
+	}
+
+	// A failure stops the client like a signal, but exits with status 1
+	runErr := newClient(cfg, nil, clock.Real, st, feed, buffer, metrics, events).run(ctx, tlsConfig, refreshers...)
+	if runErr != nil {
+		clientLog.Errorf("Client stopped on error: %v", runErr)
+	}
+	if rdb != nil {
+		rdb.Close()
+	}
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), cfg.DrainTimeout)
+	shutdownTracing(flushCtx)
+	shutdownMetrics(flushCtx)
+	cancelFlush()
+	errreport.Flush(cfg.DrainTimeout)
+	clientLog.Infof("Shutdown complete.")
+	if runErr != nil {
+		return 1
+	}
+	return 0
+}
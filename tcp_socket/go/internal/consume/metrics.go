@@ -0,0 +1,256 @@
+package consume
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ifin/internal/clock"
+	"ifin/internal/httpapi"
+	"ifin/internal/latency"
+	"ifin/internal/logging"
+	"ifin/internal/promtext"
+	"ifin/pkg/feedclient"
+)
+
+// clientMetrics measures how long received updates take to arrive and to be
+// stored; receive counters come from the feed client. All fields are updated
+// atomically from the read loop.
+type clientMetrics struct {
+	redisWrites     atomic.Uint64
+	redisWriteNanos atomic.Uint64 // Sum of SET (or batch) latencies
+	redisWriteMax   atomic.Int64  // Slowest SET seen, nanoseconds
+
+	lagSamples atomic.Uint64
+	lagMillis  atomic.Int64 // Sum of (receive time - server timestamp)
+	lagMax     atomic.Int64 // Largest lag seen, milliseconds
+
+	skipped   atomic.Uint64 // Updates dropped because the price had not changed
+	coalesced atomic.Uint64 // Batched writes replaced by a newer one before the flush
+
+	pluginDropped atomic.Uint64 // Updates not sent to a sink plugin because its queue was full
+
+	api *httpapi.Metrics // The HTTP API's streams and refused requests
+
+	redisMu       sync.Mutex
+	redisCommands map[string]*latency.Histogram // Command name -> latency of every call
+
+	mu   sync.Mutex
+	last metricsReport // Most recent report, served by /stats
+}
+
+// metricsReport is a point-in-time view of the counters plus rates computed
+// over the last reporting interval.
+type metricsReport struct {
+	Time           time.Time   `json:"time"`
+	Messages       uint64      `json:"messages_total"`
+	MessagesPerSec float64     `json:"messages_per_sec"`
+	Bytes          uint64      `json:"bytes_total"`
+	BytesPerSec    float64     `json:"bytes_per_sec"`
+	ParseErrors    uint64      `json:"parse_errors_total"`
+	RedisWrites    uint64      `json:"redis_writes_total"`
+	RedisWriteAvg  float64     `json:"redis_write_avg_ms"`
+	RedisWriteMax  float64     `json:"redis_write_max_ms"`
+	LagAvg         float64     `json:"lag_avg_ms"`
+	LagMax         int64       `json:"lag_max_ms"`
+	Skipped        uint64      `json:"skipped_total"`
+	Coalesced      uint64      `json:"coalesced_total"`
+	PluginDropped  uint64      `json:"plugin_dropped_total"`
+	Buffer         bufferStats `json:"buffer"`
+
+	RedisCommands map[string]latency.Snapshot `json:"redis_commands,omitempty"` // Latency per command
+}
+
+func newClientMetrics() *clientMetrics {
+	return &clientMetrics{api: httpapi.NewMetrics()}
+}
+
+// observeRedisWrite records the latency of one SET, or of one pipeline of
+// them when writes are batched.
+func (m *clientMetrics) observeRedisWrite(d time.Duration) {
+	m.redisWrites.Add(1)
+	m.redisWriteNanos.Add(uint64(d))
+	storeMax(&m.redisWriteMax, int64(d))
+}
+
+// observeRedisCommand records the latency of one Redis command, or of one
+// pipeline under the name "pipeline".
+func (m *clientMetrics) observeRedisCommand(name string, d time.Duration) {
+	m.redisMu.Lock()
+	h, ok := m.redisCommands[name]
+	if !ok {
+		if m.redisCommands == nil {
+			m.redisCommands = make(map[string]*latency.Histogram)
+		}
+		h = latency.New()
+		m.redisCommands[name] = h
+	}
+	m.redisMu.Unlock()
+	h.Observe(d)
+}
+
+func (m *clientMetrics) redisLatencies() map[string]latency.Snapshot {
+	m.redisMu.Lock()
+	defer m.redisMu.Unlock()
+	if len(m.redisCommands) == 0 {
+		return nil
+	}
+	snapshots := make(map[string]latency.Snapshot, len(m.redisCommands))
+	for name, h := range m.redisCommands {
+		snapshots[name] = h.Snapshot()
+	}
+	return snapshots
+}
+
+// observeLag records the delay between the server generating an update
+// (timestamp in Unix milliseconds) and us receiving it. It includes any
+// clock skew between the two hosts.
+func (m *clientMetrics) observeLag(timestamp int64, received time.Time) {
+	if timestamp == 0 {
+		return
+	}
+	lag := received.UnixMilli() - timestamp
+	m.lagSamples.Add(1)
+	m.lagMillis.Add(lag)
+	storeMax(&m.lagMax, lag)
+}
+
+func storeMax(max *atomic.Int64, value int64) {
+	for {
+		current := max.Load()
+		if value <= current || max.CompareAndSwap(current, value) {
+			return
+		}
+	}
+}
+
+// report builds a report, computing rates against the previous one.
+func (m *clientMetrics) report(now time.Time, feed feedclient.Stats, buffer *retryBuffer) metricsReport {
+	r := metricsReport{
+		Time:          now,
+		Messages:      feed.Messages,
+		Bytes:         feed.Bytes,
+		ParseErrors:   feed.DecodeErrors,
+		RedisWrites:   m.redisWrites.Load(),
+		RedisWriteMax: float64(m.redisWriteMax.Load()) / float64(time.Millisecond),
+		LagMax:        m.lagMax.Load(),
+		Skipped:       m.skipped.Load(),
+		Coalesced:     m.coalesced.Load(),
+		PluginDropped: m.pluginDropped.Load(),
+		Buffer:        buffer.Stats(),
+		RedisCommands: m.redisLatencies(),
+	}
+	if r.RedisWrites > 0 {
+		r.RedisWriteAvg = float64(m.redisWriteNanos.Load()) / float64(r.RedisWrites) / float64(time.Millisecond)
+	}
+	if samples := m.lagSamples.Load(); samples > 0 {
+		r.LagAvg = float64(m.lagMillis.Load()) / float64(samples)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if elapsed := now.Sub(m.last.Time).Seconds(); !m.last.Time.IsZero() && elapsed > 0 {
+		r.MessagesPerSec = float64(r.Messages-m.last.Messages) / elapsed
+		r.BytesPerSec = float64(r.Bytes-m.last.Bytes) / elapsed
+	}
+	m.last = r
+	return r
+}
+
+// lastReport returns the most recent report.
+func (m *clientMetrics) lastReport() metricsReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.last
+}
+
+// reportMetrics refreshes the report of metrics every interval of clk and
+// logs it to log.
+func reportMetrics(ctx context.Context, log *logging.Logger, clk clock.Clock, metrics *clientMetrics, feed *feedclient.Group, buffer *retryBuffer, interval time.Duration) {
+	ticker := clk.NewTicker(interval)
+	defer ticker.Stop()
+
+	metrics.report(clk.Now(), feed.Stats(), buffer) // Baseline for the first rates
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C():
+			r := metrics.report(now, feed.Stats(), buffer)
+			log.Infof("Stats: %.1f msg/s, %.0f B/s, %d parse errors, redis write avg %.2fms max %.2fms, lag avg %.0fms max %dms, %d buffered",
+				r.MessagesPerSec, r.BytesPerSec, r.ParseErrors, r.RedisWriteAvg, r.RedisWriteMax, r.LagAvg, r.LagMax, r.Buffer.Pending)
+		}
+	}
+}
+
+// statsHandler serves the latest report of metrics as JSON.
+func statsHandler(metrics *clientMetrics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(metrics.lastReport())
+	}
+}
+
+// metricsHandler serves the counters in the Prometheus text format. Unlike
+// /stats it reads them on every request, so it works without -stats-interval.
+func metricsHandler(feed *feedclient.Group, buffer *retryBuffer, metrics *clientMetrics) http.HandlerFunc {
+	write := metricsWriter(feed, buffer, metrics)
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", promtext.ContentType)
+		write(promtext.NewWriter(w))
+	}
+}
+
+// metricsWriter returns the function writing every metric to a sink, for
+// /metrics and OTLP export.
+func metricsWriter(feed *feedclient.Group, buffer *retryBuffer, metrics *clientMetrics) func(p promtext.Sink) {
+	return func(p promtext.Sink) {
+		stats := feed.Stats()
+		buffered := buffer.Stats()
+
+		p.Family("feed_connected", promtext.Gauge, "Feed connections currently up.")
+		p.Sample("feed_connected", float64(feed.Connected()))
+		p.Family("feed_connects_total", promtext.Counter, "Successful connections to the feed, including reconnects.")
+		p.Sample("feed_connects_total", float64(stats.Connects))
+		p.Family("feed_messages_total", promtext.Counter, "Updates received from the feed.")
+		p.Sample("feed_messages_total", float64(stats.Messages))
+		p.Family("feed_bytes_total", promtext.Counter, "Bytes received from the feed.")
+		p.Sample("feed_bytes_total", float64(stats.Bytes))
+		p.Family("feed_decode_errors_total", promtext.Counter, "Feed lines that could not be decoded.")
+		p.Sample("feed_decode_errors_total", float64(stats.DecodeErrors))
+		p.Family("feed_handler_errors_total", promtext.Counter, "Updates that could not be stored.")
+		p.Sample("feed_handler_errors_total", float64(stats.HandlerErrors))
+
+		p.Family("updates_skipped_total", promtext.Counter, "Updates dropped because the price had not changed.")
+		p.Sample("updates_skipped_total", float64(metrics.skipped.Load()))
+		p.Family("updates_coalesced_total", promtext.Counter, "Batched writes replaced by a newer one before the flush.")
+		p.Sample("updates_coalesced_total", float64(metrics.coalesced.Load()))
+		p.Family("plugin_dropped_total", promtext.Counter, "Updates not sent to a sink plugin because its queue was full.")
+		p.Sample("plugin_dropped_total", float64(metrics.pluginDropped.Load()))
+		p.Family("update_lag_max_milliseconds", promtext.Gauge, "Largest delay seen between an update's timestamp and its receipt.")
+		p.Sample("update_lag_max_milliseconds", float64(metrics.lagMax.Load()))
+
+		p.Family("retry_buffer_pending", promtext.Gauge, "Writes waiting in the retry buffer.")
+		p.Sample("retry_buffer_pending", float64(buffered.Pending))
+		p.Family("retry_buffer_dropped_total", promtext.Counter, "Writes dropped because the retry buffer was full.")
+		p.Sample("retry_buffer_dropped_total", float64(buffered.Dropped))
+
+		metrics.api.Write(p)
+
+		metrics.redisMu.Lock()
+		commands := make(map[string]*latency.Histogram, len(metrics.redisCommands))
+		maps.Copy(commands, metrics.redisCommands)
+		metrics.redisMu.Unlock()
+		if len(commands) > 0 {
+			p.Family("redis_command_duration_seconds", promtext.Histogram, "Latency of Redis commands, and of pipelines as \"pipeline\".")
+			for _, name := range slices.Sorted(maps.Keys(commands)) {
+				commands[name].Write(p, "redis_command_duration_seconds", "command", name)
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package consume
+
+import (
+	"context"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// keyspaceEventFlags are the notify-keyspace-events classes subscribeKeyspace
+// needs: keyspace channels (K) for string (set) and hash (hset) commands
+const keyspaceEventFlags = "K$h"
+
+// enableKeyspaceEvents turns on the keyspace notifications Redis needs to
+// send, keeping any classes already enabled. Managed Redis services often
+// forbid CONFIG; there they must be enabled by the operator.
+func enableKeyspaceEvents(ctx context.Context, rdb redis.UniversalClient) error {
+	current, err := rdb.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil {
+		return err
+	}
+	flags := current["notify-keyspace-events"]
+	missing := false
+	for _, flag := range keyspaceEventFlags {
+		// A stands for every class, though not for K
+		covered := strings.ContainsRune(flags, flag) || (flag != 'K' && strings.ContainsRune(flags, 'A'))
+		if !covered {
+			flags += string(flag)
+			missing = true
+		}
+	}
+	if !missing {
+		return nil
+	}
+	return rdb.ConfigSet(ctx, "notify-keyspace-events", flags).Err()
+}
+
+// subscribeKeyspace delivers every latest price written to Redis, by any
+// client instance, whether or not it publishes updates. Each notification
+// only names the key, so the new value is read back: the key's in the keys
+// layout, or the hash's, sending just the symbols that changed. On Redis
+// Cluster notifications are per node, so only the writes to the node
+// subscribed to are seen.
+func (c *priceCache) subscribeKeyspace(ctx context.Context) (<-chan StockUpdate, error) {
+	pattern := "__keyspace@*__:" + c.keys.Data()
+	if c.layout == layoutKeys {
+		pattern = "__keyspace@*__:" + c.keys.Pattern("data")
+	}
+
+	// Last update sent per symbol, starting from what the snapshot shows
+	sent := make(map[string]StockUpdate)
+	for _, update := range c.localSnapshot() {
+		sent[update.Symbol] = update
+	}
+
+	return forwardMessages(ctx, c.rdb.PSubscribe(ctx, pattern), func(msg *redis.Message) []StockUpdate {
+		if msg.Payload != "set" && msg.Payload != "hset" {
+			return nil // Expiry and deletion leave nothing to send
+		}
+		_, key, _ := strings.Cut(msg.Channel, "__:")
+
+		var values []string
+		if c.layout == layoutKeys {
+			value, err := c.rdb.Get(ctx, key).Result()
+			if err != nil {
+				return nil
+			}
+			values = []string{value}
+		} else {
+			fields, err := c.rdb.HGetAll(ctx, key).Result()
+			if err != nil {
+				return nil
+			}
+			for _, value := range fields {
+				values = append(values, value)
+			}
+		}
+
+		var changed []StockUpdate
+		for _, value := range values {
+			var update StockUpdate
+			if unmarshalStored(value, &update) != nil || sent[update.Symbol] == update {
+				continue
+			}
+			sent[update.Symbol] = update
+			changed = append(changed, update)
+		}
+		return changed
+	})
+}
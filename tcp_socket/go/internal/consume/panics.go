@@ -0,0 +1,23 @@
+package consume
+
+import (
+	"context"
+
+	"ifin/internal/errreport"
+	"ifin/pkg/feedclient"
+)
+
+// recoverUpdate turns a panic while handling an update into an error,
+// reported with the update, so one bad update does not stop the feed.
+func recoverUpdate(next feedclient.Handler) feedclient.Handler {
+	return func(ctx context.Context, update StockUpdate) (err error) {
+		defer func() {
+			if value := recover(); value != nil {
+				panicErr := errreport.Panic(value)
+				errreport.Report(panicErr, map[string]string{"component": "pipeline", "symbol": update.Symbol, "tick": update.ID})
+				err = panicErr
+			}
+		}()
+		return next(ctx, update)
+	}
+}
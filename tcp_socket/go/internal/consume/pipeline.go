@@ -0,0 +1,98 @@
+package consume
+
+import (
+	"context"
+	"sync"
+
+	"ifin/internal/clock"
+	"ifin/internal/logging"
+	"ifin/pkg/feedclient"
+	"ifin/pkg/store"
+)
+
+// newUpdateHandler builds the processing applied to every update received
+// from the feed. Custom steps (enrichment, forwarding, ...) are added as
+// middleware here without touching the read loop, or from outside this file
+// as hooks. Every update, changed or not, is sent to plugins. Lag and
+// skipped updates are counted in metrics, and skipped updates logged to log.
+func newUpdateHandler(st *storage, plugins []*sinkPlugin, skipUnchanged bool, clk clock.Clock, metrics *clientMetrics, h clientHooks, log *logging.Logger) feedclient.Handler {
+	middleware := []feedclient.Middleware{recoverUpdate}
+	if len(h.OnReceive) > 0 {
+		middleware = append(middleware, runHooks(h.OnReceive))
+	}
+	middleware = append(middleware, traceUpdate, measureLag(clk, metrics))
+	if st.archive != nil {
+		middleware = append(middleware, archiveTo(st.archive))
+	}
+	if len(plugins) > 0 {
+		middleware = append(middleware, sendToPlugins(plugins))
+	}
+	if skipUnchanged {
+		middleware = append(middleware, dropUnchanged(log, metrics))
+	}
+	if len(h.BeforeStore) > 0 {
+		middleware = append(middleware, runHooks(h.BeforeStore))
+	}
+	return feedclient.Chain(st.Put, middleware...)
+}
+
+// measureLag returns middleware recording in metrics how long each update
+// took to reach us, by clk.
+func measureLag(clk clock.Clock, metrics *clientMetrics) feedclient.Middleware {
+	return func(next feedclient.Handler) feedclient.Handler {
+		return func(ctx context.Context, update StockUpdate) error {
+			metrics.observeLag(update.Timestamp, clk.Now())
+			return next(ctx, update)
+		}
+	}
+}
+
+// archiveTo returns middleware that also writes every update, changed or
+// not, to archive. Failures are logged without stopping the update.
+func archiveTo(archive store.Store) feedclient.Middleware {
+	return func(next feedclient.Handler) feedclient.Handler {
+		return func(ctx context.Context, update StockUpdate) error {
+			if err := archive.Put(ctx, update); err != nil {
+				storeLog.Errorf("Error archiving update %s: %v", update.ID, err)
+			}
+			return next(ctx, update)
+		}
+	}
+}
+
+// sendToPlugins returns middleware that also queues every update for each
+// of the sink plugins, without waiting for them.
+func sendToPlugins(plugins []*sinkPlugin) feedclient.Middleware {
+	return func(next feedclient.Handler) feedclient.Handler {
+		return func(ctx context.Context, update StockUpdate) error {
+			for _, plugin := range plugins {
+				plugin.Send(update)
+			}
+			return next(ctx, update)
+		}
+	}
+}
+
+// dropUnchanged returns middleware that ignores updates repeating their
+// symbol's previous price, so the stored update keeps the earlier timestamp,
+// logging each to log and counting them in metrics.
+func dropUnchanged(log *logging.Logger, metrics *clientMetrics) feedclient.Middleware {
+	var mu sync.Mutex
+	prices := make(map[string]float64) // Symbol -> last price passed on
+
+	return func(next feedclient.Handler) feedclient.Handler {
+		return func(ctx context.Context, update StockUpdate) error {
+			mu.Lock()
+			previous, seen := prices[update.Symbol]
+			prices[update.Symbol] = update.Price
+			mu.Unlock()
+
+			if seen && previous == update.Price {
+				metrics.skipped.Add(1)
+				log.Eventf(update.Symbol, "Skipped update %s, unchanged price for %s", update.ID, update.Symbol)
+				return nil
+			}
+			return next(ctx, update)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package consume
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ifin/internal/logging"
+)
+
+// Sink plugins are programs run alongside the client, set with
+// -sink-plugins, that receive every update as a line of JSON on their
+// stdin, with the fields of the feed (symbol, price, ts, seq, id), so
+// updates can be forwarded anywhere without recompiling the client. They
+// share the client's stdout and stderr. On shutdown a plugin's stdin is
+// closed, and it has pluginStopTimeout to write out what it holds and exit.
+const (
+	pluginRestartDelay = 5 * time.Second // Before a plugin that exited is run again
+	pluginStopTimeout  = 5 * time.Second // Before a plugin still running on shutdown is killed
+)
+
+// sinkPlugin is one running sink plugin and the updates queued for it.
+type sinkPlugin struct {
+	name    string
+	command []string
+	updates chan StockUpdate
+	metrics *clientMetrics // Counts the updates dropped
+	log     *logging.Logger
+}
+
+// newSinkPlugins returns a plugin for each of the comma-separated commands,
+// split into arguments on spaces, with up to buffer updates queued for each.
+func newSinkPlugins(commands string, buffer int, metrics *clientMetrics, log *logging.Logger) []*sinkPlugin {
+	var plugins []*sinkPlugin
+	for _, command := range splitList(commands) {
+		args := strings.Fields(command)
+		plugins = append(plugins, &sinkPlugin{
+			name:    filepath.Base(args[0]),
+			command: args,
+			updates: make(chan StockUpdate, buffer),
+			metrics: metrics,
+			log:     log,
+		})
+	}
+	return plugins
+}
+
+// Send queues update for the plugin without waiting, dropping it when the
+// plugin is that far behind.
+func (p *sinkPlugin) Send(update StockUpdate) {
+	select {
+	case p.updates <- update:
+	default:
+		p.metrics.pluginDropped.Add(1)
+	}
+}
+
+// Run runs the plugin until ctx is done, running it again whenever it
+// exits. Updates still queued on shutdown are dropped.
+func (p *sinkPlugin) Run(ctx context.Context) {
+	for {
+		err := p.runOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		p.log.Errorf("Sink plugin %s stopped: %v, restarting in %v", p.name, err, pluginRestartDelay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pluginRestartDelay):
+		}
+	}
+}
+
+// runOnce starts the plugin and writes it the queued updates until it
+// exits, returning why.
+func (p *sinkPlugin) runOnce(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, p.command[0], p.command[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Cancel = stdin.Close
+	cmd.WaitDelay = pluginStopTimeout
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	p.log.Infof("Sink plugin %s started, pid %d", p.name, cmd.Process.Pid)
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	encoder := json.NewEncoder(stdin)
+	for {
+		select {
+		case err := <-exited:
+			if err == nil {
+				err = errors.New("exited")
+			}
+			return err
+		case update := <-p.updates:
+			if err := encoder.Encode(update); err != nil {
+				cmd.Process.Kill()
+				<-exited
+				return fmt.Errorf("writing update %s: %w", update.ID, err)
+			}
+		}
+	}
+}
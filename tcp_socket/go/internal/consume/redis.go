@@ -0,0 +1,138 @@
+package consume
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"ifin/internal/secrets"
+	"ifin/pkg/keyspace"
+)
+
+// newRedisClient connects to the Redis deployment described by cfg: a
+// single server, a master found through Sentinel, or a Redis Cluster. The
+// password is asked for on every new connection, so a rotated password is
+// used from then on. Command latencies are recorded in metrics.
+func newRedisClient(cfg *config, password *secrets.Secret, metrics *clientMetrics) (redis.UniversalClient, error) {
+	credentials := func() (string, string) {
+		return "", password.Value()
+	}
+	clusterAddrs := splitList(cfg.RedisCluster)
+	sentinelAddrs := splitList(cfg.RedisSentinels)
+
+	var rdb redis.UniversalClient
+	switch {
+	case len(clusterAddrs) > 0 && len(sentinelAddrs) > 0:
+		return nil, errors.New("-redis-cluster and -redis-sentinels cannot be combined")
+	case len(clusterAddrs) > 0:
+		rdb = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:               clusterAddrs,
+			CredentialsProvider: credentials,
+		})
+	case len(sentinelAddrs) > 0:
+		// The sentinels are asked for the current master on every (re)connect,
+		// so a failover only costs the writes in flight, which are buffered
+		rdb = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    cfg.RedisMaster,
+			SentinelAddrs: sentinelAddrs,
+			// FailoverOptions has no CredentialsProvider, so each new master
+			// connection authenticates itself with the current password
+			OnConnect: func(ctx context.Context, cn *redis.Conn) error {
+				if p := password.Value(); p != "" {
+					return cn.Auth(ctx, p).Err()
+				}
+				return nil
+			},
+		})
+	default:
+		rdb = redis.NewClient(&redis.Options{
+			Addr:                cfg.RedisAddr, // Redis server address
+			CredentialsProvider: credentials,
+		})
+	}
+	rdb.AddHook(redisTimer{slow: cfg.RedisSlow, metrics: metrics})
+	return rdb, nil
+}
+
+// redisTimer is a go-redis hook timing every command and pipeline into
+// metrics, and logging those slower than slow (0 logs none).
+type redisTimer struct {
+	slow    time.Duration
+	metrics *clientMetrics
+}
+
+func (t redisTimer) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (t redisTimer) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		t.observe(cmd.Name(), cmd.Name(), time.Since(start))
+		return err
+	}
+}
+
+func (t redisTimer) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+		t.observe("pipeline", fmt.Sprintf("pipeline of %d commands", len(cmds)), time.Since(start))
+		return err
+	}
+}
+
+// observe records d under name, describing the operation as what if slow.
+func (t redisTimer) observe(name, what string, d time.Duration) {
+	t.metrics.observeRedisCommand(name, d)
+	if t.slow > 0 && d >= t.slow {
+		redisLog.Warnf("Slow Redis %s took %v", what, d.Round(time.Microsecond))
+	}
+}
+
+// clustered reports whether rdb is a Redis Cluster client.
+func clustered(rdb redis.UniversalClient) bool {
+	_, ok := rdb.(*redis.ClusterClient)
+	return ok
+}
+
+// redisNamespace names the keys under prefix. On a cluster each symbol's
+// keys are kept in one hash slot, so they can be used together.
+func redisNamespace(rdb redis.UniversalClient, prefix string) keyspace.Namespace {
+	return keyspace.Namespace{Prefix: prefix, HashTags: clustered(rdb)}
+}
+
+// scanKeys lists the keys matching pattern with SCAN, which walks the
+// keyspace in small steps instead of blocking Redis the way KEYS does. On a
+// cluster every master is scanned.
+func scanKeys(ctx context.Context, rdb redis.UniversalClient, pattern string) ([]string, error) {
+	cluster, ok := rdb.(*redis.ClusterClient)
+	if !ok {
+		return scanNode(ctx, rdb, pattern)
+	}
+
+	var mu sync.Mutex
+	var keys []string
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		nodeKeys, err := scanNode(ctx, node, pattern)
+		mu.Lock()
+		keys = append(keys, nodeKeys...)
+		mu.Unlock()
+		return err
+	})
+	return keys, err
+}
+
+func scanNode(ctx context.Context, rdb redis.UniversalClient, pattern string) ([]string, error) {
+	var keys []string
+	iter := rdb.Scan(ctx, 0, pattern, 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
@@ -0,0 +1,69 @@
+package consume
+
+import (
+	"net/http"
+
+	"ifin/internal/httpapi"
+)
+
+// endpoints lists every HTTP endpoint of the client: the API's, the gRPC
+// gateway's and the operational ones.
+func (c *client) endpoints(apiCfg httpapi.Config, gateway http.Handler) []httpapi.Endpoint {
+	rpcSymbols := []httpapi.QueryParam{{Name: "symbols", Kind: "string", Description: "A symbol, repeated for several; every symbol when unset"}}
+	return append(httpapi.Endpoints(apiCfg, c.st),
+		// The gRPC service as REST+JSON, see newGateway
+		httpapi.Endpoint{Pattern: "/v1/prices", Handler: gateway, Browser: true, Tag: "grpc-gateway", ContentType: "application/json", Params: rpcSymbols,
+			Summary: "PriceFeed.GetLatest: the latest price of every symbol"},
+		httpapi.Endpoint{Pattern: "/v1/history/{symbol}", Handler: gateway, Browser: true, Tag: "grpc-gateway", ContentType: "application/json",
+			Summary: "PriceFeed.GetHistory: a page of a symbol's history",
+			Params: []httpapi.QueryParam{
+				{Name: "from", Kind: "integer", Description: "Start of the range, Unix milliseconds"},
+				{Name: "to", Kind: "integer", Description: "End of the range, Unix milliseconds"},
+				{Name: "limit", Kind: "integer", Description: "Most updates to return, 1000 by default"},
+			}},
+		httpapi.Endpoint{Pattern: "/v1/ticks", Handler: gateway, Browser: true, Stream: true, Tag: "grpc-gateway", ContentType: "application/json", Params: rpcSymbols,
+			Summary: "PriceFeed.StreamTicks: every update as it arrives, as newline-delimited JSON"},
+
+		// Operations
+		httpapi.Endpoint{Pattern: "/stats", Handler: statsHandler(c.metrics), Tag: "operations", ContentType: "application/json",
+			Summary: "The latest throughput and latency report"},
+		httpapi.Endpoint{Pattern: "/streams", Handler: http.HandlerFunc(c.metrics.api.StreamsHandler), Tag: "operations", ContentType: "application/json",
+			Summary: "Open /sse streams and GraphQL subscriptions, with the updates each dropped (min_change) or conflated (interval) per symbol"},
+		httpapi.Endpoint{Pattern: "/events", Handler: eventsHandler(c.events), Tag: "operations", ContentType: "application/json",
+			Params: []httpapi.QueryParam{
+				{Name: "kind", Kind: "string", Description: "Only events of this kind: connected, connect_failed, disconnected, reconnecting, redis_down, redis_up or config_reloaded"},
+				{Name: "since", Kind: "string", Description: "Only events from this time, Unix milliseconds or RFC 3339"},
+				{Name: "limit", Kind: "integer", Description: "Most events to return, 100 by default"},
+			},
+			Summary: "Recorded connection, Redis and reload events, newest first"},
+		httpapi.Endpoint{Pattern: "/metrics", Handler: metricsHandler(c.feed, c.buffer, c.metrics), Tag: "operations", ContentType: "text/plain",
+			Summary: "Metrics in the Prometheus text format"},
+		httpapi.Endpoint{Pattern: "/health", Handler: healthHandler(c.st.health), Tag: "operations", ContentType: "application/json",
+			Summary: "State of the Redis circuit breaker"},
+		httpapi.Endpoint{Pattern: "/healthz", Handler: http.HandlerFunc(livenessHandler), Tag: "operations", ContentType: "application/json",
+			Summary: "Liveness: the process is serving HTTP"},
+		httpapi.Endpoint{Pattern: "/readyz", Handler: readinessHandler(c.feed, c.st), Tag: "operations", ContentType: "application/json",
+			Summary: "Readiness: the feed is connected and Redis reachable"},
+	)
+}
+
+// newRouter returns the handler of every HTTP endpoint, configured from the
+// -stale-after, -sse-ping-interval, -max-streams, -http-compression,
+// -http-rate and -http-burst flags; see httpapi.NewRouter.
+func (c *client) newRouter(cors *httpapi.CORSPolicy, proxies *httpapi.ProxyPolicy, gateway http.Handler) http.Handler {
+	cfg := c.cfg
+	apiCfg := httpapi.Config{
+		StaleAfter:      cfg.StaleAfter,
+		SSEPingInterval: cfg.SSEPingInterval,
+		MaxStreams:      cfg.MaxStreams,
+		Compression:     cfg.HTTPCompression,
+		Rate:            cfg.HTTPRate,
+		Burst:           cfg.HTTPBurst,
+		CORS:            cors,
+		Proxies:         proxies,
+		Logger:          c.logger,
+		Clock:           c.clock,
+		Metrics:         c.metrics.api,
+	}
+	return httpapi.NewRouter(apiCfg, c.endpoints(apiCfg, gateway))
+}
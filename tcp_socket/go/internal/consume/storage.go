@@ -0,0 +1,177 @@
+package consume
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+
+	"ifin/internal/clock"
+	"ifin/pkg/codec"
+	"ifin/pkg/compression"
+	"ifin/pkg/keyspace"
+	"ifin/pkg/store"
+)
+
+// Storage backends, selected with -store
+const (
+	storeRedis     = "redis"     // Redis, with the retry buffer and batching
+	storeMemory    = "memory"    // Process memory only, for demos
+	storeBolt      = "bolt"      // A local BoltDB file
+	storeSQLite    = "sqlite"    // A local SQLite file
+	storePostgres  = "postgres"  // PostgreSQL or TimescaleDB, see -postgres-dsn
+	storeMemcached = "memcached" // Memcached, see -memcached-servers
+)
+
+// storage is the opened backends: the store prices are kept in and, when
+// -postgres-dsn is set alongside another store, the archive every tick is
+// also written to.
+type storage struct {
+	store.Store
+	archive store.Store                 // Nil when not archiving
+	health  *redisHealth                // Nil unless Redis is checked
+	ping    func(context.Context) error // Checks Redis is reachable; nil for other stores
+
+	workers []func(context.Context) // Background writers, run by client.run until shutdown
+	closers []func(context.Context)
+}
+
+// close writes out what is pending, within ctx, and releases the backends.
+func (s *storage) close(ctx context.Context) {
+	for _, release := range s.closers {
+		release(ctx)
+	}
+}
+
+// openStore opens the backends selected in cfg. For Redis, rdb is the client
+// to use, whose outages are recorded in events and writes timed in metrics,
+// and clk tells which cached prices are past -key-ttl and when buffered
+// writes are retried. Background writers are left in workers for the caller
+// to run.
+func openStore(ctx context.Context, cfg *config, clk clock.Clock, rdb redis.UniversalClient, keys keyspace.Namespace, buffer *retryBuffer, metrics *clientMetrics, events *eventLog) (*storage, error) {
+	s := &storage{}
+	if cfg.PostgresDSN != "" {
+		pg, err := openPostgres(ctx, cfg, s)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Store == storePostgres {
+			s.Store = pg
+			return s, nil
+		}
+		s.archive = pg
+	}
+
+	switch cfg.Store {
+	case storeRedis:
+		cache, err := newPriceCache(rdb, keys, buffer, cfg.CacheLayout, clk, metrics)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.PubSubChannel != "" {
+			cache.channel = keys.Key(cfg.PubSubChannel)
+		}
+		cache.streamMaxLen = cfg.StreamMaxLen
+		cache.historyRetention = cfg.HistoryRetention
+		cache.ttl = cfg.KeyTTL
+		if !compression.Valid(cfg.Compression) {
+			return nil, fmt.Errorf("unknown compression %q", cfg.Compression)
+		}
+		cache.compression = cfg.Compression
+		if cache.format, err = codec.Lookup(cfg.StoreFormat); err != nil {
+			return nil, err
+		}
+		if cfg.KeyspaceEvents {
+			if err := enableKeyspaceEvents(ctx, rdb); err != nil {
+				redisLog.Errorf("Error enabling keyspace notifications, make sure notify-keyspace-events includes %s: %v", keyspaceEventFlags, err)
+			}
+			cache.keyspaceEvents = true
+		}
+		if cfg.AtomicWrites {
+			if clustered(rdb) && cfg.CacheLayout == layoutHash {
+				return nil, fmt.Errorf("-atomic-writes needs -cache-layout %s on Redis Cluster", layoutKeys)
+			}
+			if err := loadUpdateScript(ctx, rdb); err != nil {
+				redisLog.Errorf("Error loading the update script, it is sent on first use instead: %v", err)
+			}
+			cache.atomic = true
+		}
+		if cfg.RedisHealth > 0 {
+			cache.health = newRedisHealth(rdb, cfg.RedisHealth, events, clk)
+			s.health = cache.health
+			s.workers = append(s.workers, cache.health.Run)
+		}
+		s.workers = append(s.workers, func(ctx context.Context) { retryBufferedWrites(ctx, cache, clk, cfg.BufferRetry) })
+		if cfg.BatchWindow > 0 {
+			cache.batch = newBatchWriter(cache, cfg.BatchWindow)
+			s.workers = append(s.workers, cache.batch.Run)
+		}
+		// Without Pub/Sub or keyspace notifications, /sse is still pushed the
+		// updates this client writes
+		s.Store = store.Broadcast(cache)
+		s.ping = func(ctx context.Context) error { return rdb.Ping(ctx).Err() }
+		s.closers = append(s.closers, func(ctx context.Context) { drainWrites(ctx, cache) })
+
+	case storeMemory:
+		s.Store = store.NewMemory(cfg.HistoryRetention)
+
+	case storeBolt:
+		db, err := store.OpenBolt(cfg.BoltFile, cfg.HistoryRetention)
+		if err != nil {
+			return nil, err
+		}
+		s.Store = db
+		s.closers = append(s.closers, func(context.Context) { db.Close() })
+
+	case storeSQLite:
+		db, err := store.OpenSQLite(ctx, cfg.SQLiteFile, cfg.HistoryRetention)
+		if err != nil {
+			return nil, err
+		}
+		s.workers = append(s.workers, func(ctx context.Context) {
+			db.Run(ctx, cfg.SQLiteFlush, func(err error) {
+				storeLog.Errorf("Error writing prices to SQLite, retrying: %v", err)
+			})
+		})
+		s.Store = db
+		s.closers = append(s.closers, func(ctx context.Context) {
+			if err := db.Flush(ctx); err != nil {
+				storeLog.Errorf("Error writing prices to SQLite on shutdown: %v", err)
+			}
+			db.Close()
+		})
+
+	case storeMemcached:
+		mc := store.NewMemcached(splitList(cfg.MemcachedServers), keys, cfg.HistoryRetention)
+		s.Store = mc
+		s.closers = append(s.closers, func(context.Context) { mc.Close() })
+
+	case storePostgres:
+		return nil, fmt.Errorf("-store %s needs -postgres-dsn", storePostgres)
+
+	default:
+		return nil, fmt.Errorf("unknown store %q", cfg.Store)
+	}
+	return s, nil
+}
+
+// openPostgres connects to PostgreSQL, inserting batches of ticks every
+// -postgres-flush once its worker runs.
+func openPostgres(ctx context.Context, cfg *config, s *storage) (*store.Postgres, error) {
+	pg, err := store.OpenPostgres(ctx, cfg.PostgresDSN)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to PostgreSQL: %w", err)
+	}
+	s.workers = append(s.workers, func(ctx context.Context) {
+		pg.Run(ctx, cfg.PostgresFlush, func(err error) {
+			storeLog.Errorf("Error inserting ticks into PostgreSQL, retrying: %v", err)
+		})
+	})
+	s.closers = append(s.closers, func(ctx context.Context) {
+		if err := pg.Flush(ctx); err != nil {
+			storeLog.Errorf("Error inserting ticks into PostgreSQL on shutdown: %v", err)
+		}
+		pg.Close()
+	})
+	return pg, nil
+}
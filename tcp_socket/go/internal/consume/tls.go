@@ -0,0 +1,78 @@
+package consume
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"ifin/internal/secrets"
+)
+
+// httpTLSConfig builds the TLS config for the HTTP server. A certificate for
+// autocertHost is obtained from Let's Encrypt when set; otherwise certFile and
+// keyFile are used (and reloaded through the returned refreshers). A nil
+// config means plain HTTP.
+func httpTLSConfig(certFile, keyFile, autocertHost, autocertCache, challengeAddr string) (*tls.Config, []secrets.Refresher, error) {
+	switch {
+	case autocertHost != "":
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(autocertHost),
+			Cache:      autocert.DirCache(autocertCache),
+		}
+
+		// HTTP-01 challenges arrive on port 80; everything else is redirected
+		go func() {
+			httpLog.Infof("ACME challenge server started on %s", challengeAddr)
+			if err := http.ListenAndServe(challengeAddr, manager.HTTPHandler(nil)); err != nil {
+				httpLog.Errorf("ACME challenge server error: %v", err)
+			}
+		}()
+		return manager.TLSConfig(), nil, nil
+
+	case certFile != "" && keyFile != "":
+		cert, err := secrets.LoadCertificate(certFile, keyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		return cert.TLSConfig(), []secrets.Refresher{cert}, nil
+
+	default:
+		return nil, nil, nil
+	}
+}
+
+// feedTLSConfig builds the TLS config for dialing the feed server. A nil
+// config means a plain TCP connection. caFile replaces the system roots,
+// certFile and keyFile add a client certificate for servers that require
+// one, and insecure disables verification (for testing only).
+func feedTLSConfig(enabled bool, caFile, certFile, keyFile, serverName string, insecure bool) (*tls.Config, []secrets.Refresher, error) {
+	if !enabled {
+		return nil, nil, nil
+	}
+
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         serverName,
+		InsecureSkipVerify: insecure,
+	}
+	if caFile != "" {
+		pool, err := secrets.LoadCertPool(caFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		config.RootCAs = pool
+	}
+
+	var refreshers []secrets.Refresher
+	if certFile != "" && keyFile != "" {
+		cert, err := secrets.LoadCertificate(certFile, keyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		config.GetClientCertificate = cert.GetClientCertificate
+		refreshers = append(refreshers, cert)
+	}
+	return config, refreshers, nil
+}
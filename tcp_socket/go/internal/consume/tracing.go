@@ -0,0 +1,45 @@
+package consume
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"ifin/internal/tracing"
+	"ifin/pkg/feedclient"
+)
+
+// tracer records the client's part of each traced tick: receive, then the
+// Redis write, then one SSE emit per stream (see internal/httpapi). Every step stamps the update
+// with its own span, so the next one nests below it, within the process and
+// across Redis Pub/Sub.
+var tracer = tracing.Tracer("feed-client")
+
+// traceUpdate records a receive span for each update traced by the server,
+// covering the rest of the pipeline.
+func traceUpdate(next feedclient.Handler) feedclient.Handler {
+	return func(ctx context.Context, update StockUpdate) error {
+		if update.TraceParent == "" {
+			return next(ctx, update)
+		}
+		ctx, span := startSpan(ctx, update, "receive", trace.WithSpanKind(trace.SpanKindConsumer))
+		defer span.End()
+		update.TraceParent = tracing.TraceParent(ctx)
+
+		err := next(ctx, update)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
+	}
+}
+
+// startSpan starts a span for update, continuing the trace it carries.
+func startSpan(ctx context.Context, update StockUpdate, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	ctx = tracing.WithTraceParent(ctx, update.TraceParent)
+	opts = append(opts, trace.WithAttributes(attribute.String("symbol", update.Symbol), attribute.Int64("seq", int64(update.Seq)), attribute.String("tick.id", update.ID)))
+	return tracer.Start(ctx, name, opts...)
+}
@@ -0,0 +1,34 @@
+// Package debug serves the net/http/pprof profiles, and runtime statistics
+// for quick triage without a profiler, on a listener of their own, so they
+// are never exposed alongside the public endpoints.
+package debug
+
+import (
+	"context"
+	"net/http"
+	"net/http/pprof"
+)
+
+// Handler serves the profiles under /debug/pprof/ and the goroutine, heap,
+// GC and uptime statistics as JSON on /debug/stats.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/stats", statsHandler)
+	return mux
+}
+
+// Serve serves Handler on addr until ctx is done, or fails when it cannot.
+func Serve(ctx context.Context, addr string) error {
+	server := &http.Server{Addr: addr, Handler: Handler()}
+	stop := context.AfterFunc(ctx, func() { server.Close() })
+	defer stop()
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
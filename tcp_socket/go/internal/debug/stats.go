@@ -0,0 +1,83 @@
+package debug
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// started is when the process started, near enough
+var started = time.Now()
+
+// recentPauses is how many of the latest GC pauses /debug/stats lists
+const recentPauses = 10
+
+// runtimeStats is the /debug/stats document.
+type runtimeStats struct {
+	Uptime        string  `json:"uptime"`
+	UptimeSeconds float64 `json:"uptime_seconds"`
+	GoVersion     string  `json:"go_version"`
+	GOMAXPROCS    int     `json:"gomaxprocs"`
+	Goroutines    int     `json:"goroutines"`
+
+	Heap struct {
+		AllocBytes    uint64 `json:"alloc_bytes"` // Live objects
+		InUseBytes    uint64 `json:"inuse_bytes"`
+		IdleBytes     uint64 `json:"idle_bytes"`
+		ReleasedBytes uint64 `json:"released_bytes"` // Returned to the OS
+		SysBytes      uint64 `json:"sys_bytes"`      // Obtained from the OS, for everything
+		Objects       uint64 `json:"objects"`
+	} `json:"heap"`
+
+	GC struct {
+		Count          uint32    `json:"count"`
+		Last           time.Time `json:"last,omitzero"`
+		NextHeapBytes  uint64    `json:"next_heap_bytes"` // Heap size triggering the next collection
+		PauseTotalMs   float64   `json:"pause_total_ms"`
+		RecentPausesMs []float64 `json:"recent_pauses_ms"` // Latest first
+		CPUFraction    float64   `json:"cpu_fraction"`
+	} `json:"gc"`
+}
+
+// readStats reads the runtime's statistics. It briefly stops the world, like
+// every runtime.ReadMemStats.
+func readStats() runtimeStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	var s runtimeStats
+	uptime := time.Since(started)
+	s.Uptime = uptime.Round(time.Second).String()
+	s.UptimeSeconds = uptime.Seconds()
+	s.GoVersion = runtime.Version()
+	s.GOMAXPROCS = runtime.GOMAXPROCS(0)
+	s.Goroutines = runtime.NumGoroutine()
+
+	s.Heap.AllocBytes = m.HeapAlloc
+	s.Heap.InUseBytes = m.HeapInuse
+	s.Heap.IdleBytes = m.HeapIdle
+	s.Heap.ReleasedBytes = m.HeapReleased
+	s.Heap.SysBytes = m.Sys
+	s.Heap.Objects = m.HeapObjects
+
+	s.GC.Count = m.NumGC
+	if m.LastGC != 0 {
+		s.GC.Last = time.Unix(0, int64(m.LastGC))
+	}
+	s.GC.NextHeapBytes = m.NextGC
+	s.GC.PauseTotalMs = float64(m.PauseTotalNs) / float64(time.Millisecond)
+	s.GC.RecentPausesMs = make([]float64, 0, recentPauses)
+	for i := uint32(0); i < min(m.NumGC, recentPauses); i++ {
+		pause := m.PauseNs[(m.NumGC-1-i)%uint32(len(m.PauseNs))] // A ring, the latest at NumGC-1
+		s.GC.RecentPausesMs = append(s.GC.RecentPausesMs, float64(pause)/float64(time.Millisecond))
+	}
+	s.GC.CPUFraction = m.GCCPUFraction
+	return s
+}
+
+// statsHandler serves readStats as JSON.
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(readStats())
+}
@@ -0,0 +1,86 @@
+// Package errreport hands panics and failures operators must hear about to
+// an error tracker, so they are alerted instead of having to search logs.
+// Nothing is reported until a Reporter is installed with Use.
+package errreport
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+)
+
+// Reporter sends errors somewhere they are noticed. Tags say where an error
+// happened, e.g. component=connection.
+type Reporter interface {
+	Report(err error, tags map[string]string)
+	// Flush waits up to timeout for reports still being sent.
+	Flush(timeout time.Duration)
+}
+
+// flushTimeout bounds the wait for a report before crashing
+const flushTimeout = 2 * time.Second
+
+type discard struct{}
+
+func (discard) Report(error, map[string]string) {}
+func (discard) Flush(time.Duration)             {}
+
+var reporter Reporter = discard{}
+
+// Use makes r the process-wide reporter. Call it before starting goroutines
+// that report.
+func Use(r Reporter) {
+	reporter = r
+}
+
+// Report reports err to the installed reporter.
+func Report(err error, tags map[string]string) {
+	reporter.Report(err, tags)
+}
+
+// Flush waits up to timeout for reports to be sent; call it before exiting.
+func Flush(timeout time.Duration) {
+	reporter.Flush(timeout)
+}
+
+// PanicError is a recovered panic.
+type PanicError struct {
+	Value any
+	Stack []byte // Of the panicking goroutine
+}
+
+// Panic wraps the value returned by recover, with the current stack. Call it
+// from the deferred function that recovered.
+func Panic(value any) *PanicError {
+	return &PanicError{Value: value, Stack: debug.Stack()}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Recover, deferred, stops a panic of the calling goroutine, logging and
+// reporting it with tags.
+func Recover(tags map[string]string) {
+	value := recover()
+	if value == nil {
+		return
+	}
+	err := Panic(value)
+	log.Printf("Recovered from %v\n%s", err, err.Stack)
+	Report(err, tags)
+}
+
+// Repanic, deferred, reports a panic of the calling goroutine with tags and
+// waits for the report to be sent before letting the panic crash the
+// process, for goroutines nothing could carry on without.
+func Repanic(tags map[string]string) {
+	value := recover()
+	if value == nil {
+		return
+	}
+	Report(Panic(value), tags)
+	Flush(flushTimeout)
+	panic(value)
+}
@@ -0,0 +1,40 @@
+package errreport
+
+import (
+	"errors"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// Sentry reports to Sentry or any service speaking its protocol, such as
+// GlitchTip.
+type Sentry struct{}
+
+// NewSentry connects to the project of dsn. Every report is tagged with
+// service.
+func NewSentry(dsn, service string) (Sentry, error) {
+	if err := sentry.Init(sentry.ClientOptions{Dsn: dsn}); err != nil {
+		return Sentry{}, err
+	}
+	sentry.ConfigureScope(func(scope *sentry.Scope) {
+		scope.SetTag("service", service)
+	})
+	return Sentry{}, nil
+}
+
+func (Sentry) Report(err error, tags map[string]string) {
+	sentry.WithScope(func(scope *sentry.Scope) {
+		scope.SetTags(tags)
+		var panicErr *PanicError
+		if errors.As(err, &panicErr) {
+			scope.SetLevel(sentry.LevelFatal)
+			scope.SetContext("panic", sentry.Context{"stack": string(panicErr.Stack)})
+		}
+		sentry.CaptureException(err)
+	})
+}
+
+func (Sentry) Flush(timeout time.Duration) {
+	sentry.Flush(timeout)
+}
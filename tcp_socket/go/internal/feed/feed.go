@@ -0,0 +1,115 @@
+// Package feed is where the prices the server broadcasts come from: a
+// PriceSource, be it the random simulator, a replay of a CSV file or an
+// external API.
+package feed
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"ifin/internal/clock"
+)
+
+// Update is one price update, in the JSON form sent to clients.
+type Update struct {
+	Symbol    string  `json:"symbol"`
+	Price     float64 `json:"price"`
+	Timestamp int64   `json:"ts"`  // Generation time, Unix milliseconds
+	Seq       uint64  `json:"seq"` // Per-symbol sequence number, given by the broadcaster's journal
+	ID        string  `json:"id"`  // Correlation ID of the tick, logged by every process handling it
+
+	TraceParent string `json:"traceparent,omitempty"` // Trace context of the tick when sampled, see internal/tracing
+}
+
+// PriceSource produces the updates the server broadcasts. The broadcaster
+// only consumes it, so where prices come from is chosen by configuration
+// without the delivery side changing.
+type PriceSource interface {
+	// Next waits until the next update is due and returns it, with Seq and
+	// TraceParent left for the broadcaster. It returns io.EOF once the
+	// source has no more updates, and the context's error when ctx is done.
+	// Other errors are failed attempts, such as an unreachable API: Next is
+	// called again and waits before retrying.
+	Next(ctx context.Context) (Update, error)
+
+	// Close releases what the source holds open.
+	Close() error
+}
+
+// Symbols are the symbols the simulator quotes.
+var Symbols = []string{"AAPL", "GOOGL", "AMZN", "MSFT", "TSLA"}
+
+// Simulator generates random updates. It is not safe for concurrent use.
+type Simulator struct {
+	rand     *rand.Rand
+	clock    clock.Clock
+	interval time.Duration
+	ticker   clock.Ticker // Started by the first Next
+}
+
+// NewSimulator returns a simulator generating an update every interval of
+// clk, stamped with its time.
+func NewSimulator(clk clock.Clock, interval time.Duration) *Simulator {
+	return &Simulator{rand: rand.New(rand.NewSource(time.Now().UnixNano())), clock: clk, interval: interval}
+}
+
+// Next returns an update of a random symbol at a random price between 100
+// and 200, with a new ID: at once on the first call, then every interval.
+func (s *Simulator) Next(ctx context.Context) (Update, error) {
+	if s.ticker == nil {
+		s.ticker = s.clock.NewTicker(s.interval)
+	} else {
+		select {
+		case <-ctx.Done():
+			return Update{}, ctx.Err()
+		case <-s.ticker.C():
+		}
+	}
+	return Update{
+		Symbol:    Symbols[s.rand.Intn(len(Symbols))],
+		Price:     s.rand.Float64()*100 + 100,
+		Timestamp: s.clock.Now().UnixMilli(),
+		ID:        fmt.Sprintf("%016x", s.rand.Uint64()),
+	}, nil
+}
+
+func (s *Simulator) Close() error {
+	if s.ticker != nil {
+		s.ticker.Stop()
+	}
+	return nil
+}
+
+// Stamp fills in the generation time and ID of an update that came without,
+// as those of a source outside the server do.
+func Stamp(update *Update, clk clock.Clock) {
+	if update.Timestamp == 0 {
+		update.Timestamp = clk.Now().UnixMilli()
+	}
+	if update.ID == "" {
+		update.ID = fmt.Sprintf("%016x", rand.Uint64())
+	}
+}
+
+// wait blocks for d of clk, or until ctx is done.
+func wait(ctx context.Context, clk clock.Clock, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	ticker := clk.NewTicker(d)
+	defer ticker.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-ticker.C():
+		return nil
+	}
+}
+
+var (
+	_ PriceSource = (*Simulator)(nil)
+	_ PriceSource = (*Replay)(nil)
+	_ PriceSource = (*Poller)(nil)
+)
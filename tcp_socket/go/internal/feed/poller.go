@@ -0,0 +1,92 @@
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"ifin/internal/clock"
+)
+
+// FetchFunc gets the current prices from an external API. Updates without a
+// time or ID are given them when fetched.
+type FetchFunc func(ctx context.Context) ([]Update, error)
+
+// Poller is the source of an external API polled every interval: it hands
+// out the updates of a fetch one by one, then fetches again. It is not safe
+// for concurrent use.
+type Poller struct {
+	fetch    FetchFunc
+	clock    clock.Clock
+	interval time.Duration
+	ticker   clock.Ticker // Started by the first fetch
+	queue    []Update     // Fetched but not handed out yet
+}
+
+// NewPoller returns a source calling fetch at once, then every interval of
+// clk.
+func NewPoller(fetch FetchFunc, clk clock.Clock, interval time.Duration) *Poller {
+	return &Poller{fetch: fetch, clock: clk, interval: interval}
+}
+
+// Next returns the next update fetched, fetching when there is none left.
+// A failed fetch is returned and retried on the next call, at the next
+// interval.
+func (p *Poller) Next(ctx context.Context) (Update, error) {
+	for len(p.queue) == 0 {
+		if p.ticker == nil {
+			p.ticker = p.clock.NewTicker(p.interval)
+		} else {
+			select {
+			case <-ctx.Done():
+				return Update{}, ctx.Err()
+			case <-p.ticker.C():
+			}
+		}
+		updates, err := p.fetch(ctx)
+		if err != nil {
+			return Update{}, err
+		}
+		p.queue = updates
+	}
+
+	update := p.queue[0]
+	p.queue = p.queue[1:]
+	Stamp(&update, p.clock)
+	return update, nil
+}
+
+func (p *Poller) Close() error {
+	if p.ticker != nil {
+		p.ticker.Stop()
+	}
+	return nil
+}
+
+// FetchJSON returns a FetchFunc getting url with client, which must answer a
+// JSON array of updates such as [{"symbol":"AAPL","price":190.5}].
+func FetchJSON(client *http.Client, url string) FetchFunc {
+	return func(ctx context.Context) ([]Update, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+		}
+
+		var updates []Update
+		if err := json.NewDecoder(resp.Body).Decode(&updates); err != nil {
+			return nil, fmt.Errorf("GET %s: %w", url, err)
+		}
+		return updates, nil
+	}
+}
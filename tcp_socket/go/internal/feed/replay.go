@@ -0,0 +1,127 @@
+package feed
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"ifin/internal/clock"
+)
+
+// ReplayConfig configures a Replay.
+type ReplayConfig struct {
+	Path     string        // CSV file of symbol,price[,time] rows, optionally under a header
+	Speed    float64       // Replays the recorded gaps this many times faster; 0 ignores them
+	Interval time.Duration // Time between rows without a recorded time, or when Speed is 0
+	Loop     bool          // Starts over at the end instead of returning io.EOF
+}
+
+// Replay plays back recorded prices from a CSV file. Each row is a symbol,
+// a price and optionally when it was recorded, as Unix milliseconds or
+// RFC 3339. Updates are stamped with the time they are replayed, so clients
+// measure their lag from the replay. It is not safe for concurrent use.
+type Replay struct {
+	cfg     ReplayConfig
+	clock   clock.Clock
+	rows    []Update // Timestamp is the recorded time, 0 when there is none
+	next    int      // Index in rows of the next update
+	last    int64    // Recorded time of the previous row replayed
+	started bool     // Whether a row was replayed yet
+}
+
+// NewReplay reads the file of cfg, replaying it on clk.
+func NewReplay(cfg ReplayConfig, clk clock.Clock) (*Replay, error) {
+	f, err := os.Open(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+	var rows []Update
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		row, err := parseRow(record)
+		if err != nil {
+			if line == 1 {
+				continue // A header
+			}
+			return nil, fmt.Errorf("%s line %d: %w", cfg.Path, line, err)
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s: no prices to replay", cfg.Path)
+	}
+	return &Replay{cfg: cfg, clock: clk, rows: rows}, nil
+}
+
+// parseRow reads a symbol,price[,time] row.
+func parseRow(record []string) (Update, error) {
+	if len(record) < 2 || record[0] == "" {
+		return Update{}, errors.New("want symbol,price[,time]")
+	}
+	price, err := strconv.ParseFloat(record[1], 64)
+	if err != nil {
+		return Update{}, fmt.Errorf("price: %w", err)
+	}
+	update := Update{Symbol: strings.ToUpper(record[0]), Price: price}
+	if len(record) > 2 && record[2] != "" {
+		if update.Timestamp, err = strconv.ParseInt(record[2], 10, 64); err != nil {
+			t, err := time.Parse(time.RFC3339, record[2])
+			if err != nil {
+				return Update{}, fmt.Errorf("time: %w", err)
+			}
+			update.Timestamp = t.UnixMilli()
+		}
+	}
+	return update, nil
+}
+
+// Next waits for the gap recorded before the next row, divided by Speed, or
+// Interval, and returns it. The first row is returned at once; a loop
+// starts over after Interval.
+func (r *Replay) Next(ctx context.Context) (Update, error) {
+	if r.next == len(r.rows) {
+		if !r.cfg.Loop {
+			return Update{}, io.EOF
+		}
+		r.next, r.last = 0, 0
+	}
+	row := r.rows[r.next]
+
+	delay := r.cfg.Interval
+	switch {
+	case !r.started:
+		delay = 0
+	case r.cfg.Speed > 0 && row.Timestamp != 0 && r.last != 0:
+		delay = time.Duration(float64(time.Duration(row.Timestamp-r.last)*time.Millisecond) / r.cfg.Speed)
+	}
+	if err := wait(ctx, r.clock, delay); err != nil {
+		return Update{}, err
+	}
+
+	r.started = true
+	r.next++
+	r.last = row.Timestamp
+	row.Timestamp = 0
+	Stamp(&row, r.clock)
+	return row, nil
+}
+
+func (r *Replay) Close() error { return nil }
@@ -0,0 +1,208 @@
+// Package feedtest runs the feed end to end inside one process: feed
+// clients dial a broadcast hub over loopback connections and store what
+// they decode in a store.Memory, so framing, subscriptions, replays and
+// reconnects can be exercised in milliseconds.
+//
+//	h := feedtest.New(100)
+//	defer h.Close()
+//	h.Run(ctx, h.Options())
+//	h.Publish(feed.Update{ID: "1", Symbol: "AAPL", Price: 190})
+//	update, err := h.Wait(ctx, "AAPL", 1)
+package feedtest
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"ifin/internal/broadcast"
+	"ifin/internal/clock"
+	"ifin/internal/feed"
+	"ifin/pkg/feedclient"
+	"ifin/pkg/store"
+)
+
+// Address is the server address in Options; any address dials the hub.
+const Address = "feedtest"
+
+// ErrRefused is returned by DialContext while the harness refuses
+// connections.
+var ErrRefused = errors.New("feedtest: connection refused")
+
+// Harness is a hub serving the clients that dial it, and the store they
+// fill. Create it with New and Close it when done.
+type Harness struct {
+	Hub   *broadcast.Hub
+	Store *store.Memory
+	Clock *clock.Fake // Stamps published updates and times the hub
+
+	mu      sync.Mutex
+	conns   map[net.Conn]struct{} // Server ends of the open connections
+	refused bool
+	wg      sync.WaitGroup // Serving and client goroutines
+}
+
+// New returns a harness whose hub keeps journalSize updates per symbol for
+// replays and whose clock starts at the current time.
+func New(journalSize int) *Harness {
+	clk := clock.NewFake(time.Now())
+	return &Harness{
+		Hub:   broadcast.NewHub(journalSize, clk, nil),
+		Store: store.NewMemory(time.Hour),
+		Clock: clk,
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// DialContext implements feedclient.ContextDialer: it returns the client end
+// of a new loopback connection whose server end the hub serves, whatever
+// the address.
+func (h *Harness) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.refused {
+		return nil, ErrRefused
+	}
+
+	client, server, err := connPair(ctx)
+	if err != nil {
+		return nil, err
+	}
+	h.conns[server] = struct{}{}
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		h.Hub.Serve(server, bufio.NewReader(server))
+		server.Close()
+		h.mu.Lock()
+		delete(h.conns, server)
+		h.mu.Unlock()
+	}()
+	return client, nil
+}
+
+// connPair returns both ends of a new TCP connection over loopback. Unlike
+// net.Pipe, it buffers writes, so a client can send FORMAT and SUBSCRIBE
+// before reading the replies, as it does over the network.
+func connPair(ctx context.Context) (client, server net.Conn, err error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer listener.Close()
+
+	var dialer net.Dialer
+	if client, err = dialer.DialContext(ctx, "tcp", listener.Addr().String()); err != nil {
+		return nil, nil, err
+	}
+	if server, err = listener.Accept(); err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+	return client, server, nil
+}
+
+// Options returns client options dialing the harness, with reconnect delays
+// short enough for tests. Adjust them before passing them to Run.
+func (h *Harness) Options() feedclient.Options {
+	return feedclient.Options{
+		Servers:         []string{Address},
+		Dialer:          h,
+		ReconnectDelay:  10 * time.Millisecond,
+		ReconnectMax:    100 * time.Millisecond,
+		ReconnectStable: time.Second,
+		ClientID:        "feedtest",
+	}
+}
+
+// Run starts a client with opts storing every update it decodes into Store,
+// until ctx is done.
+func (h *Harness) Run(ctx context.Context, opts feedclient.Options) (*feedclient.Client, error) {
+	client, err := feedclient.New(opts)
+	if err != nil {
+		return nil, err
+	}
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		client.Run(ctx, h.Store.Put)
+	}()
+	return client, nil
+}
+
+// Publish sends update to the subscribed clients as the server's
+// broadcaster does, generated at the harness clock's time, and returns it
+// as sent, with its sequence number.
+func (h *Harness) Publish(update feed.Update) feed.Update {
+	if update.Timestamp == 0 {
+		update.Timestamp = h.Clock.Now().UnixMilli()
+	}
+	return h.Hub.Publish(context.Background(), update, h.Clock.Now())
+}
+
+// Connected waits until n clients are registered with the hub, or ctx is
+// done.
+func (h *Harness) Connected(ctx context.Context, n int) error {
+	return poll(ctx, func() bool { return h.Hub.Clients() >= n })
+}
+
+// Wait returns the stored update of symbol once its sequence number reaches
+// seq, or the context's error if ctx is done first.
+func (h *Harness) Wait(ctx context.Context, symbol string, seq uint64) (feedclient.Update, error) {
+	var update feedclient.Update
+	err := poll(ctx, func() bool {
+		latest, ok, _ := h.Store.GetLatest(ctx, symbol)
+		update = latest
+		return ok && latest.Seq >= seq
+	})
+	return update, err
+}
+
+// Disconnect drops every open connection from the server side, as a server
+// restart would, leaving clients to reconnect.
+func (h *Harness) Disconnect() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for conn := range h.conns {
+		conn.Close()
+	}
+}
+
+// Refuse makes dials fail with ErrRefused while refuse is true, as when the
+// server is down.
+func (h *Harness) Refuse(refuse bool) {
+	h.mu.Lock()
+	h.refused = refuse
+	h.mu.Unlock()
+}
+
+// Close refuses new connections, drops the open ones and waits for the
+// clients started by Run to return, so their contexts must be done.
+func (h *Harness) Close() {
+	h.Refuse(true)
+	h.Disconnect()
+	h.wg.Wait()
+}
+
+// pollInterval is how often Wait and Connected check their condition
+const pollInterval = 5 * time.Millisecond
+
+// poll waits until done returns true, or ctx is done.
+func poll(ctx context.Context, done func() bool) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for !done() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package feedtest_test
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"ifin/internal/feed"
+	"ifin/internal/feedtest"
+	"ifin/pkg/codec"
+	"ifin/pkg/feedclient"
+)
+
+// start returns a harness and a context ended, and the harness closed, when
+// the test is done.
+func start(t *testing.T, journalSize int) (*feedtest.Harness, context.Context) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	h := feedtest.New(journalSize)
+	t.Cleanup(func() {
+		cancel()
+		h.Close()
+	})
+	return h, ctx
+}
+
+// run starts a client with opts and waits until the hub has n clients.
+func run(t *testing.T, ctx context.Context, h *feedtest.Harness, opts feedclient.Options, n int) *feedclient.Client {
+	t.Helper()
+	client, err := h.Run(ctx, opts)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if err := h.Connected(ctx, n); err != nil {
+		t.Fatalf("waiting for %d clients: %v", n, err)
+	}
+	return client
+}
+
+// subscribed waits until a client of the hub has subscribed to symbols.
+func subscribed(t *testing.T, ctx context.Context, h *feedtest.Harness, symbols []string) {
+	t.Helper()
+	err := poll(ctx, func() bool {
+		found := false
+		h.Hub.Each(func(conn net.Conn, subscribed []string) {
+			found = found || slices.Equal(subscribed, symbols)
+		})
+		return found
+	})
+	if err != nil {
+		t.Fatalf("waiting for a client to subscribe to %v: %v", symbols, err)
+	}
+}
+
+// wait returns the stored update of symbol once it reaches seq.
+func wait(t *testing.T, ctx context.Context, h *feedtest.Harness, symbol string, seq uint64) feedclient.Update {
+	t.Helper()
+	update, err := h.Wait(ctx, symbol, seq)
+	if err != nil {
+		t.Fatalf("waiting for %s #%d: %v (latest %+v)", symbol, seq, err, update)
+	}
+	return update
+}
+
+func TestFraming(t *testing.T) {
+	for _, format := range codec.Names() {
+		t.Run(format, func(t *testing.T) {
+			h, ctx := start(t, 10)
+			opts := h.Options()
+			opts.Format = format
+			opts.Symbols = []string{"AAPL", "MSFT"}
+			client := run(t, ctx, h, opts, 1)
+			// FORMAT is sent before SUBSCRIBE, so it has been applied too
+			subscribed(t, ctx, h, opts.Symbols)
+
+			sent := []feed.Update{
+				{ID: "a1", Symbol: "AAPL", Price: 190.25},
+				{ID: "m1", Symbol: "MSFT", Price: 410.5},
+				{ID: "a2", Symbol: "AAPL", Price: 191.75},
+			}
+			var published []feed.Update
+			for _, update := range sent {
+				published = append(published, h.Publish(update))
+			}
+
+			for _, want := range []feed.Update{published[1], published[2]} {
+				got := wait(t, ctx, h, want.Symbol, want.Seq)
+				if got.ID != want.ID || got.Price != want.Price || got.Timestamp != want.Timestamp || got.Seq != want.Seq {
+					t.Errorf("stored %+v, want %+v", got, want)
+				}
+			}
+			if stats := client.Stats(); stats.DecodeErrors != 0 || stats.Messages != uint64(len(sent)) {
+				t.Errorf("stats %+v, want %d messages and no decode errors", stats, len(sent))
+			}
+		})
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	h, ctx := start(t, 10)
+	opts := h.Options()
+	opts.Symbols = []string{"MSFT"}
+	client := run(t, ctx, h, opts, 1)
+	subscribed(t, ctx, h, opts.Symbols)
+
+	h.Publish(feed.Update{ID: "a1", Symbol: "AAPL", Price: 190})
+	msft := h.Publish(feed.Update{ID: "m1", Symbol: "MSFT", Price: 410})
+
+	wait(t, ctx, h, "MSFT", msft.Seq)
+	if _, ok, _ := h.Store.GetLatest(ctx, "AAPL"); ok {
+		t.Error("AAPL was delivered to a client subscribed to MSFT only")
+	}
+	if got := client.Stats().Messages; got != 1 {
+		t.Errorf("received %d updates, want 1", got)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	h, ctx := start(t, 10)
+	client := run(t, ctx, h, h.Options(), 1)
+	first := h.Publish(feed.Update{ID: "a1", Symbol: "AAPL", Price: 190})
+	wait(t, ctx, h, "AAPL", first.Seq)
+
+	// The server goes away for a while, then comes back
+	h.Refuse(true)
+	h.Disconnect()
+	if err := poll(ctx, func() bool { return h.Hub.Clients() == 0 }); err != nil {
+		t.Fatalf("waiting for the client to be dropped: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond) // A few failed attempts
+	h.Refuse(false)
+	if err := h.Connected(ctx, 1); err != nil {
+		t.Fatalf("waiting for the client to reconnect: %v", err)
+	}
+
+	second := h.Publish(feed.Update{ID: "a2", Symbol: "AAPL", Price: 191})
+	if got := wait(t, ctx, h, "AAPL", second.Seq); got.ID != "a2" {
+		t.Errorf("stored %+v after reconnecting, want a2", got)
+	}
+	if connects := client.Stats().Connects; connects != 2 {
+		t.Errorf("%d connections, want 2", connects)
+	}
+}
+
+func TestGapRecovery(t *testing.T) {
+	h, ctx := start(t, 10)
+	opts := h.Options()
+	opts.GapRecovery = true
+	run(t, ctx, h, opts, 1)
+	first := h.Publish(feed.Update{ID: "a1", Symbol: "AAPL", Price: 190})
+	wait(t, ctx, h, "AAPL", first.Seq)
+
+	// Two updates are published while the client is disconnected
+	h.Refuse(true)
+	h.Disconnect()
+	if err := poll(ctx, func() bool { return h.Hub.Clients() == 0 }); err != nil {
+		t.Fatalf("waiting for the client to be dropped: %v", err)
+	}
+	h.Publish(feed.Update{ID: "a2", Symbol: "AAPL", Price: 191})
+	h.Publish(feed.Update{ID: "a3", Symbol: "AAPL", Price: 192})
+	h.Refuse(false)
+	if err := h.Connected(ctx, 1); err != nil {
+		t.Fatalf("waiting for the client to reconnect: %v", err)
+	}
+
+	// The next live update reveals the gap, and the client asks for a
+	// REPLAY of the two it missed
+	last := h.Publish(feed.Update{ID: "a4", Symbol: "AAPL", Price: 193})
+	wait(t, ctx, h, "AAPL", last.Seq)
+
+	history, err := h.Store.History(ctx, "AAPL", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	var ids []string
+	for _, update := range history {
+		ids = append(ids, update.ID)
+	}
+	if want := []string{"a1", "a2", "a3", "a4"}; !slices.Equal(ids, want) {
+		t.Errorf("stored %v, want %v", ids, want)
+	}
+}
+
+func TestReplayBeyondJournal(t *testing.T) {
+	h, ctx := start(t, 2)
+	opts := h.Options()
+	opts.GapRecovery = true
+	run(t, ctx, h, opts, 1)
+	first := h.Publish(feed.Update{ID: "a1", Symbol: "AAPL", Price: 190})
+	wait(t, ctx, h, "AAPL", first.Seq)
+
+	h.Refuse(true)
+	h.Disconnect()
+	if err := poll(ctx, func() bool { return h.Hub.Clients() == 0 }); err != nil {
+		t.Fatalf("waiting for the client to be dropped: %v", err)
+	}
+	for _, id := range []string{"a2", "a3", "a4"} {
+		h.Publish(feed.Update{ID: id, Symbol: "AAPL", Price: 191})
+	}
+	h.Refuse(false)
+	if err := h.Connected(ctx, 1); err != nil {
+		t.Fatalf("waiting for the client to reconnect: %v", err)
+	}
+
+	// Only the journal's last two updates, a4 and a5, can be replayed
+	last := h.Publish(feed.Update{ID: "a5", Symbol: "AAPL", Price: 192})
+	wait(t, ctx, h, "AAPL", last.Seq)
+	history, err := h.Store.History(ctx, "AAPL", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	var ids []string
+	for _, update := range history {
+		ids = append(ids, update.ID)
+	}
+	if want := []string{"a1", "a4", "a5"}; !slices.Equal(ids, want) {
+		t.Errorf("stored %v, want %v", ids, want)
+	}
+}
+
+// poll waits until done returns true, or ctx is done.
+func poll(ctx context.Context, done func() bool) error {
+	for !done() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	return nil
+}
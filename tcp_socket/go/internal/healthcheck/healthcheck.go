@@ -0,0 +1,75 @@
+// Package healthcheck implements the healthcheck subcommands, which probe a
+// running process from inside its container and tell through their exit
+// status whether it is healthy, for Docker's HEALTHCHECK and the like.
+package healthcheck
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Timeout bounds each probe
+const Timeout = 3 * time.Second
+
+// LocalAddr turns a listen address such as ":8080" or "0.0.0.0:8080" into
+// one to dial on the loopback interface.
+func LocalAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// HTTP GETs path on the server listening on addr, over HTTPS when secure,
+// and fails unless it answers 200 OK. The certificate is not verified: it
+// is issued for the public name, not for the loopback address.
+func HTTP(addr, path string, secure bool) error {
+	scheme := "http"
+	if secure {
+		scheme = "https"
+	}
+	client := &http.Client{
+		Timeout:   Timeout,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	resp, err := client.Get(scheme + "://" + LocalAddr(addr) + path)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", path, resp.Status)
+	}
+	return nil
+}
+
+// Dial connects to the server listening on addr and hangs up.
+func Dial(network, addr string) error {
+	if network != "unix" {
+		addr = LocalAddr(addr)
+	}
+	conn, err := net.DialTimeout(network, addr, Timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Exit reports the outcome of a probe and exits: 0 when err is nil, 1
+// otherwise.
+func Exit(err error) {
+	if err != nil {
+		fmt.Println("Unhealthy:", err)
+		os.Exit(1)
+	}
+	fmt.Println("Healthy")
+	os.Exit(0)
+}
@@ -0,0 +1,35 @@
+// Package hooks runs user code at fixed points of the message pipeline, such
+// as before an update is broadcast or stored, for enrichment, filtering or
+// auditing without changing the code around those points.
+package hooks
+
+import (
+	"context"
+	"errors"
+)
+
+// Skip, returned by a hook, drops the value quietly: the hooks after it do
+// not run and no error is logged.
+var Skip = errors.New("skipped by hook")
+
+// Hook is run on a value it may modify. An error stops the chain and drops
+// the value.
+type Hook[T any] func(ctx context.Context, v *T) error
+
+// Chain is a list of hooks run in order. The zero value runs nothing.
+type Chain[T any] []Hook[T]
+
+// Add appends hook to the chain.
+func (c *Chain[T]) Add(hook Hook[T]) {
+	*c = append(*c, hook)
+}
+
+// Run runs the hooks on v until one fails, and returns its error.
+func (c Chain[T]) Run(ctx context.Context, v *T) error {
+	for _, hook := range c {
+		if err := hook(ctx, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
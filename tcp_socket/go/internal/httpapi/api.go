@@ -0,0 +1,286 @@
+package httpapi
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"ifin/internal/clock"
+	"ifin/pkg/feedclient"
+	"ifin/pkg/store"
+)
+
+// snapshotMaxAge is how long clients and proxies may reuse a snapshot; prices
+// move too fast for longer
+const snapshotMaxAge = "max-age=1"
+
+// priceFields are the fields of a price that fields= can pick
+var priceFields = []string{"symbol", "price", "ts", "seq", "stale"}
+
+// listQuery is how a list endpoint was asked to sort, page and shape its
+// result: ?sort=-price&offset=100&limit=50&fields=symbol,price.
+type listQuery struct {
+	sort       string // symbol, price or ts; "" keeps the endpoint's order
+	descending bool   // The sort key was prefixed with -
+	offset     int
+	limit      int      // 0 for no limit
+	fields     []string // Nil for every field
+}
+
+// parseListQuery reads the list parameters, allowing limit up to maxLimit.
+func parseListQuery(query url.Values, maxLimit int) (listQuery, error) {
+	var q listQuery
+	if sort := query.Get("sort"); sort != "" {
+		q.sort, q.descending = strings.CutPrefix(sort, "-")
+		if q.sort != "symbol" && q.sort != "price" && q.sort != "ts" {
+			return q, errors.New("sort must be symbol, price or ts, optionally prefixed with -")
+		}
+	}
+	var err error
+	if value := query.Get("offset"); value != "" {
+		if q.offset, err = strconv.Atoi(value); err != nil || q.offset < 0 {
+			return q, errors.New("invalid offset")
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		if q.limit, err = strconv.Atoi(value); err != nil || q.limit < 1 || q.limit > maxLimit {
+			return q, fmt.Errorf("limit must be between 1 and %d", maxLimit)
+		}
+	}
+	q.fields, err = parseFields(query)
+	return q, err
+}
+
+// parseFields reads the fields parameter, returning nil when it is unset.
+func parseFields(query url.Values) ([]string, error) {
+	fields := splitList(query.Get("fields"))
+	for _, field := range fields {
+		if !slices.Contains(priceFields, field) {
+			return nil, fmt.Errorf("unknown field %q, expected some of %s", field, strings.Join(priceFields, ","))
+		}
+	}
+	return fields, nil
+}
+
+// sortUpdates orders updates as asked in q, keeping their order when q has
+// no sort key.
+func (q listQuery) sortUpdates(updates []feedclient.Update) {
+	var compare func(a, b feedclient.Update) int
+	switch q.sort {
+	case "symbol":
+		compare = func(a, b feedclient.Update) int { return cmp.Compare(a.Symbol, b.Symbol) }
+	case "price":
+		compare = func(a, b feedclient.Update) int { return cmp.Compare(a.Price, b.Price) }
+	case "ts":
+		compare = func(a, b feedclient.Update) int { return cmp.Compare(a.Timestamp, b.Timestamp) }
+	default:
+		return
+	}
+	if q.descending {
+		ascending := compare
+		compare = func(a, b feedclient.Update) int { return ascending(b, a) }
+	}
+	slices.SortStableFunc(updates, compare)
+}
+
+// page returns the items of updates in the page asked for by q, and whether
+// more follow.
+func (q listQuery) page(updates []feedclient.Update) ([]feedclient.Update, bool) {
+	if q.offset >= len(updates) {
+		return nil, false
+	}
+	updates = updates[q.offset:]
+	if q.limit > 0 && len(updates) > q.limit {
+		return updates[:q.limit], true
+	}
+	return updates, false
+}
+
+// selectFields returns items, a slice of objects, keeping only fields in
+// each object unless fields is nil.
+func selectFields(items any, fields []string) (any, error) {
+	if fields == nil {
+		return items, nil
+	}
+	body, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	var objects []map[string]any
+	if err := json.Unmarshal(body, &objects); err != nil {
+		return nil, err
+	}
+	for _, object := range objects {
+		for name := range object {
+			if !slices.Contains(fields, name) {
+				delete(object, name)
+			}
+		}
+	}
+	return objects, nil
+}
+
+// maxPricesLimit caps a page of /api/prices
+const maxPricesLimit = 10000
+
+// pricesHandler serves /api/prices: the latest price of every symbol as
+// an array, flagged stale like the /sse events. It is encoded in JSON, or
+// the format the Accept header asks for. It is sorted by symbol unless sort
+// says otherwise, and may be paged and cut down to some fields (see
+// listQuery); X-Total-Count is the number of symbols, and a Link header
+// points to the next page. The response may be cached for a second; its
+// ETag (a hash of the body) and Last-Modified (the newest timestamp) let
+// pollers send If-None-Match or If-Modified-Since and get 304 Not Modified
+// when nothing changed.
+func pricesHandler(st store.Store, staleAfter time.Duration, clk clock.Clock) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseListQuery(r.URL.Query(), maxPricesLimit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		updates, err := st.GetAll(r.Context())
+		if err != nil {
+			http.Error(w, "prices unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		var newest int64
+		for _, update := range updates {
+			newest = max(newest, update.Timestamp)
+		}
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(updates)))
+		q.sortUpdates(updates)
+		updates, more := q.page(updates)
+		if more {
+			next := r.URL.Query()
+			next.Set("offset", strconv.Itoa(q.offset+len(updates)))
+			w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, externalPath(r), next.Encode()))
+		}
+
+		items, err := selectFields(MarkStale(updates, staleAfter, clk.Now()), q.fields)
+		if err != nil {
+			http.Error(w, "error encoding prices", http.StatusInternalServerError)
+			return
+		}
+		serveEncoded(w, r, items, nil, newest)
+	}
+}
+
+// symbolPrice is the /api/prices/{symbol} response.
+type symbolPrice struct {
+	PriceView
+	AgeMs int64 `json:"age_ms,omitempty"` // Time since the update was generated
+}
+
+// symbolPriceHandler serves /api/prices/{symbol}: the symbol's latest price,
+// timestamp, age and staleness, or 404 for a symbol never seen. It is
+// encoded and cached like /api/prices.
+func symbolPriceHandler(st store.Store, staleAfter time.Duration, clk clock.Clock) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		update, ok, err := st.GetLatest(r.Context(), r.PathValue("symbol"))
+		if err != nil {
+			http.Error(w, "prices unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if !ok {
+			http.Error(w, "unknown symbol", http.StatusNotFound)
+			return
+		}
+
+		now := clk.Now()
+		price := symbolPrice{PriceView: MarkStale([]feedclient.Update{update}, staleAfter, now)[0]}
+		if update.Timestamp != 0 {
+			price.AgeMs = now.Sub(time.UnixMilli(update.Timestamp)).Milliseconds()
+		}
+		// age_ms changes on every request, so it is left out of the ETag
+		serveEncoded(w, r, price, price.PriceView, update.Timestamp)
+	}
+}
+
+// serveEncoded writes v in the format negotiated for r, with the caching
+// headers of the /api endpoints, or 304 Not Modified when the validators of
+// a conditional GET or HEAD match. The ETag hashes validator encoded the same
+// way, so fields that change on every request can be left out of it, or v
+// itself when validator is nil. modified is the newest timestamp in v, in
+// Unix milliseconds, or 0 when unknown.
+func serveEncoded(w http.ResponseWriter, r *http.Request, v, validator any, modified int64) {
+	format := negotiate(w, r)
+	body, err := format.Marshal(v)
+	if err != nil {
+		http.Error(w, "error encoding response", http.StatusInternalServerError)
+		return
+	}
+	tagged := body
+	if validator != nil {
+		if tagged, err = format.Marshal(validator); err != nil {
+			http.Error(w, "error encoding response", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	h := w.Header()
+	h.Set("Cache-Control", snapshotMaxAge)
+	etag := contentETag(tagged)
+	h.Set("ETag", etag)
+	var modtime time.Time
+	if modified > 0 {
+		modtime = time.UnixMilli(modified)
+		h.Set("Last-Modified", modtime.UTC().Format(http.TimeFormat))
+	}
+	if (r.Method == http.MethodGet || r.Method == http.MethodHead) && notModified(r, etag, modtime) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Set("Content-Type", format.ContentType())
+	w.Write(body)
+}
+
+// notModified reports whether the If-None-Match or, without it, the
+// If-Modified-Since header of r shows the client has the response tagged
+// etag and last modified at modtime (zero when unknown).
+func notModified(r *http.Request, etag string, modtime time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		// Weak comparison, as for any GET
+		for _, tag := range strings.Split(match, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || modtime.IsZero() {
+		return false
+	}
+	// The header has whole seconds only
+	return !modtime.Truncate(time.Second).After(since)
+}
+
+// contentETag returns a weak entity tag hashing body. It is weak because
+// compressMiddleware may send the same body in several encodings.
+func contentETag(body []byte) string {
+	h := fnv.New64a()
+	h.Write(body)
+	return fmt.Sprintf(`W/"%016x"`, h.Sum64())
+}
+
+// splitList splits a comma-separated parameter, dropping empty items.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
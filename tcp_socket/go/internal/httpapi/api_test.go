@@ -0,0 +1,108 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ifin/internal/clock"
+	"ifin/pkg/feedclient"
+	"ifin/pkg/store"
+)
+
+func TestPricesStaleByClock(t *testing.T) {
+	clk := clock.NewFake(time.UnixMilli(1_700_000_000_000))
+	st := store.NewMemory(time.Hour)
+	st.Put(context.Background(), feedclient.Update{Symbol: "AAPL", Price: 190, Timestamp: clk.Now().UnixMilli()})
+	handler := pricesHandler(st, 10*time.Second, clk)
+
+	get := func() []PriceView {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/prices", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		var views []PriceView
+		if err := json.Unmarshal(rec.Body.Bytes(), &views); err != nil {
+			t.Fatalf("decoding %s: %v", rec.Body, err)
+		}
+		return views
+	}
+
+	if views := get(); len(views) != 1 || views[0].Stale {
+		t.Fatalf("got %+v, want one fresh price", views)
+	}
+	clk.Advance(11 * time.Second)
+	if views := get(); len(views) != 1 || !views[0].Stale {
+		t.Fatalf("got %+v after 11s, want one stale price", views)
+	}
+}
+
+func TestSymbolPriceAgeByClock(t *testing.T) {
+	clk := clock.NewFake(time.UnixMilli(1_700_000_000_000))
+	st := store.NewMemory(time.Hour)
+	st.Put(context.Background(), feedclient.Update{Symbol: "AAPL", Price: 190, Timestamp: clk.Now().UnixMilli()})
+	clk.Advance(1500 * time.Millisecond)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/prices/{symbol}", symbolPriceHandler(st, time.Second, clk))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/prices/AAPL", nil))
+
+	var price symbolPrice
+	if err := json.Unmarshal(rec.Body.Bytes(), &price); err != nil {
+		t.Fatalf("decoding %s: %v", rec.Body, err)
+	}
+	if price.AgeMs != 1500 || !price.Stale {
+		t.Errorf("got age %dms, stale %v; want 1500ms and stale", price.AgeMs, price.Stale)
+	}
+}
+
+func TestSymbolPriceNotModifiedAsItAges(t *testing.T) {
+	clk := clock.NewFake(time.UnixMilli(1_700_000_000_000))
+	st := store.NewMemory(time.Hour)
+	st.Put(context.Background(), feedclient.Update{Symbol: "AAPL", Price: 190, Timestamp: clk.Now().UnixMilli()})
+	mux := http.NewServeMux()
+	mux.Handle("/api/prices/{symbol}", symbolPriceHandler(st, time.Minute, clk))
+	get := func(header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/prices/AAPL", nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := get(nil)
+	etag, modified := first.Header().Get("ETag"), first.Header().Get("Last-Modified")
+	if first.Code != http.StatusOK || etag == "" || modified == "" {
+		t.Fatalf("status %d, ETag %q, Last-Modified %q; want 200 with both validators", first.Code, etag, modified)
+	}
+
+	// age_ms has changed, but not the price
+	clk.Advance(2 * time.Second)
+	for _, header := range []http.Header{
+		{"If-None-Match": {etag}},
+		{"If-Modified-Since": {modified}},
+		{"If-None-Match": {etag}, "Range": {"bytes=0-3"}},
+	} {
+		if rec := get(header); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+			t.Errorf("%v: status %d with %q, want 304 and no body", header, rec.Code, rec.Body)
+		}
+	}
+
+	// A range is not served, only the whole price
+	if rec := get(http.Header{"Range": {"bytes=0-3"}}); rec.Code != http.StatusOK || !json.Valid(rec.Body.Bytes()) {
+		t.Errorf("Range: status %d with %q, want 200 and the whole price", rec.Code, rec.Body)
+	}
+
+	st.Put(context.Background(), feedclient.Update{Symbol: "AAPL", Price: 191, Timestamp: clk.Now().UnixMilli()})
+	if rec := get(http.Header{"If-None-Match": {etag}}); rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Errorf("after a new price: status %d, ETag %q; want 200 with a new ETag", rec.Code, rec.Header().Get("ETag"))
+	}
+}
@@ -0,0 +1,96 @@
+package httpapi
+
+import (
+	"net/http"
+	"time"
+
+	"ifin/pkg/feedclient"
+	"ifin/pkg/store"
+)
+
+// defaultCandleInterval is the candle length when none is asked for
+const defaultCandleInterval = time.Minute
+
+// candle summarises the updates of one interval.
+type candle struct {
+	Time  int64   `json:"time"` // Start of the interval, Unix milliseconds
+	Open  float64 `json:"open"`
+	High  float64 `json:"high"`
+	Low   float64 `json:"low"`
+	Close float64 `json:"close"`
+	Count int     `json:"count"` // Updates in the interval
+}
+
+// candlesHandler serves /api/candles/{symbol}?interval=1m&from=&to=: OHLC
+// candles built from the symbol's history, oldest first, as a JSON array.
+// Intervals are counted from the Unix epoch and those without updates are
+// left out.
+func candlesHandler(st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		from, to, err := parseRange(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		interval := defaultCandleInterval
+		if value := query.Get("interval"); value != "" {
+			interval, err = time.ParseDuration(value)
+			if err != nil || interval < time.Second {
+				http.Error(w, "interval must be a duration of at least 1s", http.StatusBadRequest)
+				return
+			}
+		}
+
+		updates, err := st.History(r.Context(), r.PathValue("symbol"), from, to)
+		if err != nil {
+			http.Error(w, "history unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		writeEncoded(w, r, buildCandles(updates, interval))
+	}
+}
+
+// buildCandles aggregates updates, oldest first, into candles of interval.
+func buildCandles(updates []feedclient.Update, interval time.Duration) []candle {
+	candles := []candle{} // Encode as [] rather than null
+	for _, update := range updates {
+		if n := len(candles); n > 0 && candles[n-1].add(update, interval) {
+			continue
+		}
+		candles = append(candles, newCandle(update, interval))
+	}
+	return candles
+}
+
+// newCandle starts the candle of interval that update falls in.
+func newCandle(update feedclient.Update, interval time.Duration) candle {
+	return candle{
+		Time:  candleStart(update, interval),
+		Open:  update.Price,
+		High:  update.Price,
+		Low:   update.Price,
+		Close: update.Price,
+		Count: 1,
+	}
+}
+
+// add adds update to the candle and reports true when it falls in the
+// candle's interval; otherwise the candle is left as it is.
+func (c *candle) add(update feedclient.Update, interval time.Duration) bool {
+	if candleStart(update, interval) != c.Time {
+		return false
+	}
+	c.High = max(c.High, update.Price)
+	c.Low = min(c.Low, update.Price)
+	c.Close = update.Price
+	c.Count++
+	return true
+}
+
+// candleStart returns the start of the interval update falls in.
+func candleStart(update feedclient.Update, interval time.Duration) int64 {
+	ms := interval.Milliseconds()
+	return update.Timestamp - update.Timestamp%ms
+}
@@ -0,0 +1,77 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+)
+
+// CORSPolicy decides which browser origins may call the HTTP endpoints.
+type CORSPolicy struct {
+	origins map[string]bool // Allowed origins; "*" allows any
+	methods string
+	headers string
+}
+
+// NewCORSPolicy builds a policy from comma-separated lists.
+func NewCORSPolicy(origins, methods, headers string) *CORSPolicy {
+	p := &CORSPolicy{
+		origins: make(map[string]bool),
+		methods: joinList(methods),
+		headers: joinList(headers),
+	}
+	for _, origin := range strings.Split(origins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			p.origins[strings.TrimSuffix(origin, "/")] = true
+		}
+	}
+	return p
+}
+
+// allowOrigin returns the value for Access-Control-Allow-Origin, or "" when
+// the origin is not allowed.
+func (p *CORSPolicy) allowOrigin(origin string) string {
+	switch {
+	case origin == "":
+		return ""
+	case p.origins["*"]:
+		return "*"
+	case p.origins[origin]:
+		return origin
+	default:
+		return ""
+	}
+}
+
+// corsMiddleware sets CORS headers for allowed origins and answers preflight
+// requests itself, so handlers only ever see the real request.
+func corsMiddleware(policy *CORSPolicy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		allowed := policy.allowOrigin(origin)
+
+		w.Header().Add("Vary", "Origin")
+		if allowed != "" {
+			w.Header().Set("Access-Control-Allow-Origin", allowed)
+		}
+
+		// Preflight: OPTIONS carrying Access-Control-Request-Method
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if allowed == "" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Methods", policy.methods)
+			w.Header().Set("Access-Control-Allow-Headers", policy.headers)
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// joinList normalises a comma-separated list to the "a, b" header form.
+func joinList(list string) string {
+	return strings.Join(splitList(list), ", ")
+}
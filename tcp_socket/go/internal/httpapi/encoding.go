@@ -0,0 +1,26 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"ifin/pkg/codec"
+)
+
+// negotiate returns the codec of the response to r: JSON, unless the Accept
+// header prefers another registered format.
+func negotiate(w http.ResponseWriter, r *http.Request) codec.Codec {
+	w.Header().Add("Vary", "Accept")
+	return codec.Negotiate(r.Header.Get("Accept"))
+}
+
+// writeEncoded writes v in the format negotiated for r.
+func writeEncoded(w http.ResponseWriter, r *http.Request, v any) {
+	format := negotiate(w, r)
+	body, err := format.Marshal(v)
+	if err != nil {
+		http.Error(w, "error encoding response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Write(body)
+}
@@ -0,0 +1,248 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+
+	"ifin/internal/clock"
+	"ifin/pkg/feedclient"
+	"ifin/pkg/store"
+)
+
+// graphQLSchema is served on /graphql. Timestamps and sequence numbers are
+// Floats, as GraphQL's Int is only 32 bits.
+const graphQLSchema = `
+schema {
+	query: Query
+	subscription: Subscription
+}
+
+type Query {
+	"Latest price of every symbol, or of the symbols given"
+	prices(symbols: [String!]): [Price!]!
+	"Latest price of one symbol, null if it was never seen"
+	price(symbol: String!): Price
+	"A symbol's history between from and to (Unix milliseconds or RFC 3339), oldest first"
+	history(symbol: String!, from: String, to: String): [Price!]!
+}
+
+type Subscription {
+	"Every update, or those of the symbols given, as it arrives"
+	ticks(symbols: [String!]): Price!
+}
+
+type Price {
+	symbol: String!
+	price: Float!
+	"Generation time, Unix milliseconds"
+	ts: Float!
+	seq: Float!
+	"Older than -stale-after"
+	stale: Boolean!
+}
+`
+
+// graphQLResolver resolves the Query and Subscription fields of
+// graphQLSchema.
+type graphQLResolver struct {
+	st         store.Store
+	staleAfter time.Duration
+	clock      clock.Clock
+}
+
+// gqlPrice resolves a Price.
+type gqlPrice struct{ view PriceView }
+
+func (p gqlPrice) Symbol() string { return p.view.Symbol }
+func (p gqlPrice) Price() float64 { return p.view.Price }
+func (p gqlPrice) Ts() float64    { return float64(p.view.Timestamp) }
+func (p gqlPrice) Seq() float64   { return float64(p.view.Seq) }
+func (p gqlPrice) Stale() bool    { return p.view.Stale }
+
+func (r *graphQLResolver) prices(updates []feedclient.Update) []gqlPrice {
+	prices := make([]gqlPrice, len(updates))
+	for i, view := range MarkStale(updates, r.staleAfter, r.clock.Now()) {
+		prices[i] = gqlPrice{view}
+	}
+	return prices
+}
+
+func (r *graphQLResolver) Prices(ctx context.Context, args struct{ Symbols *[]string }) ([]gqlPrice, error) {
+	updates, err := r.st.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if args.Symbols != nil {
+		updates = NewSymbolFilter(*args.Symbols).Apply(updates)
+	}
+	return r.prices(updates), nil
+}
+
+func (r *graphQLResolver) Price(ctx context.Context, args struct{ Symbol string }) (*gqlPrice, error) {
+	update, ok, err := r.st.GetLatest(ctx, args.Symbol)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &r.prices([]feedclient.Update{update})[0], nil
+}
+
+func (r *graphQLResolver) History(ctx context.Context, args struct {
+	Symbol   string
+	From, To *string
+}) ([]gqlPrice, error) {
+	var from, to time.Time
+	var err error
+	if args.From != nil {
+		if from, err = ParseTime(*args.From); err != nil {
+			return nil, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+	if args.To != nil {
+		if to, err = ParseTime(*args.To); err != nil {
+			return nil, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	updates, err := r.st.History(ctx, args.Symbol, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return r.prices(updates), nil
+}
+
+func (r *graphQLResolver) Ticks(ctx context.Context, args struct{ Symbols *[]string }) (<-chan gqlPrice, error) {
+	updates, err := r.st.Subscribe(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var filter SymbolFilter
+	if args.Symbols != nil {
+		filter = NewSymbolFilter(*args.Symbols)
+	}
+
+	ticks := make(chan gqlPrice)
+	go func() {
+		defer close(ticks)
+		for update := range updates { // Closed when ctx is done
+			if !filter.Allows(update.Symbol) {
+				continue
+			}
+			select {
+			case ticks <- r.prices([]feedclient.Update{update})[0]:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ticks, nil
+}
+
+// graphQLRequest is a GraphQL request, sent as the JSON body of a POST or
+// as the parameters of a GET.
+type graphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// graphQLHandler serves /graphql. Queries are answered with JSON; a request
+// accepting text/event-stream runs a subscription and streams each result as
+// a "next" event, then "complete" when it ends (GraphQL over SSE), counted
+// in metrics and listed by its StreamsHandler while it runs.
+func graphQLHandler(st store.Store, staleAfter time.Duration, clk clock.Clock, metrics *Metrics) http.HandlerFunc {
+	schema := graphql.MustParseSchema(graphQLSchema, &graphQLResolver{st: st, staleAfter: staleAfter, clock: clk})
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req graphQLRequest
+		switch r.Method {
+		case http.MethodGet:
+			query := r.URL.Query()
+			req.Query = query.Get("query")
+			req.OperationName = query.Get("operationName")
+			if variables := query.Get("variables"); variables != "" {
+				if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+					http.Error(w, "invalid variables: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+		case http.MethodPost:
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+				http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !wantsEventStream(r) {
+			response := schema.Exec(r.Context(), req.Query, req.OperationName, req.Variables)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming unsupported!", http.StatusInternalServerError)
+			return
+		}
+		results, err := schema.Subscribe(r.Context(), req.Query, req.OperationName, req.Variables)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		metrics.streams.Add(1)
+		defer metrics.streams.Add(-1)
+		stats := metrics.openStream(r)
+		defer metrics.closeStream(stats)
+		for result := range results { // Closed when the subscription ends
+			payload, err := json.Marshal(result)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: next\ndata: %s\n\n", payload)
+			flusher.Flush()
+		}
+		fmt.Fprint(w, "event: complete\ndata:\n\n")
+		flusher.Flush()
+	}
+}
+
+// wantsEventStream reports whether r asks for a subscription streamed as
+// server-sent events: its Accept headers list text/event-stream with a
+// quality above zero and at least that of application/json.
+func wantsEventStream(r *http.Request) bool {
+	stream, query := 0.0, 0.0
+	for _, header := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(header, ",") {
+			mediaType, params, err := mime.ParseMediaType(part)
+			if err != nil {
+				continue
+			}
+			q := 1.0
+			if value, ok := params["q"]; ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+			switch mediaType {
+			case "text/event-stream":
+				stream = max(stream, q)
+			case "application/json":
+				query = max(query, q)
+			}
+		}
+	}
+	return stream > 0 && stream >= query
+}
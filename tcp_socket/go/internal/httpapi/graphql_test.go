@@ -0,0 +1,33 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWantsEventStream(t *testing.T) {
+	for _, tt := range []struct {
+		accept []string
+		want   bool
+	}{
+		{nil, false},
+		{[]string{"application/json"}, false},
+		{[]string{"*/*"}, false},
+		{[]string{"text/event-stream"}, true},
+		{[]string{"Text/Event-Stream; charset=utf-8"}, true},
+		{[]string{"text/event-stream, application/json"}, true},
+		{[]string{"application/json;q=0.9, text/event-stream"}, true},
+		{[]string{"application/json", "text/event-stream"}, true},
+		{[]string{"text/event-stream;q=0.5, application/json"}, false},
+		{[]string{"text/event-stream;q=0"}, false},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/graphql", nil)
+		for _, value := range tt.accept {
+			r.Header.Add("Accept", value)
+		}
+		if got := wantsEventStream(r); got != tt.want {
+			t.Errorf("Accept %q: got %v, want %v", tt.accept, got, tt.want)
+		}
+	}
+}
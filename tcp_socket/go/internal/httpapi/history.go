@@ -0,0 +1,153 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"ifin/pkg/feedclient"
+	"ifin/pkg/store"
+)
+
+// historyHandler serves /history?symbol=AAPL&from=...&to=..., returning the
+// symbol's updates between from and to (Unix milliseconds or RFC 3339,
+// defaulting to the whole retention period) as a JSON array, oldest first.
+func historyHandler(st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		symbol := query.Get("symbol")
+		if symbol == "" {
+			http.Error(w, "symbol is required", http.StatusBadRequest)
+			return
+		}
+		from, to, err := parseRange(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		updates, err := st.History(r.Context(), symbol, from, to)
+		if err != nil {
+			http.Error(w, "history unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if updates == nil {
+			updates = []feedclient.Update{} // Encode as [] rather than null
+		}
+
+		writeEncoded(w, r, updates)
+	}
+}
+
+// History pages of /api/history
+const (
+	DefaultHistoryLimit = 1000
+	MaxHistoryLimit     = 10000
+)
+
+// historyPage is the /api/history/{symbol} response.
+type historyPage struct {
+	Symbol  string `json:"symbol"`
+	Updates any    `json:"updates"`
+	Next    int64  `json:"next,omitempty"` // The from of the next page; unset on the last
+}
+
+// apiHistoryHandler serves /api/history/{symbol}?from=&to=&limit=&step=:
+// like /history, but a page of at most limit updates (1000 by default) at a
+// time, with the from of the next page in next. With step (a duration such
+// as 1m), only the last update of each step-long interval is returned, which
+// is enough to draw a chart of a long range. fields picks the fields of each
+// update, as on /api/prices.
+func apiHistoryHandler(st store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		from, to, err := parseRange(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		limit := DefaultHistoryLimit
+		if value := query.Get("limit"); value != "" {
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > MaxHistoryLimit {
+				http.Error(w, "limit must be between 1 and "+strconv.Itoa(MaxHistoryLimit), http.StatusBadRequest)
+				return
+			}
+		}
+		var step time.Duration
+		if value := query.Get("step"); value != "" {
+			step, err = time.ParseDuration(value)
+			if err != nil || step < time.Millisecond {
+				http.Error(w, "invalid step", http.StatusBadRequest)
+				return
+			}
+		}
+
+		fields, err := parseFields(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		page := historyPage{Symbol: r.PathValue("symbol")}
+		updates, err := st.History(r.Context(), page.Symbol, from, to)
+		if err != nil {
+			http.Error(w, "history unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if step > 0 {
+			updates = downsample(updates, step)
+		}
+		if len(updates) > limit {
+			page.Next = updates[limit].Timestamp
+			updates = updates[:limit]
+		}
+		if updates == nil {
+			updates = []feedclient.Update{} // Encode as [] rather than null
+		}
+		if page.Updates, err = selectFields(updates, fields); err != nil {
+			http.Error(w, "error encoding history", http.StatusInternalServerError)
+			return
+		}
+		writeEncoded(w, r, page)
+	}
+}
+
+// downsample keeps the last of updates (oldest first) in each step-long
+// interval, counted from the Unix epoch.
+func downsample(updates []feedclient.Update, step time.Duration) []feedclient.Update {
+	ms := step.Milliseconds()
+	var kept []feedclient.Update
+	for i, update := range updates {
+		if i+1 < len(updates) && updates[i+1].Timestamp/ms == update.Timestamp/ms {
+			continue
+		}
+		kept = append(kept, update)
+	}
+	return kept
+}
+
+// parseRange parses the from and to query parameters (see ParseTime).
+func parseRange(query url.Values) (from, to time.Time, err error) {
+	if from, err = ParseTime(query.Get("from")); err != nil {
+		return from, to, errors.New("invalid from: " + err.Error())
+	}
+	if to, err = ParseTime(query.Get("to")); err != nil {
+		return from, to, errors.New("invalid to: " + err.Error())
+	}
+	return from, to, nil
+}
+
+// ParseTime parses a query parameter given in Unix milliseconds or RFC 3339;
+// empty gives the zero time.
+func ParseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,137 @@
+package httpapi
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"ifin/internal/logging"
+)
+
+// streamRetryAfter is the Retry-After sent when -max-streams is reached
+const streamRetryAfter = 5 * time.Second
+
+// bucket is one client's token bucket.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter is a token bucket per client IP, so one browser opening tab
+// after tab cannot starve the others.
+type rateLimiter struct {
+	rate  float64 // Tokens added per second
+	burst float64 // Bucket size
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time // Last time refilled buckets were dropped
+}
+
+// sweepInterval is how often buckets that have refilled are dropped
+const sweepInterval = time.Minute
+
+// newRateLimiter returns nil (no limit) when rate is not positive.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: rate, burst: float64(max(burst, 1)), buckets: make(map[string]*bucket), swept: time.Now()}
+}
+
+// allow takes a token from ip's bucket, or reports how long until one is
+// available.
+func (l *rateLimiter) allow(ip string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.swept) > sweepInterval {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[ip]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[ip] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops the buckets that have refilled, which are the same as no
+// bucket at all, so the map only holds recent clients. l.mu must be held.
+func (l *rateLimiter) sweep(now time.Time) {
+	for ip, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, ip)
+		}
+	}
+	l.swept = now
+}
+
+// rateLimitMiddleware answers 429 Too Many Requests, with Retry-After, to
+// clients over their rate, counting them in metrics and logging them to log.
+func rateLimitMiddleware(limiter *rateLimiter, metrics *Metrics, log *logging.Logger, next http.Handler) http.Handler {
+	if limiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := limiter.allow(clientIP(r)); !ok {
+			metrics.rateLimited.Add(1)
+			log.Eventf(clientIP(r), "Rate limited %s %s", clientIP(r), r.URL.Path)
+			setRetryAfter(w, wait)
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// streamLimitMiddleware answers 503 Service Unavailable, with Retry-After,
+// to new streams once slots are all taken, counting them in metrics; a nil
+// slots allows any number. When isStream is set, only the requests it
+// reports are streams.
+func streamLimitMiddleware(slots chan struct{}, isStream func(r *http.Request) bool, metrics *Metrics, next http.Handler) http.Handler {
+	if slots == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isStream != nil && !isStream(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+			next.ServeHTTP(w, r)
+		default:
+			metrics.streamsRejected.Add(1)
+			setRetryAfter(w, streamRetryAfter)
+			http.Error(w, "too many streams", http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// setRetryAfter sets Retry-After to wait, rounded up to whole seconds.
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(max(wait, time.Second).Seconds()))))
+}
+
+// clientIP returns the IP address r came from, the client's rather than a
+// trusted proxy's (see proxyMiddleware).
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,19 @@
+package httpapi
+
+import (
+	"fmt"
+
+	"ifin/internal/logging"
+)
+
+// Loggers of the API unless Config.Logger is set, sharing the client's sse
+// and http components.
+var (
+	sseLog  = logging.New("sse", printLine)  // SSE and WebSocket streams
+	httpLog = logging.New("http", printLine) // Rate limits
+)
+
+// printLine prints a log line to stdout.
+func printLine(format string, args ...any) {
+	fmt.Printf(format+"\n", args...)
+}
@@ -0,0 +1,70 @@
+package httpapi
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"ifin/internal/promtext"
+)
+
+// Metrics counts open streams and refused requests, and keeps the open /sse
+// streams for /streams. Create it with NewMetrics and pass it in Config, to
+// both Endpoints and NewRouter. The counters are updated atomically from
+// the handlers.
+type Metrics struct {
+	streams atomic.Int64 // SSE and WebSocket clients connected
+
+	rateLimited     atomic.Uint64 // HTTP requests refused by -http-rate
+	streamsRejected atomic.Uint64 // Streams refused by -max-streams
+
+	skipMu      sync.Mutex
+	streamSkips map[string]*skipCounts // Symbol -> updates streams did not send as they came
+
+	open *streamRegistry // The /sse streams
+}
+
+// NewMetrics returns metrics with nothing counted yet.
+func NewMetrics() *Metrics {
+	return &Metrics{open: &streamRegistry{streams: make(map[uint64]*streamStats)}}
+}
+
+// observeStreamSkip records an update of symbol a stream did not send as
+// it came: conflated, or else dropped.
+func (m *Metrics) observeStreamSkip(symbol string, conflated bool) {
+	m.skipMu.Lock()
+	defer m.skipMu.Unlock()
+	if m.streamSkips == nil {
+		m.streamSkips = make(map[string]*skipCounts)
+	}
+	addSkip(m.streamSkips, symbol, conflated)
+}
+
+// Write writes the metrics to p, for the client's /metrics and OTLP export.
+func (m *Metrics) Write(p promtext.Sink) {
+	p.Family("stream_clients", promtext.Gauge, "SSE and WebSocket clients connected.")
+	p.Sample("stream_clients", float64(m.streams.Load()))
+	p.Family("http_rate_limited_total", promtext.Counter, "HTTP requests refused with 429 by the per-IP rate limit.")
+	p.Sample("http_rate_limited_total", float64(m.rateLimited.Load()))
+	p.Family("stream_clients_rejected_total", promtext.Counter, "Streams refused with 503 because -max-streams were open.")
+	p.Sample("stream_clients_rejected_total", float64(m.streamsRejected.Load()))
+
+	m.skipMu.Lock()
+	skips := make(map[string]skipCounts, len(m.streamSkips))
+	for symbol, c := range m.streamSkips {
+		skips[symbol] = *c
+	}
+	m.skipMu.Unlock()
+	if len(skips) > 0 {
+		symbols := slices.Sorted(maps.Keys(skips))
+		p.Family("stream_updates_dropped_total", promtext.Counter, "Updates not sent on /sse streams because they moved less than min_change.")
+		for _, symbol := range symbols {
+			p.Sample("stream_updates_dropped_total", float64(skips[symbol].Dropped), "symbol", symbol)
+		}
+		p.Family("stream_updates_conflated_total", promtext.Counter, "Updates replaced on /sse streams by a newer price before the interval's tick.")
+		for _, symbol := range symbols {
+			p.Sample("stream_updates_conflated_total", float64(skips[symbol].Conflated), "symbol", symbol)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"ifin/pkg/codec"
+)
+
+// pathParam matches the {name} segments of a ServeMux pattern, which OpenAPI
+// writes the same way
+var pathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+// openAPIDocument builds the OpenAPI 3 description of endpoints, served
+// under basePath.
+func openAPIDocument(endpoints []Endpoint, basePath string) map[string]any {
+	paths := make(map[string]any, len(endpoints))
+	for _, e := range endpoints {
+		var params []map[string]any
+		for _, match := range pathParam.FindAllStringSubmatch(e.Pattern, -1) {
+			params = append(params, map[string]any{
+				"name": match[1], "in": "path", "required": true,
+				"schema": map[string]string{"type": "string"},
+			})
+		}
+		for _, p := range e.Params {
+			params = append(params, map[string]any{
+				"name": p.Name, "in": "query", "description": p.Description,
+				"schema": map[string]string{"type": p.Kind},
+			})
+		}
+
+		response := map[string]any{"description": "OK"}
+		if e.ContentType != "" {
+			content := map[string]any{e.ContentType: map[string]any{}}
+			if e.Negotiated {
+				for _, c := range codec.All() {
+					content[c.ContentType()] = map[string]any{}
+				}
+			}
+			response["content"] = content
+		}
+		operation := map[string]any{
+			"summary":   e.Summary,
+			"tags":      []string{e.Tag},
+			"responses": map[string]any{"200": response},
+		}
+		if params != nil {
+			operation["parameters"] = params
+		}
+		method := "get"
+		if e.Method != "" {
+			method = strings.ToLower(e.Method)
+		}
+		paths[e.Pattern] = map[string]any{method: operation}
+	}
+
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]string{
+			"title":       "Price feed client",
+			"description": "Latest prices, history and live streams of the TCP price feed.",
+			"version":     "1.0.0",
+		},
+		"paths": paths,
+	}
+	if basePath != "" {
+		doc["servers"] = []map[string]string{{"url": basePath}}
+	}
+	return doc
+}
+
+// openAPIHandler serves the OpenAPI document of endpoints, built once.
+func openAPIHandler(endpoints []Endpoint, basePath string) http.HandlerFunc {
+	doc, err := json.MarshalIndent(openAPIDocument(endpoints, basePath), "", "  ")
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			http.Error(w, "error encoding the OpenAPI document", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(doc)
+	}
+}
+
+// swaggerUIPage renders /openapi.json with Swagger UI, loaded from a CDN. The
+// URL is relative so it also works under -base-path.
+const swaggerUIPage = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Price feed client API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>SwaggerUIBundle({url: "openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+// swaggerUIHandler serves /docs, the Swagger UI for the OpenAPI document.
+func swaggerUIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(swaggerUIPage))
+}
@@ -0,0 +1,23 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"ifin/internal/errreport"
+)
+
+// reportPanicsMiddleware reports a panicking request, then lets net/http
+// recover it as usual: the connection is closed and the stack logged.
+func reportPanicsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if value := recover(); value != nil {
+				if value != http.ErrAbortHandler { // Not a crash but a deliberate abort
+					errreport.Report(errreport.Panic(value), map[string]string{"component": "http", "path": r.URL.Path})
+				}
+				panic(value)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
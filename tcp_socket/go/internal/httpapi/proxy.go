@@ -0,0 +1,124 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ProxyPolicy describes the reverse proxies in front of the HTTP server:
+// which peers may set X-Forwarded-* headers, and the path prefix the
+// endpoints are served under.
+type ProxyPolicy struct {
+	trusted  []netip.Prefix
+	basePath string // Such as "/prices", without a trailing slash; "" at the root
+}
+
+// NewProxyPolicy parses -trusted-proxies, comma-separated addresses or CIDR
+// ranges, and -base-path.
+func NewProxyPolicy(trusted, basePath string) (*ProxyPolicy, error) {
+	p := &ProxyPolicy{basePath: strings.TrimSuffix(basePath, "/")}
+	if p.basePath != "" && !strings.HasPrefix(p.basePath, "/") {
+		return nil, fmt.Errorf("base path %q must start with /", basePath)
+	}
+	for _, entry := range splitList(trusted) {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(entry)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		p.trusted = append(p.trusted, prefix.Masked())
+	}
+	return p, nil
+}
+
+// isTrusted reports whether addr is one of the trusted proxies.
+func (p *ProxyPolicy) isTrusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range p.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedClient returns the client behind the proxies in X-Forwarded-For:
+// the nearest address that is not a trusted proxy. ok is false when the
+// header names none.
+func (p *ProxyPolicy) forwardedClient(r *http.Request) (client netip.Addr, ok bool) {
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return client, false // Spoofed or garbled; the hops beyond cannot be trusted
+		}
+		client, ok = addr, true
+		if !p.isTrusted(addr) {
+			break
+		}
+	}
+	return client, ok
+}
+
+// basePathKey is the context key of the prefix stripped by proxyMiddleware.
+type basePathKey struct{}
+
+// proxyMiddleware applies policy to requests before any other handler. When
+// the peer is a trusted proxy, RemoteAddr becomes the client named by
+// X-Forwarded-For, so rate limits and logs see the real client, and the
+// URL's scheme and the Host follow X-Forwarded-Proto and X-Forwarded-Host.
+// Requests outside the base path get 404, and the prefix is stripped from
+// the others, so the endpoints are registered at the root either way.
+func proxyMiddleware(policy *ProxyPolicy, next http.Handler) http.Handler {
+	if len(policy.trusted) == 0 && policy.basePath == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if peer, err := netip.ParseAddrPort(r.RemoteAddr); err == nil && policy.isTrusted(peer.Addr()) {
+			r = r.Clone(r.Context())
+			if client, ok := policy.forwardedClient(r); ok {
+				r.RemoteAddr = net.JoinHostPort(client.String(), "0")
+			}
+			if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+				r.URL.Scheme = proto
+			}
+			if host := r.Header.Get("X-Forwarded-Host"); host != "" {
+				r.Host = host
+			}
+		}
+
+		if policy.basePath == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.URL.Path == policy.basePath {
+			// The pages link relative to the base path, so it must end in /
+			target := policy.basePath + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, policy.basePath+"/") {
+			http.NotFound(w, r) // Such as /pricesX under /prices
+			return
+		}
+		ctx := context.WithValue(r.Context(), basePathKey{}, policy.basePath)
+		http.StripPrefix(policy.basePath, next).ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// externalPath returns r's path as the client sees it, with the base path
+// proxyMiddleware stripped.
+func externalPath(r *http.Request) string {
+	basePath, _ := r.Context().Value(basePathKey{}).(string)
+	return basePath + r.URL.Path
+}
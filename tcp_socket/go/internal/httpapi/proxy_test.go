@@ -0,0 +1,42 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProxyMiddlewareBasePath(t *testing.T) {
+	policy, err := NewProxyPolicy("", "/prices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := proxyMiddleware(policy, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+
+	for _, tt := range []struct {
+		path     string
+		status   int
+		body     string // The path seen by the endpoints
+		location string // Of a redirect
+	}{
+		{"/prices/", http.StatusOK, "/", ""},
+		{"/prices/api/prices", http.StatusOK, "/api/prices", ""},
+		{"/prices", http.StatusMovedPermanently, "", "/prices/"},
+		{"/prices?symbols=AAPL", http.StatusMovedPermanently, "", "/prices/?symbols=AAPL"},
+		{"/pricesX", http.StatusNotFound, "", ""},
+		{"/pricesX/api/prices", http.StatusNotFound, "", ""},
+		{"/api/prices", http.StatusNotFound, "", ""},
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.path, rec.Code, tt.status)
+		} else if tt.body != "" && rec.Body.String() != tt.body {
+			t.Errorf("%s: served %s, want %s", tt.path, rec.Body, tt.body)
+		} else if location := rec.Header().Get("Location"); location != tt.location {
+			t.Errorf("%s: redirected to %q, want %q", tt.path, location, tt.location)
+		}
+	}
+}
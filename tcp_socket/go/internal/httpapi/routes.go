@@ -0,0 +1,163 @@
+package httpapi
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"ifin/internal/clock"
+	"ifin/pkg/store"
+)
+
+// Config configures the API.
+type Config struct {
+	StaleAfter      time.Duration // Prices older than this are marked stale; 0 disables
+	SSEPingInterval time.Duration // Heartbeat interval of /sse streams
+	MaxStreams      int           // Streams open at once; 0 for no limit
+	Compression     bool          // Compress responses the browser accepts compressed
+	Rate            float64       // Requests per second allowed per IP; 0 for no limit
+	Burst           int           // Requests an IP may send at once before Rate applies
+
+	CORS    *CORSPolicy
+	Proxies *ProxyPolicy
+	Logger  *slog.Logger // Receives the stream and rate limit lines; stdout when nil
+	Clock   clock.Clock  // Tells staleness and ages, and times heartbeats and conflation; the system clock when nil
+	Metrics *Metrics     // Counts streams and refused requests, and lists the open streams; nothing reads them when nil
+}
+
+// metrics returns cfg.Metrics, or metrics nothing reads when it is nil.
+func (cfg Config) metrics() *Metrics {
+	if cfg.Metrics == nil {
+		return NewMetrics()
+	}
+	return cfg.Metrics
+}
+
+// Endpoint is one HTTP endpoint: where it is served, by what, and how it is
+// described in /openapi.json.
+type Endpoint struct {
+	Pattern string // ServeMux pattern; {name} segments are path parameters
+	Method  string // Documented method, GET when empty
+	Handler http.Handler
+	Browser bool // Used from web pages, so behind the CORS policy
+	Stream  bool // Long-lived, so counted against MaxStreams
+
+	// StreamRequest tells which requests are streams when only some are;
+	// nil when all of them are
+	StreamRequest func(r *http.Request) bool
+
+	Tag         string
+	Summary     string
+	ContentType string // Of a successful response
+	Negotiated  bool   // Also served in the other formats of package codec, as the Accept header asks
+	Params      []QueryParam
+}
+
+// QueryParam documents one query parameter of an endpoint.
+type QueryParam struct {
+	Name        string
+	Kind        string // OpenAPI type: string, number, integer, boolean
+	Description string
+}
+
+// Parameters shared by several endpoints
+var (
+	fromParam   = QueryParam{"from", "string", "Start of the range, Unix milliseconds or RFC 3339"}
+	toParam     = QueryParam{"to", "string", "End of the range, Unix milliseconds or RFC 3339"}
+	fieldsParam = QueryParam{"fields", "string", "Comma-separated fields to return: " + strings.Join(priceFields, ",")}
+)
+
+// Endpoints lists the endpoints serving the prices in st: streams, REST and
+// GraphQL.
+func Endpoints(cfg Config, st store.Store) []Endpoint {
+	log := sseLog.To(cfg.Logger)
+	clk := cfg.Clock
+	if clk == nil {
+		clk = clock.Real
+	}
+	metrics := cfg.metrics()
+	sse := sseHandler(st, cfg.StaleAfter, cfg.SSEPingInterval, clk, metrics, log)
+	symbolsParam := QueryParam{"symbols", "string", "Comma-separated symbols to stream; every symbol when unset"}
+	sseParams := []QueryParam{
+		symbolsParam,
+		{"min_change", "number", "Only send a price that moved at least this percentage from the last one sent"},
+		{"interval", "string", "Conflate updates into one tick per interval, such as 500ms"},
+		{"candles", "string", "Also send a candle event with each symbol's OHLC candle of this length, such as 1m, once it is over"},
+	}
+	return []Endpoint{
+		// Streams
+		{Pattern: "/sse", Handler: sse, Browser: true, Stream: true, Tag: "streams", ContentType: "text/event-stream", Params: sseParams,
+			Summary: "Server-sent events: a snapshot, then a tick per update and periodic heartbeats"},
+		{Pattern: "/sse/{symbol}", Handler: sse, Browser: true, Stream: true, Tag: "streams", ContentType: "text/event-stream",
+			Summary: "Server-sent events for one symbol"},
+		{Pattern: "/ws", Handler: wsHandler(st, cfg.StaleAfter, cfg.CORS, clk, metrics, log), Stream: true, Tag: "streams", Params: []QueryParam{symbolsParam},
+			Summary: "The /sse stream over WebSocket, with subscribe and unsubscribe messages"},
+
+		// REST
+		{Pattern: "/api/prices", Handler: pricesHandler(st, cfg.StaleAfter, clk), Browser: true, Tag: "prices", ContentType: "application/json", Negotiated: true,
+			Summary: "Latest price of every symbol",
+			Params: []QueryParam{
+				{"sort", "string", "symbol, price or ts, prefixed with - for descending order"},
+				{"offset", "integer", "Symbols to skip"},
+				{"limit", "integer", "Most symbols to return"},
+				fieldsParam,
+			}},
+		{Pattern: "/api/prices/{symbol}", Handler: symbolPriceHandler(st, cfg.StaleAfter, clk), Browser: true, Tag: "prices", ContentType: "application/json", Negotiated: true,
+			Summary: "Latest price, age and staleness of one symbol"},
+		{Pattern: "/api/history/{symbol}", Handler: apiHistoryHandler(st), Browser: true, Tag: "history", ContentType: "application/json", Negotiated: true,
+			Summary: "A page of a symbol's history, optionally downsampled",
+			Params: []QueryParam{
+				fromParam, toParam,
+				{"limit", "integer", "Most updates to return, 1000 by default"},
+				{"step", "string", "Keep only the last update of each interval of this length, such as 1m"},
+				fieldsParam,
+			}},
+		{Pattern: "/api/candles/{symbol}", Handler: candlesHandler(st), Browser: true, Tag: "history", ContentType: "application/json", Negotiated: true,
+			Summary: "OHLC candles built from a symbol's history",
+			Params:  []QueryParam{{"interval", "string", "Candle length, 1m by default"}, fromParam, toParam}},
+		{Pattern: "/history", Handler: historyHandler(st), Browser: true, Tag: "history", ContentType: "application/json", Negotiated: true,
+			Summary: "A symbol's whole history in a range",
+			Params:  []QueryParam{{"symbol", "string", "The symbol (required)"}, fromParam, toParam}},
+
+		// GraphQL
+		{Pattern: "/graphql", Method: http.MethodPost, Handler: graphQLHandler(st, cfg.StaleAfter, clk, metrics), Browser: true, Stream: true, StreamRequest: wantsEventStream, Tag: "graphql", ContentType: "application/json",
+			Summary: "GraphQL queries for prices and history, and a ticks subscription streamed as server-sent events"},
+	}
+}
+
+// NewRouter returns the handler of endpoints, plus /openapi.json describing
+// them, /docs rendering that and the demo page at "/". Browser-facing
+// endpoints go through corsMiddleware, which answers preflight requests
+// itself, and responses are compressed when configured. Every request
+// counts against its IP's Rate, and streams are capped at MaxStreams.
+// Proxies is applied first, so the IP is the client's even behind a reverse
+// proxy.
+func NewRouter(cfg Config, endpoints []Endpoint) http.Handler {
+	mux := http.NewServeMux()
+	metrics := cfg.metrics()
+	var streamSlots chan struct{}
+	if cfg.MaxStreams > 0 {
+		streamSlots = make(chan struct{}, cfg.MaxStreams)
+	}
+	for _, e := range endpoints {
+		handler := e.Handler
+		if e.Stream {
+			handler = streamLimitMiddleware(streamSlots, e.StreamRequest, metrics, handler)
+		}
+		if e.Browser {
+			handler = corsMiddleware(cfg.CORS, handler)
+		}
+		mux.Handle(e.Pattern, handler)
+	}
+	mux.Handle("/openapi.json", corsMiddleware(cfg.CORS, openAPIHandler(endpoints, cfg.Proxies.basePath)))
+	mux.HandleFunc("/docs", swaggerUIHandler)
+	mux.Handle("/", webHandler()) // Every other path, index.html at "/"
+
+	var handler http.Handler = mux
+	if cfg.Compression {
+		handler = compressMiddleware(handler)
+	}
+	handler = rateLimitMiddleware(newRateLimiter(cfg.Rate, cfg.Burst), metrics, httpLog.To(cfg.Logger), handler)
+	return reportPanicsMiddleware(proxyMiddleware(cfg.Proxies, handler))
+}
@@ -0,0 +1,481 @@
+package httpapi
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"ifin/internal/clock"
+	"ifin/internal/logging"
+	"ifin/pkg/feedclient"
+	"ifin/pkg/store"
+)
+
+// PriceView is an update as sent to SSE clients.
+type PriceView struct {
+	feedclient.Update
+	Stale bool `json:"stale,omitempty"` // Older than -stale-after
+}
+
+// MarkStale wraps updates for output, flagging those generated more than
+// staleAfter before now.
+func MarkStale(updates []feedclient.Update, staleAfter time.Duration, now time.Time) []PriceView {
+	views := make([]PriceView, len(updates))
+	for i, update := range updates {
+		views[i].Update = update
+		if staleAfter > 0 && update.Timestamp != 0 {
+			views[i].Stale = now.Sub(time.UnixMilli(update.Timestamp)) > staleAfter
+		}
+	}
+	return views
+}
+
+// SymbolFilter is the set of symbols a stream is limited to; nil allows every
+// symbol.
+type SymbolFilter map[string]bool
+
+// requestedSymbols returns the symbols asked for in the path (/sse/AAPL) or
+// the symbols parameter (?symbols=AAPL,TSLA), or nil when neither is given.
+func requestedSymbols(r *http.Request) SymbolFilter {
+	symbols := splitList(r.URL.Query().Get("symbols"))
+	if symbol := r.PathValue("symbol"); symbol != "" {
+		symbols = append(symbols, symbol)
+	}
+	if len(symbols) == 0 {
+		return nil
+	}
+	return NewSymbolFilter(symbols)
+}
+
+// NewSymbolFilter allows exactly symbols.
+func NewSymbolFilter(symbols []string) SymbolFilter {
+	filter := make(SymbolFilter, len(symbols))
+	for _, symbol := range symbols {
+		filter[symbol] = true
+	}
+	return filter
+}
+
+// Allows reports whether symbol is streamed.
+func (f SymbolFilter) Allows(symbol string) bool {
+	return f == nil || f[symbol]
+}
+
+// Apply removes the updates of symbols that are not streamed.
+func (f SymbolFilter) Apply(updates []feedclient.Update) []feedclient.Update {
+	if f == nil {
+		return updates
+	}
+	return slices.DeleteFunc(updates, func(u feedclient.Update) bool { return !f[u.Symbol] })
+}
+
+// SSE event names, so browsers can addEventListener per kind
+const (
+	eventSnapshot  = "snapshot"  // The latest price of every symbol
+	eventTick      = "tick"      // Updates since the last event
+	eventHeartbeat = "heartbeat" // The server time, every heartbeatInterval
+	eventCandle    = "candle"    // A symbol's OHLC candle, once its interval is over
+)
+
+// heartbeatInterval is how often a heartbeat event is sent, so clients can
+// tell a quiet market from a dead connection
+const heartbeatInterval = 30 * time.Second
+
+// sseHandler streams prices as server-sent events, for every symbol or only
+// those requested (see requestedSymbols). Each event's data is a JSON array
+// of updates: a snapshot event with every price when the stream starts, then
+// a tick event per update as it arrives from the store's subscription.
+// Should subscribing fail, which is logged to log, the snapshot is polled
+// every second instead, and only the symbols whose price changed are sent.
+// Heartbeat events carry the server time as {"time": <Unix milliseconds>}.
+// Staleness, heartbeats, pings and conflation go by clk. The stream is
+// counted in metrics and listed by its StreamsHandler while open.
+//
+// Each price event's ID is the newest timestamp in it. A browser reconnecting with
+// Last-Event-ID is sent the updates it missed, from the history where kept,
+// instead of the snapshot. After pingInterval without anything written, a
+// ": ping" comment is sent so proxies do not close the idle connection.
+//
+// Each subscriber may tailor its stream: with min_change (a percentage),
+// ticks are only sent for prices that moved at least that much from the
+// last one sent for the symbol, and with interval (a duration such as
+// 500ms), updates are conflated into one tick event per interval holding
+// the latest price of each symbol that changed. With candles (a duration of
+// at least 1s), a candle event also carries each symbol's OHLC candle of the
+// updates streamed, as /api/candles builds it, once the symbol's first
+// update of a later interval arrives.
+func sseHandler(st store.Store, staleAfter, pingInterval time.Duration, clk clock.Clock, metrics *Metrics, log *logging.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		minChange, interval, err := parseStreamFilters(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		candleInterval, err := parseCandleInterval(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		// Keep the connection open
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming unsupported!", http.StatusInternalServerError)
+			return
+		}
+
+		metrics.streams.Add(1)
+		defer metrics.streams.Add(-1)
+		stats := metrics.openStream(r)
+		defer metrics.closeStream(stats)
+
+		stream := &sseStream{
+			w:            w,
+			flusher:      flusher,
+			st:           st,
+			filter:       requestedSymbols(r),
+			staleAfter:   staleAfter,
+			clock:        clk,
+			minChange:    minChange,
+			interval:     interval,
+			sent:         make(map[string]float64),
+			pending:      make(map[string]feedclient.Update),
+			candle:       candleInterval,
+			candles:      make(map[string]*candle),
+			pingInterval: pingInterval,
+			stats:        stats,
+			log:          log,
+		}
+		if pingInterval > 0 {
+			stream.idle = clk.NewTimer(pingInterval)
+			defer stream.idle.Stop()
+		}
+		lastID, _ := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64)
+
+		// Subscribe before reading the snapshot so no update falls in between
+		ctx := r.Context()
+		updates, err := st.Subscribe(ctx)
+		if err == nil {
+			heartbeat := clk.NewTicker(heartbeatInterval)
+			defer heartbeat.Stop()
+			var conflate <-chan time.Time
+			if interval > 0 {
+				ticker := clk.NewTicker(interval)
+				defer ticker.Stop()
+				conflate = ticker.C()
+			}
+			stream.start(ctx, lastID)
+			for {
+				select {
+				case <-ctx.Done():
+					return // Client disconnected, or shutting down
+				case update, ok := <-updates:
+					if !ok {
+						return
+					}
+					stream.tick(ctx, update)
+				case <-conflate:
+					stream.conflate(ctx)
+				case <-heartbeat.C():
+					stream.heartbeat()
+				case <-stream.idleC():
+					stream.ping()
+				}
+			}
+		}
+		log.Warnf("Error subscribing to updates, polling instead: %v", err)
+		stream.poll(ctx, lastID)
+	})
+}
+
+// sseStream is one client's event stream.
+type sseStream struct {
+	w          io.Writer
+	flusher    http.Flusher
+	st         store.Store
+	filter     SymbolFilter
+	staleAfter time.Duration
+	clock      clock.Clock // Tells staleness, times heartbeats and conflation
+	log        *logging.Logger
+
+	minChange float64                      // Percentage a price must move before it is sent again
+	interval  time.Duration                // Conflation interval; 0 sends each update as it arrives
+	sent      map[string]float64           // Last price sent per symbol
+	pending   map[string]feedclient.Update // Latest update per symbol awaiting the next conflation
+	stats     *streamStats                 // Counts what min_change and interval leave out
+
+	candle  time.Duration      // Length of the candles sent; 0 sends none
+	candles map[string]*candle // The open candle of each symbol
+
+	pingInterval time.Duration
+	idle         clock.Timer // Fires after pingInterval without a write; nil when pings are off
+}
+
+// send writes updates as one event, identified by their newest timestamp.
+func (s *sseStream) send(event string, updates []feedclient.Update) {
+	payload := s.payload(updates)
+	if payload == "" {
+		return
+	}
+	var id int64
+	for _, update := range updates {
+		id = max(id, update.Timestamp)
+		s.sent[update.Symbol] = update.Price
+	}
+	if id > 0 {
+		fmt.Fprintf(s.w, "id: %d\n", id)
+	}
+	fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, payload)
+	s.flush()
+}
+
+// tick sends a live update, if its symbol is streamed, or with an interval
+// holds it until the next conflation in place of the symbol's older one.
+func (s *sseStream) tick(ctx context.Context, update feedclient.Update) {
+	if !s.filter.Allows(update.Symbol) {
+		return
+	}
+	s.addToCandle(update)
+	if s.interval > 0 {
+		if _, held := s.pending[update.Symbol]; held {
+			s.stats.skipped(update.Symbol, true)
+		}
+		s.pending[update.Symbol] = update
+		return
+	}
+	s.sendTicks(ctx, []feedclient.Update{update})
+}
+
+// conflate sends the held updates as one tick event, ordered by symbol.
+func (s *sseStream) conflate(ctx context.Context) {
+	if len(s.pending) == 0 {
+		return
+	}
+	updates := slices.Collect(maps.Values(s.pending))
+	clear(s.pending)
+	store.SortBySymbol(updates)
+	s.sendTicks(ctx, updates)
+}
+
+// sendTicks sends, as one tick event, the updates that moved at least
+// minChange percent from the last price sent for their symbol.
+func (s *sseStream) sendTicks(ctx context.Context, updates []feedclient.Update) {
+	if s.minChange > 0 {
+		updates = slices.DeleteFunc(updates, func(u feedclient.Update) bool {
+			last, ok := s.sent[u.Symbol]
+			drop := ok && last != 0 && math.Abs(u.Price-last)/math.Abs(last)*100 < s.minChange
+			if drop {
+				s.stats.skipped(u.Symbol, false)
+			}
+			return drop
+		})
+	}
+	if len(updates) > 0 {
+		defer traceEmit(ctx, updates)()
+		s.send(eventTick, updates)
+	}
+}
+
+// symbolCandle is a candle as sent in a candle event.
+type symbolCandle struct {
+	Symbol string `json:"symbol"`
+	candle
+}
+
+// addToCandle adds update to the open candle of its symbol. When update
+// starts a later interval, the open candle is sent as a candle event and
+// update opens the next; updates older than the open candle are left out.
+func (s *sseStream) addToCandle(update feedclient.Update) {
+	if s.candle <= 0 {
+		return
+	}
+	open, ok := s.candles[update.Symbol]
+	if ok {
+		if open.add(update, s.candle) || candleStart(update, s.candle) < open.Time {
+			return
+		}
+		s.sendCandle(symbolCandle{Symbol: update.Symbol, candle: *open})
+	}
+	next := newCandle(update, s.candle)
+	s.candles[update.Symbol] = &next
+}
+
+// sendCandle writes a candle event. Like heartbeats, it has no ID.
+func (s *sseStream) sendCandle(c symbolCandle) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		s.log.Errorf("Error marshaling candle: %v", err)
+		return
+	}
+	fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", eventCandle, payload)
+	s.flush()
+}
+
+// heartbeat writes a heartbeat event. It has no ID, so a reconnecting
+// browser still resumes from the last price event.
+func (s *sseStream) heartbeat() {
+	fmt.Fprintf(s.w, "event: %s\ndata: {\"time\":%d}\n\n", eventHeartbeat, s.clock.Now().UnixMilli())
+	s.flush()
+}
+
+// ping writes a comment, which EventSource ignores, to keep an idle
+// connection open.
+func (s *sseStream) ping() {
+	fmt.Fprint(s.w, ": ping\n\n")
+	s.flush()
+}
+
+// idleC returns the channel of the idle timer, or nil (never ready) when
+// pings are off.
+func (s *sseStream) idleC() <-chan time.Time {
+	if s.idle == nil {
+		return nil
+	}
+	return s.idle.C()
+}
+
+// flush sends what was written to the client and restarts the idle timer.
+func (s *sseStream) flush() {
+	s.flusher.Flush()
+	if s.idle != nil {
+		s.idle.Reset(s.pingInterval)
+	}
+}
+
+// start sends the snapshot or, when resuming after lastID, the updates
+// generated since. It returns the latest update of each symbol, or nil when
+// the prices cannot be read.
+func (s *sseStream) start(ctx context.Context, lastID int64) []feedclient.Update {
+	latest, err := s.st.GetAll(ctx)
+	if err != nil {
+		s.log.Errorf("Error reading prices: %v", err)
+		return nil
+	}
+	latest = s.filter.Apply(latest)
+	if lastID <= 0 {
+		s.send(eventSnapshot, latest)
+		return latest
+	}
+
+	var missed []feedclient.Update
+	for _, update := range latest {
+		if update.Timestamp <= lastID {
+			continue
+		}
+		// Without a history, at least the latest price is caught up on
+		history, err := s.st.History(ctx, update.Symbol, time.UnixMilli(lastID+1), time.Time{})
+		if err != nil || len(history) == 0 {
+			history = []feedclient.Update{update}
+		}
+		missed = append(missed, history...)
+	}
+	slices.SortStableFunc(missed, func(a, b feedclient.Update) int { return cmp.Compare(a.Timestamp, b.Timestamp) })
+	for _, update := range missed {
+		s.send(eventTick, []feedclient.Update{update})
+	}
+	return latest
+}
+
+// poll sends the snapshot (or what was missed since lastID), then polls it
+// every second, or every interval when set, and sends the updates that
+// differ from those already seen, until ctx is done.
+func (s *sseStream) poll(ctx context.Context, lastID int64) {
+	every := time.Second
+	if s.interval > 0 {
+		every = s.interval
+	}
+	ticker := s.clock.NewTicker(every)
+	defer ticker.Stop()
+	heartbeat := s.clock.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	seen := make(map[string]feedclient.Update) // Last update seen per symbol
+	for _, update := range s.start(ctx, lastID) {
+		seen[update.Symbol] = update
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return // Client disconnected
+		case <-heartbeat.C():
+			s.heartbeat()
+			continue
+		case <-s.idleC():
+			s.ping()
+			continue
+		case <-ticker.C():
+		}
+
+		updates, err := s.st.GetAll(ctx)
+		if err != nil {
+			s.log.Errorf("Error reading prices: %v", err)
+		}
+		var changed []feedclient.Update
+		for _, update := range s.filter.Apply(updates) {
+			if last, ok := seen[update.Symbol]; !ok || last != update {
+				seen[update.Symbol] = update
+				s.addToCandle(update)
+				changed = append(changed, update)
+			}
+		}
+		s.sendTicks(ctx, changed)
+	}
+}
+
+// parseStreamFilters parses the min_change (a finite, non-negative
+// percentage) and interval (a duration of at least 10ms) parameters; either
+// may be unset.
+func parseStreamFilters(query url.Values) (minChange float64, interval time.Duration, err error) {
+	if value := query.Get("min_change"); value != "" {
+		minChange, err = strconv.ParseFloat(value, 64)
+		if err != nil || minChange < 0 || math.IsInf(minChange, 0) || math.IsNaN(minChange) {
+			return 0, 0, errors.New("min_change must be a non-negative percentage")
+		}
+	}
+	if value := query.Get("interval"); value != "" {
+		interval, err = time.ParseDuration(value)
+		if err != nil || interval < 10*time.Millisecond {
+			return 0, 0, errors.New("interval must be a duration of at least 10ms")
+		}
+	}
+	return minChange, interval, nil
+}
+
+// parseCandleInterval parses the candles parameter, a duration of at least
+// 1s, returning 0 when it is unset.
+func parseCandleInterval(query url.Values) (time.Duration, error) {
+	value := query.Get("candles")
+	if value == "" {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval < time.Second {
+		return 0, errors.New("candles must be a duration of at least 1s")
+	}
+	return interval, nil
+}
+
+// payload marshals updates for one SSE event, flagging those stale now, or
+// returns "" on error.
+func (s *sseStream) payload(updates []feedclient.Update) string {
+	payload, err := json.Marshal(MarkStale(updates, s.staleAfter, s.clock.Now()))
+	if err != nil {
+		s.log.Errorf("Error marshaling JSON: %v", err)
+		return ""
+	}
+	return string(payload)
+}
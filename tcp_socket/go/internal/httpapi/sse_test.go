@@ -0,0 +1,169 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"ifin/internal/clock"
+	"ifin/pkg/feedclient"
+	"ifin/pkg/store"
+)
+
+// sseEvent is one event read from a stream.
+type sseEvent struct {
+	name string
+	data string
+}
+
+// readEvent reads the next event from r, skipping comments.
+func readEvent(t *testing.T, r *bufio.Reader) sseEvent {
+	t.Helper()
+	var event sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading the stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && event.name != "":
+			return event
+		case strings.HasPrefix(line, "event: "):
+			event.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+// openStream requests path from handler and returns the stream's reader.
+func openStream(t *testing.T, handler http.Handler, path string) *bufio.Reader {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+path, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		resp.Body.Close()
+		server.Close()
+	})
+	return bufio.NewReader(resp.Body)
+}
+
+func TestSSEStalenessAndHeartbeatFollowClock(t *testing.T) {
+	clk := clock.NewFake(time.UnixMilli(1_700_000_000_000))
+	st := store.NewMemory(time.Hour)
+	ctx := context.Background()
+	st.Put(ctx, feedclient.Update{Symbol: "AAPL", Price: 190, Timestamp: clk.Now().UnixMilli()})
+
+	stream := openStream(t, sseHandler(st, 10*time.Second, 0, clk, NewMetrics(), sseLog), "/sse")
+	snapshot := readEvent(t, stream)
+	if snapshot.name != eventSnapshot || !strings.Contains(snapshot.data, `"AAPL"`) || strings.Contains(snapshot.data, "stale") {
+		t.Fatalf("got %+v, want a snapshot of a fresh AAPL price", snapshot)
+	}
+
+	// The heartbeat ticks on the fake clock and carries its time
+	clk.Advance(heartbeatInterval)
+	heartbeat := readEvent(t, stream)
+	if want := fmt.Sprintf(`{"time":%d}`, clk.Now().UnixMilli()); heartbeat.name != eventHeartbeat || heartbeat.data != want {
+		t.Fatalf("got %+v, want a heartbeat with %s", heartbeat, want)
+	}
+
+	// 30s after the snapshot, an update generated then is stale
+	st.Put(ctx, feedclient.Update{Symbol: "AAPL", Price: 191, Timestamp: clk.Now().Add(-heartbeatInterval).UnixMilli()})
+	tick := readEvent(t, stream)
+	if tick.name != eventTick || !strings.Contains(tick.data, `"stale":true`) {
+		t.Fatalf("got %+v, want a stale tick", tick)
+	}
+}
+
+func TestSSEPingFollowsClock(t *testing.T) {
+	clk := clock.NewFake(time.UnixMilli(1_700_000_000_000))
+	st := store.NewMemory(time.Hour)
+
+	stream := openStream(t, sseHandler(st, 0, 5*time.Second, clk, NewMetrics(), sseLog), "/sse")
+	if snapshot := readEvent(t, stream); snapshot.name != eventSnapshot {
+		t.Fatalf("got %+v, want the snapshot", snapshot)
+	}
+
+	// The idle timer is restarted after the snapshot is flushed
+	time.Sleep(20 * time.Millisecond)
+	clk.Advance(5 * time.Second)
+	line, err := stream.ReadString('\n')
+	if err != nil || line != ": ping\n" {
+		t.Fatalf("read %q (%v), want a ping", line, err)
+	}
+}
+
+func TestSSEConflationFollowsClock(t *testing.T) {
+	clk := clock.NewFake(time.UnixMilli(1_700_000_000_000))
+	st := store.NewMemory(time.Hour)
+	ctx := context.Background()
+
+	stream := openStream(t, sseHandler(st, 0, 0, clk, NewMetrics(), sseLog), "/sse?interval=1s")
+	if snapshot := readEvent(t, stream); snapshot.name != eventSnapshot {
+		t.Fatalf("got %+v, want the snapshot", snapshot)
+	}
+
+	for i, price := range []float64{190, 191, 192} {
+		st.Put(ctx, feedclient.Update{Symbol: "AAPL", Price: price, Timestamp: clk.Now().UnixMilli() + int64(i)})
+	}
+	time.Sleep(20 * time.Millisecond) // Let the stream take them in
+	clk.Advance(time.Second)
+	tick := readEvent(t, stream)
+	if tick.name != eventTick || !strings.Contains(tick.data, `"price":192`) || strings.Contains(tick.data, `"price":191`) {
+		t.Fatalf("got %+v, want one tick with the last price", tick)
+	}
+}
+
+func TestSSECandleSentWhenIntervalIsOver(t *testing.T) {
+	clk := clock.NewFake(time.UnixMilli(1_700_000_040_000)) // A whole minute
+	st := store.NewMemory(time.Hour)
+	ctx := context.Background()
+
+	stream := openStream(t, sseHandler(st, 0, 0, clk, NewMetrics(), sseLog), "/sse?candles=1m")
+	if snapshot := readEvent(t, stream); snapshot.name != eventSnapshot {
+		t.Fatalf("got %+v, want the snapshot", snapshot)
+	}
+
+	start := clk.Now().UnixMilli()
+	for i, price := range []float64{190, 193, 189, 191} {
+		st.Put(ctx, feedclient.Update{Symbol: "AAPL", Price: price, Timestamp: start + int64(i)*1000})
+		if tick := readEvent(t, stream); tick.name != eventTick {
+			t.Fatalf("got %+v, want a tick", tick)
+		}
+	}
+
+	// The first update of the next minute closes the candle
+	st.Put(ctx, feedclient.Update{Symbol: "AAPL", Price: 192, Timestamp: start + time.Minute.Milliseconds()})
+	candle := readEvent(t, stream)
+	want := fmt.Sprintf(`{"symbol":"AAPL","time":%d,"open":190,"high":193,"low":189,"close":191,"count":4}`, start)
+	if candle.name != eventCandle || candle.data != want {
+		t.Fatalf("got %+v, want a candle event with %s", candle, want)
+	}
+	if tick := readEvent(t, stream); tick.name != eventTick || !strings.Contains(tick.data, `"price":192`) {
+		t.Fatalf("got %+v, want the tick of the update opening the next candle", tick)
+	}
+}
+
+func TestParseStreamFiltersRejectsInvalidMinChange(t *testing.T) {
+	for _, value := range []string{"NaN", "Inf", "-Inf", "-1", "x"} {
+		if _, _, err := parseStreamFilters(url.Values{"min_change": {value}}); err == nil {
+			t.Errorf("min_change=%s accepted", value)
+		}
+	}
+	if minChange, _, err := parseStreamFilters(url.Values{"min_change": {"0.5"}}); err != nil || minChange != 0.5 {
+		t.Errorf("min_change=0.5: got %v (%v), want 0.5", minChange, err)
+	}
+}
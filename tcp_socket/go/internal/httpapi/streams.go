@@ -0,0 +1,125 @@
+package httpapi
+
+import (
+	"cmp"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// skipCounts are the updates a stream did not send as they came, so its
+// consumer can tell how complete what it received is.
+type skipCounts struct {
+	Dropped   uint64 `json:"dropped"`   // Moved less than min_change
+	Conflated uint64 `json:"conflated"` // Replaced by a newer price before the interval's tick
+}
+
+// streamStats describes one open /sse stream for /streams.
+type streamStats struct {
+	id      uint64
+	client  string
+	path    string // With the query, which holds the stream's filters
+	since   time.Time
+	metrics *Metrics // Also counts the skips across streams
+
+	mu      sync.Mutex
+	symbols map[string]*skipCounts
+}
+
+// skipped counts, for the stream and across streams, one update of symbol
+// that was not sent: conflated, or else dropped.
+func (s *streamStats) skipped(symbol string, conflated bool) {
+	s.mu.Lock()
+	addSkip(s.symbols, symbol, conflated)
+	s.mu.Unlock()
+	s.metrics.observeStreamSkip(symbol, conflated)
+}
+
+func addSkip(counts map[string]*skipCounts, symbol string, conflated bool) {
+	c, ok := counts[symbol]
+	if !ok {
+		c = &skipCounts{}
+		counts[symbol] = c
+	}
+	if conflated {
+		c.Conflated++
+	} else {
+		c.Dropped++
+	}
+}
+
+// streamRegistry is the set of open streams.
+type streamRegistry struct {
+	mu      sync.Mutex
+	nextID  uint64
+	streams map[uint64]*streamStats
+}
+
+// openStream registers the stream serving r; close it when the stream ends.
+func (m *Metrics) openStream(r *http.Request) *streamStats {
+	reg := m.open
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.nextID++
+	s := &streamStats{
+		id:      reg.nextID,
+		client:  clientIP(r),
+		path:    externalPath(r),
+		since:   time.Now(),
+		metrics: m,
+		symbols: make(map[string]*skipCounts),
+	}
+	if r.URL.RawQuery != "" {
+		s.path += "?" + r.URL.RawQuery
+	}
+	reg.streams[s.id] = s
+	return s
+}
+
+func (m *Metrics) closeStream(s *streamStats) {
+	m.open.mu.Lock()
+	delete(m.open.streams, s.id)
+	m.open.mu.Unlock()
+}
+
+// streamView is one stream as served by /streams.
+type streamView struct {
+	ID      uint64                `json:"id"`
+	Client  string                `json:"client"`
+	Path    string                `json:"path"`
+	Since   time.Time             `json:"since"`
+	Total   skipCounts            `json:"total"`
+	Symbols map[string]skipCounts `json:"symbols"`
+}
+
+// views returns the open streams, oldest first.
+func (reg *streamRegistry) views() []streamView {
+	reg.mu.Lock()
+	streams := slices.Collect(maps.Values(reg.streams))
+	reg.mu.Unlock()
+	slices.SortFunc(streams, func(a, b *streamStats) int { return cmp.Compare(a.id, b.id) })
+
+	views := make([]streamView, len(streams))
+	for i, s := range streams {
+		view := streamView{ID: s.id, Client: s.client, Path: s.path, Since: s.since, Symbols: make(map[string]skipCounts)}
+		s.mu.Lock()
+		for symbol, c := range s.symbols {
+			view.Symbols[symbol] = *c
+			view.Total.Dropped += c.Dropped
+			view.Total.Conflated += c.Conflated
+		}
+		s.mu.Unlock()
+		views[i] = view
+	}
+	return views
+}
+
+// StreamsHandler serves the open /sse streams and GraphQL subscriptions with
+// the updates each did not send as they came, per symbol.
+func (m *Metrics) StreamsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m.open.views())
+}
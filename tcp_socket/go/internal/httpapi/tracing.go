@@ -0,0 +1,34 @@
+package httpapi
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"ifin/internal/tracing"
+	"ifin/pkg/feedclient"
+)
+
+// tracer records the SSE emit spans, in the client's traces
+var tracer = tracing.Tracer("feed-client")
+
+// traceEmit starts an emit span for each traced update about to be sent on
+// the SSE stream of ctx, and returns the function ending them once it has
+// been.
+func traceEmit(ctx context.Context, updates []feedclient.Update) (end func()) {
+	var spans []trace.Span
+	for _, update := range updates {
+		if update.TraceParent == "" {
+			continue
+		}
+		_, span := tracer.Start(tracing.WithTraceParent(ctx, update.TraceParent), "sse.emit", trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(attribute.String("symbol", update.Symbol), attribute.Int64("seq", int64(update.Seq)), attribute.String("tick.id", update.ID)))
+		spans = append(spans, span)
+	}
+	return func() {
+		for _, span := range spans {
+			span.End()
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package httpapi
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// webFiles are the demo pages, built into the binary so the demo needs
+// nothing but the client
+//
+//go:embed web
+var webFiles embed.FS
+
+// webHandler serves the demo pages: web/index.html at "/", a live price
+// table fed by /sse, and /dashboard.html, sparklines and candles per symbol
+// over /sse or /ws.
+func webHandler() http.Handler {
+	root, err := fs.Sub(webFiles, "web")
+	if err != nil {
+		panic(err) // "web" is embedded above
+	}
+	return http.FileServerFS(root)
+}
@@ -0,0 +1,170 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"ifin/internal/clock"
+	"ifin/internal/logging"
+	"ifin/pkg/feedclient"
+	"ifin/pkg/store"
+)
+
+// wsWriteTimeout bounds each message write, so a client that stops reading
+// is dropped rather than holding its stream open
+const wsWriteTimeout = 10 * time.Second
+
+// wsRequest is a message from a WebSocket client, changing which symbols it
+// is sent.
+type wsRequest struct {
+	Action  string   `json:"action"` // "subscribe" or "unsubscribe"
+	Symbols []string `json:"symbols"`
+}
+
+// wsEvent is a message to a WebSocket client. Type is one of the SSE event
+// names, or "error" for a request that could not be handled.
+type wsEvent struct {
+	Type   string      `json:"type"`
+	Prices []PriceView `json:"prices,omitempty"`
+	Time   int64       `json:"time,omitempty"`  // Heartbeats only
+	Error  string      `json:"error,omitempty"` // Errors only
+}
+
+// wsHandler serves /ws, the /sse stream over WebSocket: a snapshot message,
+// then a tick message per update and a heartbeat every heartbeatInterval.
+// The symbols sent start as those in the symbols parameter, or every symbol,
+// and are changed by {"action":"subscribe","symbols":[...]} (which replies
+// with a snapshot of the symbols added) and "unsubscribe". A connection
+// receiving every symbol only gets the subscribed ones after its first
+// subscribe. Browsers may only connect from origins allowed by cors, or
+// from pages served by the client itself. Connections are counted in metrics,
+// and why each closed is logged to log.
+func wsHandler(st store.Store, staleAfter time.Duration, cors *CORSPolicy, clk clock.Clock, metrics *Metrics, log *logging.Logger) http.Handler {
+	return websocket.Server{
+		Handshake: func(_ *websocket.Config, r *http.Request) error {
+			if origin := r.Header.Get("Origin"); origin != "" && !sameOrigin(origin, r) && cors.allowOrigin(origin) == "" {
+				return fmt.Errorf("origin %s not allowed", origin)
+			}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			metrics.streams.Add(1)
+			defer metrics.streams.Add(-1)
+			if err := serveWebSocket(ws, st, staleAfter, clk); err != nil {
+				log.Debugf("WebSocket of %s closed: %v", clientIP(ws.Request()), err)
+			}
+		},
+	}
+}
+
+// sameOrigin reports whether origin is the host r was sent to, as for the
+// embedded demo pages.
+func sameOrigin(origin string, r *http.Request) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// serveWebSocket streams prices to ws until either side closes it, telling
+// staleness and timing heartbeats by clk.
+func serveWebSocket(ws *websocket.Conn, st store.Store, staleAfter time.Duration, clk clock.Clock) error {
+	ctx, cancel := context.WithCancel(ws.Request().Context())
+	defer cancel()
+
+	// Requests are read here and handled by the loop below, which owns the
+	// filter and all writes
+	requests := make(chan wsRequest)
+	go func() {
+		defer cancel() // The client went away
+		for {
+			var message string
+			if err := websocket.Message.Receive(ws, &message); err != nil {
+				return
+			}
+			var req wsRequest
+			if err := json.Unmarshal([]byte(message), &req); err != nil {
+				req = wsRequest{} // Answered as an unknown action
+			}
+			select {
+			case requests <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	send := func(event wsEvent) error {
+		ws.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		return websocket.JSON.Send(ws, event)
+	}
+	prices := func(kind string, updates []feedclient.Update) error {
+		return send(wsEvent{Type: kind, Prices: MarkStale(updates, staleAfter, clk.Now())})
+	}
+	snapshot := func(filter SymbolFilter) error {
+		latest, err := st.GetAll(ctx)
+		if err != nil {
+			return send(wsEvent{Type: "error", Error: "prices unavailable"})
+		}
+		return prices(eventSnapshot, filter.Apply(latest))
+	}
+
+	filter := requestedSymbols(ws.Request())
+
+	// Subscribe before reading the snapshot so no update falls in between
+	updates, err := st.Subscribe(ctx)
+	if err != nil {
+		send(wsEvent{Type: "error", Error: "updates unavailable"})
+		return err
+	}
+	if err := snapshot(filter); err != nil {
+		return err
+	}
+
+	heartbeat := clk.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case update, ok := <-updates:
+			if !ok {
+				return ctx.Err()
+			}
+			if filter.Allows(update.Symbol) {
+				err = prices(eventTick, []feedclient.Update{update})
+			}
+
+		case req := <-requests:
+			switch req.Action {
+			case "subscribe":
+				if filter == nil {
+					filter = make(SymbolFilter)
+				}
+				for _, symbol := range req.Symbols {
+					filter[symbol] = true
+				}
+				err = snapshot(NewSymbolFilter(req.Symbols))
+			case "unsubscribe":
+				for _, symbol := range req.Symbols {
+					delete(filter, symbol)
+				}
+			default:
+				err = send(wsEvent{Type: "error", Error: fmt.Sprintf("unknown action %q", req.Action)})
+			}
+
+		case <-heartbeat.C():
+			err = send(wsEvent{Type: eventHeartbeat, Time: clk.Now().UnixMilli()})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Package latency counts durations into fixed buckets, for the histograms
+// served on /metrics and summarised in the JSON stats.
+package latency
+
+import (
+	"sync/atomic"
+	"time"
+
+	"ifin/internal/promtext"
+)
+
+// Buckets are the upper bounds of the Histogram buckets
+var Buckets = []time.Duration{
+	500 * time.Microsecond, time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond,
+	250 * time.Millisecond, 500 * time.Millisecond, time.Second,
+}
+
+// bounds are Buckets in seconds, as Prometheus expects
+var bounds = func() []float64 {
+	b := make([]float64, len(Buckets))
+	for i, bound := range Buckets {
+		b[i] = bound.Seconds()
+	}
+	return b
+}()
+
+// Histogram counts latencies into Buckets, plus one bucket for anything
+// slower. It is safe for concurrent use.
+type Histogram struct {
+	counts []atomic.Uint64
+	nanos  atomic.Uint64 // Sum of all latencies
+	max    atomic.Int64
+}
+
+func New() *Histogram {
+	return &Histogram{counts: make([]atomic.Uint64, len(Buckets)+1)}
+}
+
+// Observe records one latency.
+func (h *Histogram) Observe(d time.Duration) {
+	i := 0
+	for i < len(Buckets) && d > Buckets[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	h.nanos.Add(uint64(d))
+	for {
+		current := h.max.Load()
+		if int64(d) <= current || h.max.CompareAndSwap(current, int64(d)) {
+			return
+		}
+	}
+}
+
+// cumulative returns the bucket counts, each including the faster buckets.
+func (h *Histogram) cumulative() []uint64 {
+	counts := make([]uint64, len(h.counts))
+	var total uint64
+	for i := range h.counts {
+		total += h.counts[i].Load()
+		counts[i] = total
+	}
+	return counts
+}
+
+// Write writes h as one histogram of the family name, in seconds.
+func (h *Histogram) Write(p promtext.Sink, name string, labels ...string) {
+	p.Histogram(name, bounds, h.cumulative(), time.Duration(h.nanos.Load()).Seconds(), labels...)
+}
+
+// Snapshot is a Histogram as reported in JSON. Buckets are cumulative,
+// keyed by upper bound ("le"), as in Prometheus.
+type Snapshot struct {
+	Count   uint64            `json:"count"`
+	AvgMs   float64           `json:"avg_ms"`
+	MaxMs   float64           `json:"max_ms"`
+	Buckets map[string]uint64 `json:"buckets"`
+}
+
+func (h *Histogram) Snapshot() Snapshot {
+	s := Snapshot{Buckets: make(map[string]uint64, len(h.counts))}
+	for i := range h.counts {
+		s.Count += h.counts[i].Load()
+		le := "+Inf"
+		if i < len(Buckets) {
+			le = Buckets[i].String()
+		}
+		s.Buckets[le] = s.Count
+	}
+	if s.Count > 0 {
+		s.AvgMs = float64(h.nanos.Load()) / float64(s.Count) / float64(time.Millisecond)
+	}
+	s.MaxMs = float64(h.max.Load()) / float64(time.Millisecond)
+	return s
+}
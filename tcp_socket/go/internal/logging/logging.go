@@ -0,0 +1,230 @@
+// Package logging filters log lines by level, set for the whole process and
+// overridden per component, so chatty components such as the per-message
+// broadcaster can be silenced in production without recompiling.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Level is the severity of a log line.
+type Level int
+
+// Levels, from the most verbose.
+const (
+	Debug Level = iota // A line per message
+	Info               // Connection lifecycle and other events
+	Warn               // Degraded but still working
+	Error              // Failures
+)
+
+var levelNames = [...]string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < Debug || l > Error {
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses a level name: debug, info, warn or error.
+func ParseLevel(name string) (Level, error) {
+	for i, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q, want debug, info, warn or error", name)
+}
+
+// Config is the lowest level logged by each component, and how their
+// per-message lines are sampled.
+type Config struct {
+	Default    Level
+	Components map[string]Level // Overrides of Default by component name
+	Sampling   Sampling
+}
+
+// Sampling thins out the per-message lines written with Eventf, so debug
+// logging can stay on at thousands of messages per second. The zero value
+// writes every line.
+type Sampling struct {
+	Every  uint64        // Write 1 line in Every
+	Period time.Duration // Instead write the first line per key in each Period
+}
+
+// ParseSampling parses a sampling spec: a number N to write 1 line in N, or
+// a duration such as 1s to write the first line per key in each period.
+// "" writes every line.
+func ParseSampling(spec string) (Sampling, error) {
+	if spec == "" {
+		return Sampling{}, nil
+	}
+	if every, err := strconv.ParseUint(spec, 10, 64); err == nil && every > 0 {
+		return Sampling{Every: every}, nil
+	}
+	if period, err := time.ParseDuration(spec); err == nil && period > 0 {
+		return Sampling{Period: period}, nil
+	}
+	return Sampling{}, fmt.Errorf("invalid log sampling %q, want a count such as 100 or a period such as 1s", spec)
+}
+
+// Parse reads a default level and comma-separated per-component overrides,
+// e.g. "info" and "broadcaster=warn,sse=debug".
+func Parse(level, components string) (Config, error) {
+	def, err := ParseLevel(level)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg := Config{Default: def, Components: make(map[string]Level)}
+	for _, override := range strings.Split(components, ",") {
+		override = strings.TrimSpace(override)
+		if override == "" {
+			continue
+		}
+		name, levelName, ok := strings.Cut(override, "=")
+		if !ok {
+			return Config{}, fmt.Errorf("invalid log component %q, want name=level", override)
+		}
+		if cfg.Components[strings.TrimSpace(name)], err = ParseLevel(strings.TrimSpace(levelName)); err != nil {
+			return Config{}, err
+		}
+	}
+	return cfg, nil
+}
+
+// Level returns the lowest level component logs.
+func (c Config) Level(component string) Level {
+	if level, ok := c.Components[component]; ok {
+		return level
+	}
+	return c.Default
+}
+
+// current is the configuration every Logger follows; Info until Configure
+var current atomic.Pointer[Config]
+
+func init() {
+	current.Store(&Config{Default: Info})
+}
+
+// Configure sets the levels of every Logger.
+func Configure(cfg Config) {
+	current.Store(&cfg)
+}
+
+// Logger writes the lines of one component that are at or above its level.
+type Logger struct {
+	component string
+	printf    func(format string, args ...any)
+	slog      *slog.Logger // Replaces printf when set, see To
+
+	// Sampling state of Eventf
+	events  atomic.Uint64
+	mu      sync.Mutex
+	written map[string]time.Time // Key -> when its last line was written
+	swept   time.Time            // Last time keys idle for a period were dropped
+}
+
+// New returns the Logger of component, writing through printf (log.Printf
+// or similar, adding the newline if needed).
+func New(component string, printf func(format string, args ...any)) *Logger {
+	return &Logger{component: component, printf: printf}
+}
+
+// To returns a Logger of the same component writing records to logger
+// instead, so embedders can route the lines into their own logging stack
+// and tests can inspect them. A record's message is the formatted line, its
+// level the line's and its "component" attribute the component. Lines are
+// still filtered by Configure before logger's handler sees them. A nil
+// logger returns l.
+func (l *Logger) To(logger *slog.Logger) *Logger {
+	if logger == nil {
+		return l
+	}
+	return &Logger{component: l.component, slog: logger}
+}
+
+// slogLevels maps each Level to its slog counterpart
+var slogLevels = [...]slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError}
+
+// write writes a line that passed the level filter.
+func (l *Logger) write(level Level, format string, args ...any) {
+	if l.slog == nil {
+		l.printf(format, args...)
+		return
+	}
+	l.slog.Log(context.Background(), slogLevels[level], fmt.Sprintf(format, args...), "component", l.component)
+}
+
+// Enabled reports whether lines at level are written, so callers can skip
+// building expensive ones.
+func (l *Logger) Enabled(level Level) bool {
+	return level >= current.Load().Level(l.component)
+}
+
+// Logf writes a line at level.
+func (l *Logger) Logf(level Level, format string, args ...any) {
+	if l.Enabled(level) {
+		l.write(level, format, args...)
+	}
+}
+
+// Eventf writes a per-message line at Debug, such as one per update sent,
+// when sampling lets it through. key groups the lines sampled per period,
+// typically the symbol.
+func (l *Logger) Eventf(key, format string, args ...any) {
+	cfg := current.Load()
+	if Debug < cfg.Level(l.component) || !l.sample(cfg.Sampling, key) {
+		return
+	}
+	l.write(Debug, format, args...)
+}
+
+// sample reports whether the next line of key is written.
+func (l *Logger) sample(s Sampling, key string) bool {
+	switch {
+	case s.Period > 0:
+		now := time.Now()
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if now.Sub(l.swept) >= s.Period {
+			l.sweep(now, s.Period)
+		}
+		if last, ok := l.written[key]; ok && now.Sub(last) < s.Period {
+			return false
+		}
+		if l.written == nil {
+			l.written = make(map[string]time.Time)
+		}
+		l.written[key] = now
+		return true
+	case s.Every > 1:
+		return (l.events.Add(1)-1)%s.Every == 0
+	}
+	return true
+}
+
+// sweep drops the keys whose last line is a period old or more, which are
+// the same as keys never seen, so the map only holds recent keys such as
+// the client IPs of the rate limiter. l.mu must be held.
+func (l *Logger) sweep(now time.Time, period time.Duration) {
+	for key, last := range l.written {
+		if now.Sub(last) >= period {
+			delete(l.written, key)
+		}
+	}
+	l.swept = now
+}
+
+func (l *Logger) Debugf(format string, args ...any) { l.Logf(Debug, format, args...) }
+func (l *Logger) Infof(format string, args ...any)  { l.Logf(Info, format, args...) }
+func (l *Logger) Warnf(format string, args ...any)  { l.Logf(Warn, format, args...) }
+func (l *Logger) Errorf(format string, args ...any) { l.Logf(Error, format, args...) }
@@ -0,0 +1,28 @@
+package logging
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSamplingDropsIdleKeys(t *testing.T) {
+	l := New("test", func(string, ...any) {})
+	s := Sampling{Period: 20 * time.Millisecond}
+
+	for _, key := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		if !l.sample(s, key) {
+			t.Fatalf("first line of %s not written", key)
+		}
+	}
+	if l.sample(s, "10.0.0.1") {
+		t.Error("second line of 10.0.0.1 in the same period written")
+	}
+
+	time.Sleep(2 * s.Period)
+	if !l.sample(s, "10.0.0.4") {
+		t.Fatal("first line of 10.0.0.4 not written")
+	}
+	if len(l.written) != 1 {
+		t.Errorf("%d keys kept after the others were idle for a period, want 1", len(l.written))
+	}
+}
@@ -0,0 +1,58 @@
+package marketdata
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"ifin/internal/clock"
+)
+
+// limiter is a token bucket keeping requests to a provider under its quota.
+type limiter struct {
+	clock clock.Clock
+	rate  float64 // Tokens added per second
+	burst float64 // Bucket size
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newLimiter returns nil (no limit) when rate is not positive.
+func newLimiter(rate float64, burst int, clk clock.Clock) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{clock: clk, rate: rate, burst: float64(burst), tokens: float64(burst), last: clk.Now()}
+}
+
+// Wait blocks until the next request may be made, or ctx is done.
+func (l *limiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	now := l.clock.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens-- // Taken now, owed when negative
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	ticker := l.clock.NewTicker(delay)
+	defer ticker.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-ticker.C():
+		return nil
+	}
+}
@@ -0,0 +1,177 @@
+// Package marketdata relays real quotes from a market data provider as a
+// feed.PriceSource. Providers are described rather than coded: a REST quote
+// endpoint polled per symbol, or a WebSocket stream, with the API key, the
+// fields holding the symbol, price and time, and a rate limit.
+package marketdata
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"ifin/internal/clock"
+	"ifin/internal/feed"
+	"ifin/internal/logging"
+)
+
+// marketLog logs provider errors and reconnects, unless Config.Logger is set
+var marketLog = logging.New("marketdata", log.Printf)
+
+// Config describes a provider's API. Paths are dotted, such as data.0.p,
+// with numbers indexing arrays.
+type Config struct {
+	URL     string   // REST quote URL with {symbol} in it, or ws:// or wss:// stream URL
+	Symbols []string // Symbols quoted, substituted for {symbol}
+
+	APIKey    func() string // Returns the API key, re-read on every request or connection; nil or "" sends none
+	KeyParam  string        // Query parameter carrying the key, e.g. token; the X-API-Key header when empty
+	KeyHeader string        // Header carrying the key when KeyParam is empty (X-API-Key)
+
+	ItemsPath  string // Path of the array of quotes in a response or message; empty when it is a single quote
+	SymbolPath string // Path of the symbol in a quote (symbol); REST quotes default to the symbol requested
+	PricePath  string // Path of the price in a quote (price)
+	TimePath   string // Path of the quote time, Unix seconds or milliseconds or RFC 3339; empty stamps the time received
+
+	Subscribe string // WebSocket: message sent for every symbol once connected, with {symbol} replaced
+
+	Interval time.Duration // REST: time between polls of all the symbols
+	Rate     float64       // Requests (REST) or connections and subscriptions (WebSocket) per second; 0 is unlimited
+	Burst    int           // Requests made at once before Rate applies (1)
+
+	Logger *slog.Logger // Receives errors and reconnects; the standard logger when nil
+}
+
+// New returns the source of the provider cfg describes, on clk: a stream
+// for ws:// and wss:// URLs, otherwise REST quotes polled every Interval.
+func New(cfg Config, clk clock.Clock) (feed.PriceSource, error) {
+	if len(cfg.Symbols) == 0 {
+		return nil, errors.New("no symbols to quote")
+	}
+	if cfg.APIKey == nil {
+		cfg.APIKey = func() string { return "" }
+	}
+	if cfg.KeyHeader == "" {
+		cfg.KeyHeader = "X-API-Key"
+	}
+	if cfg.PricePath == "" {
+		cfg.PricePath = "price"
+	}
+
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("provider URL: %w", err)
+	}
+	switch u.Scheme {
+	case "ws", "wss":
+		if cfg.SymbolPath == "" {
+			cfg.SymbolPath = "symbol"
+		}
+		return newStream(cfg, clk), nil
+	case "http", "https":
+		if !strings.Contains(cfg.URL, "{symbol}") {
+			return nil, errors.New("provider URL: no {symbol} to substitute")
+		}
+		return feed.NewPoller(newREST(cfg, clk).fetch, clk, cfg.Interval), nil
+	default:
+		return nil, fmt.Errorf("provider URL: unsupported scheme %q", u.Scheme)
+	}
+}
+
+// quotes extracts the updates in a decoded response or message. symbol is
+// used for quotes without SymbolPath; quotes missing a field are skipped.
+func quotes(cfg Config, body any, symbol string) []feed.Update {
+	items := []any{body}
+	if cfg.ItemsPath != "" {
+		found, _ := lookup(body, cfg.ItemsPath)
+		list, ok := found.([]any)
+		if !ok {
+			return nil
+		}
+		items = list
+	}
+
+	var updates []feed.Update
+	for _, item := range items {
+		update := feed.Update{Symbol: symbol}
+		if cfg.SymbolPath != "" {
+			if s, ok := lookupString(item, cfg.SymbolPath); ok {
+				update.Symbol = s
+			}
+		}
+		price, ok := lookupNumber(item, cfg.PricePath)
+		if !ok || update.Symbol == "" {
+			continue
+		}
+		update.Price = price
+		if cfg.TimePath != "" {
+			update.Timestamp = lookupTime(item, cfg.TimePath)
+		}
+		updates = append(updates, update)
+	}
+	return updates
+}
+
+// lookup follows a dotted path through decoded JSON.
+func lookup(v any, path string) (any, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			next, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func lookupString(v any, path string) (string, bool) {
+	found, _ := lookup(v, path)
+	s, ok := found.(string)
+	return s, ok && s != ""
+}
+
+// lookupNumber reads a number, which some providers send as a string.
+func lookupNumber(v any, path string) (float64, bool) {
+	found, _ := lookup(v, path)
+	switch n := found.(type) {
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// lookupTime reads a time as Unix milliseconds, or 0 when there is none.
+// Numbers below 1e12 are taken as seconds.
+func lookupTime(v any, path string) int64 {
+	if n, ok := lookupNumber(v, path); ok {
+		if n < 1e12 {
+			n *= 1000
+		}
+		return int64(n)
+	}
+	if s, ok := lookupString(v, path); ok {
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return t.UnixMilli()
+		}
+	}
+	return 0
+}
@@ -0,0 +1,98 @@
+package marketdata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"ifin/internal/clock"
+	"ifin/internal/feed"
+	"ifin/internal/logging"
+)
+
+// requestTimeout bounds each quote request
+const requestTimeout = 10 * time.Second
+
+// rest polls a REST provider, one request per symbol.
+type rest struct {
+	cfg     Config
+	client  *http.Client
+	limiter *limiter
+	log     *logging.Logger
+}
+
+func newREST(cfg Config, clk clock.Clock) *rest {
+	return &rest{cfg: cfg, client: &http.Client{Timeout: requestTimeout}, limiter: newLimiter(cfg.Rate, cfg.Burst, clk), log: marketLog.To(cfg.Logger)}
+}
+
+// fetch quotes every symbol, within the rate limit. Symbols that fail are
+// logged and left out; fetch only fails when all of them do.
+func (r *rest) fetch(ctx context.Context) ([]feed.Update, error) {
+	var updates []feed.Update
+	var errs []error
+	for _, symbol := range r.cfg.Symbols {
+		if err := r.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+		quoted, err := r.quote(ctx, symbol)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", symbol, err))
+			continue
+		}
+		updates = append(updates, quoted...)
+	}
+	if len(updates) == 0 && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	for _, err := range errs {
+		r.log.Warnf("Error quoting %v", err)
+	}
+	return updates, nil
+}
+
+// quote requests the quote of symbol.
+func (r *rest) quote(ctx context.Context, symbol string) ([]feed.Update, error) {
+	target := strings.ReplaceAll(r.cfg.URL, "{symbol}", url.PathEscape(symbol))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if key := r.cfg.APIKey(); key != "" {
+		if r.cfg.KeyParam != "" {
+			query := req.URL.Query()
+			query.Set(r.cfg.KeyParam, key)
+			req.URL.RawQuery = query.Encode()
+		} else {
+			req.Header.Set(r.cfg.KeyHeader, key)
+		}
+	}
+
+	resp, err := r.client.Do(req)
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return nil, urlErr.Err // Its message has the URL, and maybe the key in it
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status) // The URL is left out, it may carry the key
+	}
+
+	var body any
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	quoted := quotes(r.cfg, body, symbol)
+	if len(quoted) == 0 {
+		return nil, fmt.Errorf("no price at %s", r.cfg.PricePath)
+	}
+	return quoted, nil
+}
@@ -0,0 +1,174 @@
+package marketdata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"ifin/internal/clock"
+	"ifin/internal/feed"
+	"ifin/internal/logging"
+)
+
+// Delays between attempts to reconnect to a stream, doubled on each failure
+const (
+	reconnectDelay = time.Second
+	reconnectMax   = time.Minute
+)
+
+// stream is the source of a WebSocket provider. It stays connected in the
+// background from New to Close, reconnecting when the connection drops.
+type stream struct {
+	cfg     Config
+	clock   clock.Clock
+	limiter *limiter
+	log     *logging.Logger
+	updates chan feed.Update
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newStream(cfg Config, clk clock.Clock) *stream {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &stream{cfg: cfg, clock: clk, limiter: newLimiter(cfg.Rate, cfg.Burst, clk), log: marketLog.To(cfg.Logger), updates: make(chan feed.Update, 64), cancel: cancel}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer close(s.updates)
+		s.run(ctx)
+	}()
+	return s
+}
+
+// Next returns the next quote streamed, or io.EOF once the source is closed.
+func (s *stream) Next(ctx context.Context) (feed.Update, error) {
+	select {
+	case <-ctx.Done():
+		return feed.Update{}, ctx.Err()
+	case update, ok := <-s.updates:
+		if !ok {
+			return feed.Update{}, io.EOF
+		}
+		return update, nil
+	}
+}
+
+// Close disconnects and waits for the background connection to end.
+func (s *stream) Close() error {
+	s.cancel()
+	s.wg.Wait()
+	return nil
+}
+
+// run keeps the stream connected until ctx is done.
+func (s *stream) run(ctx context.Context) {
+	delay := reconnectDelay
+	for {
+		connected := s.clock.Now()
+		err := s.consume(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if s.clock.Now().Sub(connected) > reconnectMax {
+			delay = reconnectDelay // It was up for a while: not a failing provider
+		}
+		s.log.Warnf("Market data stream ended: %v, reconnecting in %v", err, delay)
+
+		ticker := s.clock.NewTicker(delay)
+		select {
+		case <-ctx.Done():
+		case <-ticker.C():
+		}
+		ticker.Stop()
+		delay = min(2*delay, reconnectMax)
+	}
+}
+
+// consume connects, subscribes to every symbol and passes the quotes
+// received on until the connection fails or ctx is done.
+func (s *stream) consume(ctx context.Context) error {
+	if err := s.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	s.log.Infof("Connected to the market data stream, subscribing to %d symbols", len(s.cfg.Symbols))
+
+	if s.cfg.Subscribe != "" {
+		for _, symbol := range s.cfg.Symbols {
+			if err := s.limiter.Wait(ctx); err != nil {
+				return err
+			}
+			if err := websocket.Message.Send(conn, strings.ReplaceAll(s.cfg.Subscribe, "{symbol}", symbol)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for {
+		var message string
+		if err := websocket.Message.Receive(conn, &message); err != nil {
+			return err
+		}
+		var body any
+		if err := json.Unmarshal([]byte(message), &body); err != nil {
+			s.log.Debugf("Skipping a message that is not JSON: %v", err)
+			continue
+		}
+		for _, update := range quotes(s.cfg, body, "") {
+			feed.Stamp(&update, s.clock)
+			select {
+			case s.updates <- update:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// dial opens the stream, with the API key in the query or a header.
+func (s *stream) dial(ctx context.Context) (*websocket.Conn, error) {
+	target, err := url.Parse(s.cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	key := s.cfg.APIKey()
+	if key != "" && s.cfg.KeyParam != "" {
+		query := target.Query()
+		query.Set(s.cfg.KeyParam, key)
+		target.RawQuery = query.Encode()
+	}
+
+	origin := "http://" + target.Host
+	if target.Scheme == "wss" {
+		origin = "https://" + target.Host
+	}
+	config, err := websocket.NewConfig(target.String(), origin)
+	if err != nil {
+		return nil, err
+	}
+	if key != "" && s.cfg.KeyParam == "" {
+		config.Header = http.Header{}
+		config.Header.Set(s.cfg.KeyHeader, key)
+	}
+	conn, err := config.DialContext(ctx)
+	var dialErr *websocket.DialError
+	if errors.As(err, &dialErr) {
+		err = dialErr.Err // Its message has the URL, and maybe the key in it
+	}
+	return conn, err
+}
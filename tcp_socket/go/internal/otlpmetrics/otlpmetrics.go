@@ -0,0 +1,137 @@
+// Package otlpmetrics pushes the metrics served on /metrics to an
+// OpenTelemetry collector over OTLP/gRPC, for deployments that collect
+// metrics that way rather than by scraping.
+package otlpmetrics
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"ifin/internal/promtext"
+)
+
+// Collect writes the current value of every metric to sink, as the
+// /metrics handlers do.
+type Collect func(sink promtext.Sink)
+
+// Start exports what collect writes to the collector at endpoint (host:port,
+// plaintext) every interval, under the resource of service. With no
+// endpoint or interval nothing is exported. The returned function sends a
+// last export and must be called before exiting.
+func Start(ctx context.Context, endpoint, service string, interval time.Duration, collect Collect) (shutdown func(context.Context) error, err error) {
+	if endpoint == "" || interval <= 0 {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithEndpoint(endpoint), otlpmetricgrpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+	reader := sdkmetric.NewPeriodicReader(exporter,
+		sdkmetric.WithInterval(interval),
+		sdkmetric.WithProducer(&producer{collect: collect, start: time.Now()}),
+	)
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(reader),
+		sdkmetric.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(service))),
+	)
+	return provider.Shutdown, nil
+}
+
+// producer hands the reader the metrics collect writes at each export.
+type producer struct {
+	collect Collect
+	start   time.Time // Start of the cumulative counters and histograms
+}
+
+func (p *producer) Produce(context.Context) ([]metricdata.ScopeMetrics, error) {
+	c := &converter{start: p.start, now: time.Now()}
+	p.collect(c)
+	c.flush()
+	return []metricdata.ScopeMetrics{{
+		Scope:   instrumentation.Scope{Name: "ifin/internal/otlpmetrics"},
+		Metrics: c.metrics,
+	}}, nil
+}
+
+// converter is a promtext.Sink building OTLP metrics: counters become
+// cumulative monotonic sums, without the _total suffix the collector's
+// Prometheus exporter adds back, and histogram buckets stop being
+// cumulative.
+type converter struct {
+	start, now time.Time
+	metrics    []metricdata.Metrics
+
+	// The family being written
+	name, kind, help string
+	points           []metricdata.DataPoint[float64]
+	histograms       []metricdata.HistogramDataPoint[float64]
+}
+
+func (c *converter) Family(name, kind, help string) {
+	c.flush()
+	c.name, c.kind, c.help = name, kind, help
+}
+
+func (c *converter) Sample(name string, value float64, labels ...string) {
+	c.points = append(c.points, metricdata.DataPoint[float64]{
+		Attributes: attributes(labels),
+		StartTime:  c.start,
+		Time:       c.now,
+		Value:      value,
+	})
+}
+
+func (c *converter) Histogram(name string, bounds []float64, counts []uint64, sum float64, labels ...string) {
+	point := metricdata.HistogramDataPoint[float64]{
+		Attributes:   attributes(labels),
+		StartTime:    c.start,
+		Time:         c.now,
+		Bounds:       bounds,
+		BucketCounts: make([]uint64, len(counts)),
+		Sum:          sum,
+	}
+	var below uint64
+	for i, count := range counts {
+		point.BucketCounts[i] = count - below
+		below = count
+	}
+	point.Count = below
+	c.histograms = append(c.histograms, point)
+}
+
+// flush adds the family written so far to the metrics.
+func (c *converter) flush() {
+	if c.name == "" {
+		return
+	}
+	m := metricdata.Metrics{Name: c.name, Description: c.help}
+	switch c.kind {
+	case promtext.Counter:
+		m.Name = strings.TrimSuffix(m.Name, "_total")
+		m.Data = metricdata.Sum[float64]{DataPoints: c.points, Temporality: metricdata.CumulativeTemporality, IsMonotonic: true}
+	case promtext.Histogram:
+		m.Data = metricdata.Histogram[float64]{DataPoints: c.histograms, Temporality: metricdata.CumulativeTemporality}
+	default:
+		m.Data = metricdata.Gauge[float64]{DataPoints: c.points}
+	}
+	c.metrics = append(c.metrics, m)
+	c.name, c.points, c.histograms = "", nil, nil
+}
+
+// attributes converts promtext name, value label pairs.
+func attributes(labels []string) attribute.Set {
+	kvs := make([]attribute.KeyValue, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		kvs = append(kvs, attribute.String(labels[i], labels[i+1]))
+	}
+	return attribute.NewSet(kvs...)
+}
@@ -0,0 +1,103 @@
+// Package promtext writes metrics in the Prometheus text exposition format,
+// so /metrics can be served without a client library.
+package promtext
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the Content-Type of the text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Metric types, for Family
+const (
+	Counter   = "counter"
+	Gauge     = "gauge"
+	Histogram = "histogram"
+)
+
+// Sink receives metric families, each followed by its samples. Writer is
+// the text format one; internal/otlpmetrics converts them for OTLP export,
+// so every metric is defined once for both.
+type Sink interface {
+	Family(name, kind, help string)
+	Sample(name string, value float64, labels ...string)
+	Histogram(name string, bounds []float64, counts []uint64, sum float64, labels ...string)
+}
+
+// Writer writes metric families one after the other. The first write error
+// is kept and returned by Err; later writes are skipped.
+type Writer struct {
+	w   io.Writer
+	err error
+}
+
+// NewWriter writes to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Err returns the first write error.
+func (w *Writer) Err() error {
+	return w.err
+}
+
+// Family starts the metric family name, of type kind. Its samples follow.
+func (w *Writer) Family(name, kind, help string) {
+	w.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// Sample writes one sample. labels are name, value pairs.
+func (w *Writer) Sample(name string, value float64, labels ...string) {
+	w.printf("%s%s %s\n", name, formatLabels(labels), strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// Histogram writes the samples of one histogram: the cumulative counts of
+// the buckets with upper bounds, followed by +Inf (so counts has one more
+// entry than bounds), then the sum and count.
+func (w *Writer) Histogram(name string, bounds []float64, counts []uint64, sum float64, labels ...string) {
+	for i, count := range counts {
+		le := "+Inf"
+		if i < len(bounds) {
+			le = strconv.FormatFloat(bounds[i], 'g', -1, 64)
+		}
+		w.Sample(name+"_bucket", float64(count), append(labels[:len(labels):len(labels)], "le", le)...)
+	}
+	w.Sample(name+"_sum", sum, labels...)
+	var total uint64
+	if len(counts) > 0 {
+		total = counts[len(counts)-1]
+	}
+	w.Sample(name+"_count", float64(total), labels...)
+}
+
+func (w *Writer) printf(format string, args ...any) {
+	if w.err == nil {
+		_, w.err = fmt.Fprintf(w.w, format, args...)
+	}
+}
+
+// formatLabels renders name, value pairs as {name="value",...}.
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(labels[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
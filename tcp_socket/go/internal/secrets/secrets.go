@@ -0,0 +1,111 @@
+// Package secrets loads credentials from files or environment variables and
+// re-reads them periodically, so they can be rotated without a restart.
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Refresher is anything that can re-read its value from its source.
+type Refresher interface {
+	Refresh() (changed bool, err error)
+	Name() string // What is refreshed, for logs and reload notifications
+}
+
+// Secret is a credential named after an environment variable. When NAME_FILE
+// is set the value is read from that file (and re-read on every Refresh),
+// otherwise the value of NAME itself is used.
+type Secret struct {
+	name string
+	file string
+
+	mu    sync.RWMutex
+	value string
+}
+
+// FromEnv resolves the secret called name. An unset secret is not an error;
+// its Value is simply empty.
+func FromEnv(name string) (*Secret, error) {
+	s := &Secret{name: name, file: os.Getenv(name + "_FILE")}
+	if s.file == "" {
+		s.value = os.Getenv(name)
+		return s, nil
+	}
+
+	if _, err := s.Refresh(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Name returns the name of the secret.
+func (s *Secret) Name() string {
+	return s.name
+}
+
+// Value returns the current value of the secret.
+func (s *Secret) Value() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.value
+}
+
+// Refresh re-reads a file-backed secret, reporting whether it was rotated.
+// Environment values cannot change while the process runs, so for those it
+// does nothing.
+func (s *Secret) Refresh() (bool, error) {
+	if s.file == "" {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(s.file)
+	if err != nil {
+		return false, fmt.Errorf("reading %s from %s: %w", s.name, s.file, err)
+	}
+	value := strings.TrimSpace(string(data))
+
+	s.mu.Lock()
+	changed := s.value != "" && s.value != value
+	s.value = value
+	s.mu.Unlock()
+
+	if changed {
+		log.Printf("Secret %s rotated", s.name)
+	}
+	return changed, nil
+}
+
+// Watch refreshes every item each interval until ctx is done, calling
+// onReload, when not nil, with the name of each item a new value was picked
+// up for. A failed refresh is logged and the previous value is kept. An
+// interval of zero or less disables refreshing, and Watch returns at once.
+func Watch(ctx context.Context, interval time.Duration, onReload func(name string), items ...Refresher) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, item := range items {
+				changed, err := item.Refresh()
+				if err != nil {
+					log.Printf("Error refreshing secret: %v", err)
+				}
+				if changed && onReload != nil {
+					onReload(item.Name())
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package serve
+
+import (
+	"net"
+	"sync/atomic"
+
+	"github.com/redis/go-redis/v9"
+
+	"ifin/internal/audit"
+	"ifin/internal/secrets"
+)
+
+// countingConn counts the bytes read from and written to a connection so the
+// totals can be reported when it closes, adding them to the server's metrics.
+type countingConn struct {
+	net.Conn
+	metrics  *serverMetrics
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.bytesIn.Add(int64(n))
+	c.metrics.bytesIn.Add(uint64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.bytesOut.Add(int64(n))
+	c.metrics.bytesOut.Add(uint64(n))
+	return n, err
+}
+
+// openAuditSink picks the audit sink from the flags: a Redis stream when an
+// address is given, otherwise a JSON lines file, otherwise nothing.
+func openAuditSink(file, redisAddr, stream string, maxLen int64, password *secrets.Secret) (audit.Sink, error) {
+	switch {
+	case redisAddr != "":
+		rdb := redis.NewClient(&redis.Options{
+			Addr: redisAddr,
+			CredentialsProvider: func() (string, string) {
+				return "", password.Value()
+			},
+		})
+		return audit.NewRedisSink(rdb, stream, maxLen), nil
+	case file != "":
+		return audit.NewFileSink(file)
+	default:
+		return audit.Discard, nil
+	}
+}
@@ -0,0 +1,102 @@
+package serve
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"os/signal"
+	"runtime"
+	"slices"
+	"syscall"
+	"time"
+
+	"ifin/internal/broadcast"
+)
+
+// dumpSeqs is how many of each symbol's latest sequence numbers a dump shows
+const dumpSeqs = 10
+
+// stateDump is the server's internal state, written on SIGUSR1.
+type stateDump struct {
+	Time       time.Time                `json:"time"`
+	Goroutines int                      `json:"goroutines"`
+	Clients    []clientState            `json:"clients"`
+	Queues     queueDepths              `json:"queues"`
+	Symbols    []broadcast.JournalState `json:"symbols"`
+}
+
+// clientState is one authenticated client and its subscription.
+type clientState struct {
+	Addr     string   `json:"addr"`
+	Symbols  []string `json:"symbols"` // Nil when subscribed to everything
+	BytesIn  int64    `json:"bytes_in"`
+	BytesOut int64    `json:"bytes_out"`
+}
+
+type queueDepths struct {
+	PendingHandshakes int `json:"pending_handshakes"`
+	MaxPending        int `json:"max_pending"`
+}
+
+// snapshotState collects the current state.
+func (s *server) snapshotState() stateDump {
+	d := stateDump{
+		Time:       s.clock.Now(),
+		Goroutines: runtime.NumGoroutine(),
+		Queues:     queueDepths{PendingHandshakes: len(s.pending), MaxPending: cap(s.pending)},
+		Symbols:    s.hub.Journal(dumpSeqs),
+	}
+
+	s.hub.Each(func(conn net.Conn, symbols []string) {
+		c := clientState{Addr: conn.RemoteAddr().String(), Symbols: symbols}
+		if counted, ok := conn.(*countingConn); ok {
+			c.BytesIn, c.BytesOut = counted.bytesIn.Load(), counted.bytesOut.Load()
+		}
+		d.Clients = append(d.Clients, c)
+	})
+	slices.SortFunc(d.Clients, func(a, b clientState) int { return cmp.Compare(a.Addr, b.Addr) })
+	return d
+}
+
+// dumpOnSignal writes the state on every SIGUSR1 until ctx is done:
+// indented to path, replacing the previous dump, or logged on one line when
+// path is empty.
+func (s *server) dumpOnSignal(ctx context.Context, path string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+		}
+		if err := s.dumpState(path); err != nil {
+			s.serverLog.Errorf("Error dumping state: %v", err)
+		}
+	}
+}
+
+func (s *server) dumpState(path string) error {
+	d := s.snapshotState()
+	if path == "" {
+		data, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		s.serverLog.Infof("State: %s", data)
+		return nil
+	}
+
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	s.serverLog.Infof("State dumped to %s", path)
+	return nil
+}
@@ -0,0 +1,75 @@
+package serve
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"ifin/internal/audit"
+	"ifin/internal/clock"
+	"ifin/internal/feed"
+)
+
+// Options configures a Server made by New. Zero values take the defaults
+// of the serve flags, without accept throttling.
+type Options struct {
+	JournalSize  int           // Recent updates kept per symbol for replays (1000)
+	MaxPending   int           // Connections that may be in their handshake at once (100)
+	AcceptRate   float64       // New connections accepted per second; 0 disables throttling
+	AcceptBurst  int           // Connections accepted at once before AcceptRate applies
+	TickInterval time.Duration // Time between simulated updates when Source is nil (2s)
+	AuthToken    func() string // Token clients must present; nil or empty disables authentication
+	Source       feed.PriceSource
+	Audit        audit.Sink   // Where connection audit events are recorded; nil records nothing
+	Clock        clock.Clock  // The system clock when nil
+	Logger       *slog.Logger // The standard logger when nil
+}
+
+// Server is the feed server without the command around it, for programs
+// embedding it; see pkg/feed. Hooks registered in this package apply.
+type Server struct {
+	srv *server
+}
+
+// New returns a server broadcasting the updates of opts.Source, or of the
+// simulator when nil.
+func New(opts Options) *Server {
+	if opts.JournalSize <= 0 {
+		opts.JournalSize = 1000
+	}
+	if opts.MaxPending <= 0 {
+		opts.MaxPending = 100
+	}
+	return &Server{srv: newServer(serverConfig{
+		JournalSize:  opts.JournalSize,
+		MaxPending:   opts.MaxPending,
+		AcceptRate:   opts.AcceptRate,
+		AcceptBurst:  opts.AcceptBurst,
+		TickInterval: opts.TickInterval,
+		AuthToken:    opts.AuthToken,
+		Hooks:        registeredHooks(),
+	}, opts.Logger, opts.Clock, opts.Source, opts.Audit)}
+}
+
+// Run broadcasts the source's updates to the clients accepted on listener
+// until ctx is done or accepting fails, then closes the connections of the
+// clients left and returns the failure. It closes listener.
+func (s *Server) Run(ctx context.Context, listener net.Listener) error {
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		s.srv.messageBroadcaster(ctx)
+		return nil
+	})
+	g.Go(func() error { return s.srv.serve(ctx, listener) })
+	err := g.Wait()
+	s.srv.shutdown()
+	return err
+}
+
+// Clients returns the number of authenticated clients connected.
+func (s *Server) Clients() int {
+	return s.srv.hub.Clients()
+}
@@ -0,0 +1,41 @@
+package serve
+
+import (
+	"ifin/internal/feed"
+	"ifin/internal/hooks"
+)
+
+// serverHooks run user code in the server's pipeline. Hooks are registered
+// with registerHooks from an init function in a file of their own added to
+// this package, so enrichment, filtering or auditing need no change to the
+// rest of it. Returning hooks.Skip drops an update or client quietly; other
+// errors are logged.
+type serverHooks struct {
+	OnGenerate      hooks.Chain[feed.Update] // Every update of the price source, before it is published
+	BeforeBroadcast hooks.Chain[feed.Update] // Every update published, before it is numbered and sent (see broadcast.Hub)
+	OnClientConnect hooks.Chain[clientInfo]  // Every authenticated client, before it is served; an error disconnects it
+}
+
+// clientInfo is the client an OnClientConnect hook is run on.
+type clientInfo struct {
+	RemoteAddr string
+	Identity   string // From AUTH, as audited
+}
+
+// hookSetups are the functions passed to registerHooks
+var hookSetups []func(*serverHooks)
+
+// registerHooks has setup add hooks to every server made by newServer.
+// Call it from init functions only.
+func registerHooks(setup func(*serverHooks)) {
+	hookSetups = append(hookSetups, setup)
+}
+
+// registeredHooks returns the hooks added by the registered setups.
+func registeredHooks() serverHooks {
+	var h serverHooks
+	for _, setup := range hookSetups {
+		setup(&h)
+	}
+	return h
+}
@@ -0,0 +1,15 @@
+package serve
+
+import (
+	"log"
+
+	"ifin/internal/logging"
+)
+
+// Loggers of the server's components, unless newServer is given a logger,
+// whose levels are set by -log-level and overridden by -log-components
+var (
+	serverLog = logging.New("server", log.Printf) // Startup, shutdown and side servers
+	connLog   = logging.New("conn", log.Printf)   // Accepting, authenticating and dropping clients
+	statsLog  = logging.New("stats", log.Printf)  // The periodic stats line
+)
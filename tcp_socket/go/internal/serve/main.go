@@ -0,0 +1,273 @@
+// Package serve is the feed server run by "stockfeed serve": it accepts
+// feed clients over TCP, authenticates them and broadcasts the updates of
+// its price source to those subscribed.
+package serve
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"ifin/internal/cli"
+	"ifin/internal/clock"
+	"ifin/internal/debug"
+	"ifin/internal/errreport"
+	"ifin/internal/feed"
+	"ifin/internal/healthcheck"
+	"ifin/internal/marketdata"
+	"ifin/internal/otlpmetrics"
+	"ifin/internal/secrets"
+	"ifin/internal/tracing"
+)
+
+// envPrefix is prepended to the upper-cased flag name to form the environment
+// variable that can set it, e.g. -listen becomes SERVER_LISTEN.
+const envPrefix = "SERVER_"
+
+// Main runs "stockfeed serve": it broadcasts prices to the feed clients, as
+// args and the environment configure, until SIGINT or SIGTERM. It exits
+// with status 1 when the server stops on an error.
+func Main(args []string) {
+	run(args, false)
+}
+
+// Healthcheck runs "stockfeed healthcheck serve": it probes the server the
+// same args and environment configure, instead of running one.
+func Healthcheck(args []string) {
+	run(args, true)
+}
+
+// run parses args, then probes the server they configure or runs it.
+func run(args []string, probe bool) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	tlsCert := fs.String("tls-cert", "", "TLS certificate file (TLS is enabled when set together with -tls-key)")
+	tlsKey := fs.String("tls-key", "", "TLS private key file")
+	tlsClientCA := fs.String("tls-client-ca", "", "Require client certificates signed by a CA in this bundle (mutual TLS)")
+	secretRefresh := fs.Duration("secret-refresh", 30*time.Second, "How often secrets and certificates are re-read (0 disables)")
+	auditFile := fs.String("audit-file", "", "Append connection audit events to this file as JSON lines")
+	auditRedis := fs.String("audit-redis", "", "Write connection audit events to a stream on this Redis server")
+	auditStream := fs.String("audit-stream", "feed:audit", "Redis stream used by -audit-redis")
+	auditMaxLen := fs.Int64("audit-maxlen", 100000, "Approximate cap on the audit stream length")
+	acceptRate := fs.Float64("accept-rate", 200, "Maximum new connections accepted per second (0 disables throttling)")
+	acceptBurst := fs.Int("accept-burst", 50, "Connections that may be accepted at once before -accept-rate applies")
+	maxPending := fs.Int("max-pending", 100, "Maximum connections that may be in their handshake at the same time (at least 1)")
+	network := fs.String("network", "tcp", "Network to listen on: tcp, or unix for a socket path in -listen")
+	listenAddr := fs.String("listen", ":9501", "Address to listen on (a socket path with -network unix)")
+	journalSize := fs.Int("journal-size", 1000, "Recent updates kept per symbol for clients replaying what they missed (0 disables replays)")
+	statsInterval := fs.Duration("stats-interval", 10*time.Second, "How often clients, broadcasts, bytes and write errors are logged (0 disables)")
+	metricsAddr := fs.String("metrics-addr", ":9502", "HTTP address serving Prometheus /metrics (empty disables it)")
+	debugAddr := fs.String("debug-addr", "", "Address serving pprof profiles under /debug/pprof/ and runtime stats on /debug/stats, e.g. localhost:6061 (disabled when empty)")
+	var logFlags cli.LogFlags
+	logFlags.Register(fs, "server, conn, broadcaster, commands, journal, stats, marketdata", "broadcaster=warn,conn=debug")
+	otlpEndpoint := fs.String("otlp-endpoint", "", "host:port of an OTLP/gRPC collector receiving trace spans and metrics, e.g. localhost:4317 (both are disabled when empty)")
+	traceSample := fs.Float64("trace-sample", 1, "Fraction of ticks traced when -otlp-endpoint is set")
+	otlpMetricsInterval := fs.Duration("otlp-metrics-interval", 15*time.Second, "How often the /metrics counters are pushed to -otlp-endpoint (0 disables metrics export)")
+	dumpFile := fs.String("dump-file", "", "Write the internal state (clients, subscriptions, queues, latest sequence numbers) to this file on SIGUSR1 instead of logging it")
+	source := fs.String("source", "simulator", "Where prices come from: simulator (random), csv (a replay of -source-file), http (polls of -source-url) or market (a market data provider, see -market-url)")
+	sourceFile := fs.String("source-file", "", "CSV file of symbol,price[,time] rows replayed by -source csv")
+	sourceURL := fs.String("source-url", "", "URL answering a JSON array of {\"symbol\",\"price\"} updates, polled by -source http")
+	tickInterval := fs.Duration("tick-interval", 2*time.Second, "Time between simulated updates, polls of -source-url, and replayed rows without a recorded time")
+	replaySpeed := fs.Float64("replay-speed", 1, "How many times faster than recorded -source csv replays (0 ignores the recorded times and uses -tick-interval)")
+	replayLoop := fs.Bool("replay-loop", false, "Start -source csv over at the end of the file instead of stopping")
+	marketURL := fs.String("market-url", "", "Market data provider of -source market: a REST quote URL with {symbol} in it, polled every -tick-interval, or a ws:// or wss:// stream (the key is read from MARKET_API_KEY or the file named by MARKET_API_KEY_FILE)")
+	marketSymbols := fs.String("market-symbols", strings.Join(feed.Symbols, ","), "Comma-separated symbols quoted by -source market")
+	marketKeyParam := fs.String("market-key-param", "", "Query parameter carrying the API key, e.g. token (sent in -market-key-header when empty)")
+	marketKeyHeader := fs.String("market-key-header", "X-API-Key", "Header carrying the API key when -market-key-param is empty")
+	marketItems := fs.String("market-items-path", "", "Dotted path of the array of quotes in each response or message, e.g. data (empty when each is a single quote)")
+	marketSymbolPath := fs.String("market-symbol-path", "", "Dotted path of the symbol in a quote (symbol for streams; REST quotes default to the symbol requested)")
+	marketPrice := fs.String("market-price-path", "price", "Dotted path of the price in a quote, e.g. c or quote.latestPrice")
+	marketTime := fs.String("market-time-path", "", "Dotted path of the quote time, Unix seconds or milliseconds or RFC 3339 (the time received when empty)")
+	marketSubscribe := fs.String("market-subscribe", "", `Message sent for every symbol once connected to a stream, e.g. {"type":"subscribe","symbol":"{symbol}"}`)
+	marketRate := fs.Float64("market-rate", 1, "Requests per second allowed by the provider's quota, connections and subscriptions for streams (0 is unlimited)")
+	marketBurst := fs.Int("market-burst", 5, "Requests made at once before -market-rate applies")
+	sentryDSN := fs.String("sentry-dsn", "", "Report panics and connection handler crashes to this Sentry, or Sentry-compatible, DSN (disabled when empty)")
+	if err := cli.Parse(fs, envPrefix, args); err != nil {
+		log.Fatalf("Error in configuration: %v", err)
+	}
+
+	if probe {
+		healthcheck.Exit(checkHealth(*network, *listenAddr, *metricsAddr))
+	}
+	if *maxPending < 1 {
+		log.Fatalf("Error in configuration: -max-pending must be at least 1")
+	}
+	if *journalSize < 0 {
+		log.Fatalf("Error in configuration: -journal-size must not be negative")
+	}
+	if *tickInterval <= 0 {
+		log.Fatalf("Error in configuration: -tick-interval must be positive")
+	}
+
+	// Set on a failure once serving; deferred first so it exits after the
+	// other deferred calls have cleaned up
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
+	if err := logFlags.Configure(); err != nil {
+		log.Fatalf("Error in log configuration: %v", err)
+	}
+
+	if *sentryDSN != "" {
+		reporter, err := errreport.NewSentry(*sentryDSN, "feed-server")
+		if err != nil {
+			log.Fatalf("Error setting up error reporting: %v", err)
+		}
+		errreport.Use(reporter)
+		defer errreport.Flush(2 * time.Second)
+	}
+
+	// The root context is cancelled on SIGINT/SIGTERM and stops every goroutine
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, *otlpEndpoint, "feed-server", *traceSample)
+	if err != nil {
+		log.Fatalf("Error setting up tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	// Load the auth token from FEED_AUTH_TOKEN or the file named by FEED_AUTH_TOKEN_FILE
+	authToken, err := secrets.FromEnv("FEED_AUTH_TOKEN")
+	if err != nil {
+		log.Fatalf("Error loading auth token: %v", err)
+	}
+	redisPassword, err := secrets.FromEnv("REDIS_PASSWORD")
+	if err != nil {
+		log.Fatalf("Error loading Redis password: %v", err)
+	}
+	marketKey, err := secrets.FromEnv("MARKET_API_KEY")
+	if err != nil {
+		log.Fatalf("Error loading market data API key: %v", err)
+	}
+	refreshers := []secrets.Refresher{authToken, redisPassword, marketKey}
+
+	auditLog, err := openAuditSink(*auditFile, *auditRedis, *auditStream, *auditMaxLen, redisPassword)
+	if err != nil {
+		log.Fatalf("Error opening audit sink: %v", err)
+	}
+	defer auditLog.Close()
+
+	prices, err := openSource(sourceConfig{
+		Kind:        *source,
+		File:        *sourceFile,
+		URL:         *sourceURL,
+		Interval:    *tickInterval,
+		ReplaySpeed: *replaySpeed,
+		ReplayLoop:  *replayLoop,
+		Market: marketdata.Config{
+			URL:        *marketURL,
+			Symbols:    strings.Split(*marketSymbols, ","),
+			APIKey:     marketKey.Value,
+			KeyParam:   *marketKeyParam,
+			KeyHeader:  *marketKeyHeader,
+			ItemsPath:  *marketItems,
+			SymbolPath: *marketSymbolPath,
+			PricePath:  *marketPrice,
+			TimePath:   *marketTime,
+			Subscribe:  *marketSubscribe,
+			Rate:       *marketRate,
+			Burst:      *marketBurst,
+		},
+	}, clock.Real)
+	if err != nil {
+		log.Fatalf("Error opening price source: %v", err)
+	}
+	defer prices.Close()
+
+	srv := newServer(serverConfig{
+		JournalSize:  *journalSize,
+		MaxPending:   *maxPending,
+		AcceptRate:   *acceptRate,
+		AcceptBurst:  *acceptBurst,
+		TickInterval: *tickInterval,
+		AuthToken:    authToken.Value,
+		Hooks:        registeredHooks(),
+	}, nil, clock.Real, prices, auditLog)
+
+	shutdownMetrics, err := otlpmetrics.Start(ctx, *otlpEndpoint, "feed-server", *otlpMetricsInterval, srv.writeMetrics)
+	if err != nil {
+		log.Fatalf("Error setting up metrics export: %v", err)
+	}
+	defer shutdownMetrics(context.Background())
+
+	// Start the TCP server
+	if *network == "unix" {
+		os.Remove(*listenAddr) // Left behind if the previous run did not exit cleanly
+	}
+	listener, err := net.Listen(*network, *listenAddr)
+	if err != nil {
+		log.Fatalf("Error starting server: %v", err)
+	}
+	defer listener.Close()
+
+	if *tlsCert != "" && *tlsKey != "" {
+		cert, err := secrets.LoadCertificate(*tlsCert, *tlsKey)
+		if err != nil {
+			log.Fatalf("Error loading TLS certificate: %v", err)
+		}
+		refreshers = append(refreshers, cert)
+		tlsConfig := cert.TLSConfig()
+		if *tlsClientCA != "" {
+			tlsConfig.ClientCAs, err = secrets.LoadCertPool(*tlsClientCA)
+			if err != nil {
+				log.Fatalf("Error loading client CA bundle: %v", err)
+			}
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+			serverLog.Infof("Client certificates required, signed by %s", *tlsClientCA)
+		}
+		listener = tls.NewListener(listener, tlsConfig)
+		serverLog.Infof("TLS enabled with certificate %s", *tlsCert)
+	}
+
+	// Every goroutine below stops on the first failure as on a signal
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		secrets.Watch(ctx, *secretRefresh, nil, refreshers...)
+		return nil
+	})
+
+	serverLog.Infof("Server listening on %s %s", *network, *listenAddr)
+
+	g.Go(func() error {
+		srv.messageBroadcaster(ctx)
+		return nil
+	})
+	g.Go(func() error {
+		srv.dumpOnSignal(ctx, *dumpFile)
+		return nil
+	})
+	if *statsInterval > 0 {
+		g.Go(func() error {
+			srv.reportStats(ctx, *statsInterval)
+			return nil
+		})
+	}
+	if *metricsAddr != "" {
+		g.Go(func() error { return srv.serveMetrics(ctx, *metricsAddr) })
+	}
+	if *debugAddr != "" {
+		serverLog.Infof("Profiles served on %s/debug/pprof/, runtime stats on %s/debug/stats", *debugAddr, *debugAddr)
+		g.Go(func() error { return debug.Serve(ctx, *debugAddr) })
+	}
+	g.Go(func() error { return srv.serve(ctx, listener) })
+
+	err = g.Wait()
+	srv.shutdown()
+	if err != nil {
+		serverLog.Errorf("Server stopped on error: %v", err)
+		exitCode = 1
+	}
+}
@@ -0,0 +1,114 @@
+package serve
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"ifin/internal/healthcheck"
+	"ifin/internal/promtext"
+)
+
+// serverMetrics counts connections for /metrics; the hub counts broadcasts.
+type serverMetrics struct {
+	accepted   atomic.Uint64 // Connections accepted
+	rejected   atomic.Uint64 // Connections refused before the handshake
+	authFailed atomic.Uint64
+	bytesIn    atomic.Uint64
+	bytesOut   atomic.Uint64
+}
+
+// serveMetrics serves /metrics on addr in the Prometheus text format until
+// ctx is done, or fails when it cannot.
+func (s *server) serveMetrics(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", s.metricsHandler)
+	mux.HandleFunc("/healthz", livenessHandler)
+	server := &http.Server{Addr: addr, Handler: mux}
+	stop := context.AfterFunc(ctx, func() { server.Close() })
+	defer stop()
+
+	s.serverLog.Infof("Metrics served on %s/metrics, liveness on %s/healthz", addr, addr)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return fmt.Errorf("serving metrics: %w", err)
+	}
+	return nil
+}
+
+// livenessHandler serves /healthz, which only shows the process is serving
+// HTTP.
+func livenessHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"alive"}` + "\n"))
+}
+
+// checkHealth is the probe of "stockfeed healthcheck serve": a GET of
+// /healthz on the metrics server, or without one a connection to the feed
+// port.
+func checkHealth(network, listenAddr, metricsAddr string) error {
+	if metricsAddr != "" {
+		return healthcheck.HTTP(metricsAddr, "/healthz", false)
+	}
+	return healthcheck.Dial(network, listenAddr)
+}
+
+func (s *server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", promtext.ContentType)
+	s.writeMetrics(promtext.NewWriter(w))
+}
+
+// writeMetrics writes every metric to p, for /metrics and OTLP export.
+func (s *server) writeMetrics(p promtext.Sink) {
+	connected := s.hub.Clients()
+	counters := s.hub.Counters()
+
+	p.Family("feed_clients", promtext.Gauge, "Authenticated clients connected.")
+	p.Sample("feed_clients", float64(connected))
+	p.Family("feed_pending_handshakes", promtext.Gauge, "Connections still in their TLS handshake or authentication.")
+	p.Sample("feed_pending_handshakes", float64(len(s.pending)))
+	p.Family("feed_connections_accepted_total", promtext.Counter, "Connections accepted.")
+	p.Sample("feed_connections_accepted_total", float64(s.metrics.accepted.Load()))
+	p.Family("feed_connections_rejected_total", promtext.Counter, "Connections refused because too many handshakes were pending.")
+	p.Sample("feed_connections_rejected_total", float64(s.metrics.rejected.Load()))
+	p.Family("feed_auth_failures_total", promtext.Counter, "Connections that failed the handshake or authentication.")
+	p.Sample("feed_auth_failures_total", float64(s.metrics.authFailed.Load()))
+	p.Family("feed_broadcasts_total", promtext.Counter, "Updates generated and broadcast.")
+	p.Sample("feed_broadcasts_total", float64(counters.Broadcasts))
+	p.Family("feed_updates_sent_total", promtext.Counter, "Updates written to clients.")
+	p.Sample("feed_updates_sent_total", float64(counters.Sent))
+	p.Family("feed_send_errors_total", promtext.Counter, "Clients dropped because a write to them failed or they fell too far behind.")
+	p.Sample("feed_send_errors_total", float64(counters.SendErrors))
+	p.Family("feed_bytes_received_total", promtext.Counter, "Bytes read from clients.")
+	p.Sample("feed_bytes_received_total", float64(s.metrics.bytesIn.Load()))
+	p.Family("feed_bytes_sent_total", promtext.Counter, "Bytes written to clients.")
+	p.Sample("feed_bytes_sent_total", float64(s.metrics.bytesOut.Load()))
+	p.Family("feed_fanout_duration_seconds", promtext.Histogram, "Time from generating an update to queueing it for the last subscribed client.")
+	s.hub.Fanout.Write(p, "feed_fanout_duration_seconds")
+	p.Family("feed_client_write_duration_seconds", promtext.Histogram, "Time from queueing an update for a client to having written it; a slow client only holds up itself.")
+	s.hub.ClientWrite.Write(p, "feed_client_write_duration_seconds")
+}
+
+// reportStats logs a line with the connected clients and what was sent
+// since the previous line, every interval until ctx is done.
+func (s *server) reportStats(ctx context.Context, interval time.Duration) {
+	ticker := s.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	var broadcasts, sent, bytesOut, sendErrors uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+		connected := s.hub.Clients()
+		counters := s.hub.Counters()
+
+		b, n, out, errs := counters.Broadcasts, counters.Sent, s.metrics.bytesOut.Load(), counters.SendErrors
+		s.statsLog.Infof("Stats: %d clients, %d broadcasts, %d updates sent, %d bytes sent, %d clients dropped as slow or on write errors in the last %v",
+			connected, b-broadcasts, n-sent, out-bytesOut, errs-sendErrors, interval)
+		broadcasts, sent, bytesOut, sendErrors = b, n, out, errs
+	}
+}
@@ -0,0 +1,297 @@
+package serve
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"ifin/internal/audit"
+	"ifin/internal/broadcast"
+	"ifin/internal/clock"
+	"ifin/internal/errreport"
+	"ifin/internal/feed"
+	"ifin/internal/hooks"
+	"ifin/internal/logging"
+	"ifin/internal/tracing"
+)
+
+// tracer records the generate span of every tick
+var tracer = tracing.Tracer("feed-server")
+
+const handshakeTimeout = 10 * time.Second // How long a new client has to finish TLS and send its AUTH line
+
+// serverConfig is what newServer needs from the flags.
+type serverConfig struct {
+	JournalSize  int           // Recent updates kept per symbol for replays
+	MaxPending   int           // Connections that may be in their handshake at once
+	AcceptRate   float64       // New connections accepted per second; 0 disables throttling
+	AcceptBurst  int           // Connections accepted at once before AcceptRate applies
+	TickInterval time.Duration // Time between simulated updates when no source is given
+	AuthToken    func() string // Token clients must present; nil or empty disables authentication
+	Hooks        serverHooks   // User code run on updates and clients
+}
+
+// server is the feed server: it accepts clients, authenticates them and
+// registers them with the hub, while the updates of its price source are
+// published to the broker.
+type server struct {
+	cfg       serverConfig
+	log       *logging.Logger // Accepting, authenticating and dropping clients
+	serverLog *logging.Logger // The broadcaster, shutdown and side servers
+	statsLog  *logging.Logger // The periodic stats line
+	clock     clock.Clock     // Stamps updates and audit events, and paces the broadcast
+	audit     audit.Sink      // Where connection audit events are recorded
+	hub       *broadcast.Hub
+	broker    broadcast.Broker // Where the source's updates are published: the hub
+	source    feed.PriceSource
+	metrics   serverMetrics
+	limiter   *acceptLimiter
+	pending   chan struct{} // Semaphore of connections still in their handshake
+}
+
+// newServer returns a server broadcasting the updates of source, logging to
+// logger, keeping time with clk and recording audit events to auditLog. A
+// nil logger is the standard logger, a nil clk the system clock, a nil
+// source the simulator, and a nil auditLog records nothing.
+func newServer(cfg serverConfig, logger *slog.Logger, clk clock.Clock, source feed.PriceSource, auditLog audit.Sink) *server {
+	if clk == nil {
+		clk = clock.Real
+	}
+	if auditLog == nil {
+		auditLog = audit.Discard
+	}
+	if cfg.AuthToken == nil {
+		cfg.AuthToken = func() string { return "" }
+	}
+	if cfg.TickInterval <= 0 {
+		cfg.TickInterval = 2 * time.Second
+	}
+	if source == nil {
+		source = feed.NewSimulator(clk, cfg.TickInterval)
+	}
+	hub := broadcast.NewHub(cfg.JournalSize, clk, logger)
+	hub.BeforeBroadcast = cfg.Hooks.BeforeBroadcast
+	return &server{
+		cfg:       cfg,
+		log:       connLog.To(logger),
+		serverLog: serverLog.To(logger),
+		statsLog:  statsLog.To(logger),
+		clock:     clk,
+		audit:     auditLog,
+		hub:       hub,
+		broker:    hub,
+		source:    source,
+		limiter:   newAcceptLimiter(cfg.AcceptRate, cfg.AcceptBurst, clk),
+		pending:   make(chan struct{}, cfg.MaxPending),
+	}
+}
+
+// serve accepts clients on listener, refusing those arriving while
+// MaxPending others are in their handshake, until ctx is done. It closes
+// listener, and returns once the connections of the clients, which end with
+// ctx, are closed. It fails when listener is closed under it.
+func (s *server) serve(ctx context.Context, listener net.Listener) error {
+	stop := context.AfterFunc(ctx, func() { listener.Close() })
+	defer stop()
+
+	var conns sync.WaitGroup
+	defer conns.Wait()
+
+	var retryDelay time.Duration
+	for {
+		s.limiter.Wait(ctx)
+
+		conn, err := listener.Accept()
+		if ctx.Err() != nil {
+			if err == nil {
+				conn.Close()
+			}
+			return nil
+		}
+		if errors.Is(err, net.ErrClosed) {
+			return fmt.Errorf("accepting connections: %w", err)
+		}
+		if err != nil {
+			s.log.Errorf("Error accepting connection: %v", err)
+			if retryDelay = acceptBackoff(err, retryDelay); retryDelay > 0 {
+				s.log.Warnf("Accept error, retrying in %v", retryDelay)
+			}
+			sleep(ctx, s.clock, retryDelay)
+			continue
+		}
+		retryDelay = 0
+
+		// Refuse outright rather than queue when too many handshakes are in flight
+		select {
+		case s.pending <- struct{}{}:
+			s.metrics.accepted.Add(1)
+			conns.Add(1)
+			go func() {
+				defer conns.Done()
+				s.handleConnection(ctx, conn)
+			}()
+		default:
+			s.metrics.rejected.Add(1)
+			s.log.Warnf("Too many pending handshakes, rejecting %s", conn.RemoteAddr())
+			s.recordAudit(ctx, audit.Event{Time: s.clock.Now(), Kind: audit.Rejected, RemoteAddr: conn.RemoteAddr().String(), Reason: "too many pending handshakes"})
+			conn.Close()
+		}
+	}
+}
+
+// handleConnection authenticates a client and serves its commands until it
+// disconnects or ctx is done.
+func (s *server) handleConnection(ctx context.Context, rawConn net.Conn) {
+	// A crash ends this connection only
+	defer errreport.Recover(map[string]string{"component": "connection", "client": rawConn.RemoteAddr().String()})
+
+	conn := &countingConn{Conn: rawConn, metrics: &s.metrics}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	connectedAt := s.clock.Now()
+	remoteAddr := conn.RemoteAddr().String()
+	s.recordAudit(ctx, audit.Event{Time: connectedAt, Kind: audit.Connect, RemoteAddr: remoteAddr})
+
+	identity := ""
+	defer func() {
+		now := s.clock.Now()
+		// Recorded even when the connection ends because ctx is done
+		s.recordAudit(context.WithoutCancel(ctx), audit.Event{
+			Time:       now,
+			Kind:       audit.Disconnect,
+			RemoteAddr: remoteAddr,
+			Identity:   identity,
+			DurationMs: now.Sub(connectedAt).Milliseconds(),
+			BytesIn:    conn.bytesIn.Load(),
+			BytesOut:   conn.bytesOut.Load(),
+		})
+	}()
+
+	reader := bufio.NewReader(conn)
+	identity, err := s.handshake(ctx, rawConn, conn, reader)
+	<-s.pending // The connection no longer counts against -max-pending
+	if err != nil {
+		s.metrics.authFailed.Add(1)
+		s.log.Warnf("Authentication failed for %s: %v", remoteAddr, err)
+		s.recordAudit(ctx, audit.Event{Time: s.clock.Now(), Kind: audit.AuthFailed, RemoteAddr: remoteAddr, Reason: err.Error()})
+		return
+	}
+	s.recordAudit(ctx, audit.Event{Time: s.clock.Now(), Kind: audit.AuthOK, RemoteAddr: remoteAddr, Identity: identity})
+
+	if err := s.cfg.Hooks.OnClientConnect.Run(ctx, &clientInfo{RemoteAddr: remoteAddr, Identity: identity}); err != nil {
+		if err != hooks.Skip {
+			s.log.Warnf("Client %s refused by a hook: %v", remoteAddr, err)
+		}
+		return
+	}
+
+	// Serve the client's commands, subscribed to everything until it says otherwise
+	s.log.Infof("Client connected: %s", conn.RemoteAddr())
+	if err := s.hub.Serve(conn, reader); err != nil {
+		s.log.Errorf("Error sending message to %s: %v", conn.RemoteAddr(), err)
+	}
+	s.log.Infof("Client disconnected: %s", conn.RemoteAddr())
+}
+
+// handshake completes the TLS handshake (when enabled) and authentication,
+// both bounded by handshakeTimeout.
+func (s *server) handshake(ctx context.Context, rawConn net.Conn, conn net.Conn, reader *bufio.Reader) (string, error) {
+	if tlsConn, ok := rawConn.(*tls.Conn); ok {
+		ctx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+		defer cancel()
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return "", err
+		}
+	}
+	return s.authenticate(conn, reader)
+}
+
+// authenticate checks the "AUTH <token> [client-id]" line a client must send
+// first when a token is configured, and returns the identity to audit. The
+// token is re-read on every call so rotation only affects new connections.
+func (s *server) authenticate(conn net.Conn, reader *bufio.Reader) (string, error) {
+	token := s.cfg.AuthToken()
+	if token == "" {
+		return "anonymous", nil
+	}
+
+	conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	line, err := reader.ReadString('\n')
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		return "", err
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != "AUTH" || subtle.ConstantTimeCompare([]byte(fields[1]), []byte(token)) != 1 {
+		conn.Write([]byte("ERR unauthorized\n"))
+		return "", errors.New("invalid token")
+	}
+
+	identity := "token"
+	if len(fields) > 2 {
+		identity = fields[2]
+	}
+
+	_, err = conn.Write([]byte("OK\n"))
+	return identity, err
+}
+
+// recordAudit stores an event, logging (but otherwise ignoring) sink errors
+// so auditing problems never drop client connections.
+func (s *server) recordAudit(ctx context.Context, e audit.Event) {
+	if err := s.audit.Record(ctx, e); err != nil {
+		s.log.Errorf("Error recording audit event: %v", err)
+	}
+}
+
+// messageBroadcaster publishes the updates of the price source to the
+// broker as they come, until ctx is done or the source runs out.
+func (s *server) messageBroadcaster(ctx context.Context) {
+	defer errreport.Repanic(map[string]string{"component": "broadcaster"})
+	for {
+		next, err := s.source.Next(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err == io.EOF:
+			s.serverLog.Infof("Price source exhausted, no more updates to broadcast")
+			return
+		case err != nil:
+			s.serverLog.Warnf("Error reading the price source: %v", err)
+			continue
+		}
+		if err := s.cfg.Hooks.OnGenerate.Run(ctx, &next); err != nil {
+			if err != hooks.Skip {
+				s.serverLog.Warnf("Tick %s dropped by a hook: %v", next.ID, err)
+			}
+			continue
+		}
+
+		tickCtx, span := tracer.Start(ctx, "generate", trace.WithSpanKind(trace.SpanKindProducer))
+		generated := s.clock.Now()
+		update := s.broker.Publish(tickCtx, next, generated)
+		span.SetAttributes(attribute.String("symbol", update.Symbol), attribute.Int64("seq", int64(update.Seq)), attribute.String("tick.id", update.ID))
+		span.End()
+	}
+}
+
+// shutdown closes every client connection still open.
+func (s *server) shutdown() {
+	s.hub.Close()
+	s.serverLog.Infof("Server shutting down...")
+}
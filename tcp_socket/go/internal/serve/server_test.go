@@ -0,0 +1,165 @@
+package serve
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ifin/internal/audit"
+	"ifin/internal/clock"
+	"ifin/internal/feed"
+)
+
+// chanSource is a price source publishing what is sent on it.
+type chanSource chan feed.Update
+
+func (s chanSource) Next(ctx context.Context) (feed.Update, error) {
+	select {
+	case update := <-s:
+		return update, nil
+	case <-ctx.Done():
+		return feed.Update{}, ctx.Err()
+	}
+}
+
+func (s chanSource) Close() error { return nil }
+
+// memoryAudit is an audit sink keeping the events in memory.
+type memoryAudit struct {
+	mu     sync.Mutex
+	events []audit.Event
+}
+
+func (m *memoryAudit) Record(_ context.Context, e audit.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, e)
+	return nil
+}
+
+func (m *memoryAudit) Close() error { return nil }
+
+// find returns the first event of kind, if recorded.
+func (m *memoryAudit) find(kind string) (audit.Event, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.events {
+		if e.Kind == kind {
+			return e, true
+		}
+	}
+	return audit.Event{}, false
+}
+
+// syncBuffer is a bytes.Buffer a logger can write to from any goroutine.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// poll waits until done returns true, or ctx is done.
+func poll(ctx context.Context, done func() bool) error {
+	for !done() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	return nil
+}
+
+func TestServerRunsOnInjectedClockLoggerAndSinks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.UnixMilli(1_700_000_000_000)
+	clk := clock.NewFake(start)
+	source := make(chanSource)
+	events := &memoryAudit{}
+	var logs syncBuffer
+	s := newServer(serverConfig{JournalSize: 10, MaxPending: 1, AuthToken: func() string { return "secret" }},
+		slog.New(slog.NewTextHandler(&logs, nil)), clk, source, events)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runCtx, stop := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		s.messageBroadcaster(runCtx)
+	}()
+	go func() {
+		defer wg.Done()
+		s.serve(runCtx, listener)
+	}()
+	defer func() {
+		stop()
+		wg.Wait()
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	conn.Write([]byte("AUTH secret tester\n"))
+	if line, err := reader.ReadString('\n'); line != "OK\n" {
+		t.Fatalf("AUTH answered %q (%v), want OK", line, err)
+	}
+	if err := poll(ctx, func() bool { return s.hub.Clients() == 1 }); err != nil {
+		t.Fatalf("waiting for the client to be registered: %v", err)
+	}
+
+	// The source's updates are broadcast to the client
+	source <- feed.Update{ID: "a1", Symbol: "AAPL", Price: 190, Timestamp: clk.Now().UnixMilli()}
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var update feed.Update
+	if err := json.Unmarshal([]byte(line), &update); err != nil || update.ID != "a1" || update.Seq != 1 {
+		t.Fatalf("received %q (%v), want a1 #1", line, err)
+	}
+
+	// Audit events are stamped by the injected clock
+	clk.Advance(1500 * time.Millisecond)
+	conn.Close()
+	if err := poll(ctx, func() bool { _, ok := events.find(audit.Disconnect); return ok }); err != nil {
+		t.Fatalf("waiting for the disconnect to be audited: %v", err)
+	}
+	if connected, _ := events.find(audit.AuthOK); !connected.Time.Equal(start) || connected.Identity != "tester" {
+		t.Errorf("auth_ok %+v, want tester at %v", connected, start)
+	}
+	if disconnected, _ := events.find(audit.Disconnect); disconnected.DurationMs != 1500 || !disconnected.Time.Equal(clk.Now()) {
+		t.Errorf("disconnect %+v, want 1500ms ending at %v", disconnected, clk.Now())
+	}
+
+	// The component loggers write to the injected logger
+	if out := logs.String(); !strings.Contains(out, "Client connected") || !strings.Contains(out, "component=conn") {
+		t.Errorf("logged %q, want the connection from the conn component", out)
+	}
+}
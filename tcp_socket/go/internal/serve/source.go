@@ -0,0 +1,52 @@
+package serve
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"ifin/internal/clock"
+	"ifin/internal/feed"
+	"ifin/internal/marketdata"
+)
+
+// sourceFetchTimeout bounds each request of the http price source
+const sourceFetchTimeout = 10 * time.Second
+
+// sourceConfig is what openSource needs from the flags.
+type sourceConfig struct {
+	Kind        string            // simulator, csv, http or market
+	File        string            // CSV file replayed by csv
+	URL         string            // JSON endpoint polled by http
+	Interval    time.Duration     // Between simulated updates, polls, and replayed rows without a recorded gap
+	ReplaySpeed float64           // How much faster than recorded csv replays; 0 ignores the recorded gaps
+	ReplayLoop  bool              // Whether csv starts over at the end of the file
+	Market      marketdata.Config // The provider relayed by market; its Interval is Interval
+}
+
+// openSource picks where the broadcast prices come from.
+func openSource(cfg sourceConfig, clk clock.Clock) (feed.PriceSource, error) {
+	switch cfg.Kind {
+	case "", "simulator":
+		return feed.NewSimulator(clk, cfg.Interval), nil
+	case "csv":
+		if cfg.File == "" {
+			return nil, fmt.Errorf("-source csv needs -source-file")
+		}
+		return feed.NewReplay(feed.ReplayConfig{Path: cfg.File, Speed: cfg.ReplaySpeed, Interval: cfg.Interval, Loop: cfg.ReplayLoop}, clk)
+	case "http":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("-source http needs -source-url")
+		}
+		fetch := feed.FetchJSON(&http.Client{Timeout: sourceFetchTimeout}, cfg.URL)
+		return feed.NewPoller(fetch, clk, cfg.Interval), nil
+	case "market":
+		if cfg.Market.URL == "" {
+			return nil, fmt.Errorf("-source market needs -market-url")
+		}
+		cfg.Market.Interval = cfg.Interval
+		return marketdata.New(cfg.Market, clk)
+	default:
+		return nil, fmt.Errorf("unknown price source %q (want simulator, csv, http or market)", cfg.Kind)
+	}
+}
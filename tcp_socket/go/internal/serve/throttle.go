@@ -0,0 +1,76 @@
+package serve
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"ifin/internal/clock"
+)
+
+// acceptLimiter is a token bucket that paces listener.Accept. While it waits,
+// new connections queue in the kernel backlog instead of using up our file
+// descriptors. It is only used by the accept loop, so it needs no locking.
+type acceptLimiter struct {
+	rate   float64 // Tokens added per second
+	burst  float64 // Bucket size
+	tokens float64
+	last   time.Time
+	clock  clock.Clock // Refills the bucket and times the waits
+}
+
+// newAcceptLimiter returns nil (no throttling) when rate is not positive.
+func newAcceptLimiter(rate float64, burst int, clk clock.Clock) *acceptLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &acceptLimiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: clk.Now(), clock: clk}
+}
+
+// Wait blocks until the next connection may be accepted, or ctx is done.
+func (l *acceptLimiter) Wait(ctx context.Context) {
+	if l == nil {
+		return
+	}
+
+	now := l.clock.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+
+	if l.tokens < 1 {
+		sleep(ctx, l.clock, time.Duration((1-l.tokens)/l.rate*float64(time.Second)))
+		l.tokens = 0
+		l.last = l.clock.Now()
+		return
+	}
+	l.tokens--
+}
+
+// acceptBackoff returns how long to pause after a failed Accept, doubling
+// from 5ms up to 1s, like net/http does for EMFILE and similar errors.
+func acceptBackoff(err error, previous time.Duration) time.Duration {
+	var netErr net.Error
+	if !errors.As(err, &netErr) {
+		return 0
+	}
+
+	delay := 2 * previous
+	if previous == 0 {
+		delay = 5 * time.Millisecond
+	}
+	return min(delay, time.Second)
+}
+
+// sleep pauses for d of clk, or until ctx is done.
+func sleep(ctx context.Context, clk clock.Clock, d time.Duration) {
+	timer := clk.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C():
+	}
+}
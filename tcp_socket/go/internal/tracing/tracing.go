@@ -0,0 +1,66 @@
+// Package tracing exports OpenTelemetry spans over OTLP and carries their
+// context from process to process in the "traceparent" field of feed
+// messages (W3C Trace Context), so a single tick can be followed from the
+// server that generated it to the browsers it was streamed to.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Setup exports the spans of service to the OTLP/gRPC collector at endpoint
+// (host:port, plaintext), sampling ratio of the traces started here; traces
+// continued from another process follow its decision. With no endpoint
+// spans are not recorded at all. The returned function flushes the spans
+// still queued and must be called before exiting.
+func Setup(ctx context.Context, endpoint, service string, ratio float64) (shutdown func(context.Context) error, err error) {
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpoint(endpoint), otlptracegrpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(service))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer of a component, such as "feed-server".
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// TraceParent returns the traceparent of the span in ctx, or "" when there
+// is none or it is not sampled, so unsampled messages carry nothing extra.
+func TraceParent(ctx context.Context) string {
+	if !trace.SpanContextFromContext(ctx).IsSampled() {
+		return ""
+	}
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// WithTraceParent returns ctx continuing the trace of traceparent, as
+// received in a message; ctx is returned unchanged when it is empty or
+// invalid.
+func WithTraceParent(ctx context.Context, traceparent string) context.Context {
+	if traceparent == "" {
+		return ctx
+	}
+	return propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{"traceparent": traceparent})
+}
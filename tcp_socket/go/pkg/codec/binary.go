@@ -0,0 +1,97 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// protobufCodec encodes protobuf messages as themselves. Other values, such
+// as updates, have no schema of their own and are encoded as a
+// google.protobuf.Value holding their JSON form.
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string        { return "protobuf" }
+func (protobufCodec) ContentType() string { return "application/x-protobuf" }
+func (protobufCodec) Binary() bool        { return true }
+
+func (protobufCodec) Marshal(v any) ([]byte, error) {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Marshal(m)
+	}
+	generic, err := toGeneric(v)
+	if err != nil {
+		return nil, err
+	}
+	value, err := structpb.NewValue(generic)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(value)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v any) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+	var value structpb.Value
+	if err := proto.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	return fromGeneric(value.AsInterface(), v)
+}
+
+// toGeneric returns the maps, slices and scalars of v's JSON form.
+func toGeneric(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic any
+	err = json.Unmarshal(data, &generic)
+	return generic, err
+}
+
+// fromGeneric stores the JSON form generic in v.
+func fromGeneric(generic any, v any) error {
+	data, err := json.Marshal(generic)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string        { return "msgpack" }
+func (msgpackCodec) ContentType() string { return "application/msgpack" }
+func (msgpackCodec) Binary() bool        { return true }
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+// cborCodec relies on the cbor package falling back to json struct tags.
+type cborCodec struct{}
+
+func (cborCodec) Name() string                       { return "cbor" }
+func (cborCodec) ContentType() string                { return "application/cbor" }
+func (cborCodec) Binary() bool                       { return true }
+func (cborCodec) Marshal(v any) ([]byte, error)      { return cbor.Marshal(v) }
+func (cborCodec) Unmarshal(data []byte, v any) error { return cbor.Unmarshal(data, v) }
@@ -0,0 +1,172 @@
+// Package codec is the registry of the formats updates are encoded in: on
+// the feed connection, in Redis and in HTTP responses. Each format is
+// identified by its content type, which the feed handshake, stored values
+// and Accept headers name, so a format is added here once and becomes
+// available everywhere.
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Codec encodes values in one format. Values are encoded under their JSON
+// field names in every format.
+type Codec interface {
+	Name() string        // Short name, as given in flags: json
+	ContentType() string // Media type identifying the format: application/json
+	Binary() bool        // Whether encoded values may contain newlines, so the feed frames them
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// The formats registered by default
+var (
+	JSON     Codec = jsonCodec{}
+	NDJSON   Codec = ndjsonCodec{}
+	Protobuf Codec = protobufCodec{}
+	Msgpack  Codec = msgpackCodec{}
+	CBOR     Codec = cborCodec{}
+)
+
+var (
+	mu       sync.RWMutex
+	registry []Codec // In order of registration, JSON first
+)
+
+func init() {
+	for _, c := range []Codec{JSON, NDJSON, Protobuf, Msgpack, CBOR} {
+		Register(c)
+	}
+}
+
+// Register makes c available under its name and content type, replacing a
+// codec registered before under either.
+func Register(c Codec) {
+	mu.Lock()
+	defer mu.Unlock()
+	registry = slices.DeleteFunc(registry, func(r Codec) bool {
+		return r.Name() == c.Name() || r.ContentType() == c.ContentType()
+	})
+	registry = append(registry, c)
+}
+
+// Lookup returns the codec named id, by name or content type. An empty id
+// is JSON.
+func Lookup(id string) (Codec, error) {
+	if id == "" {
+		return JSON, nil
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, c := range registry {
+		if strings.EqualFold(c.Name(), id) || strings.EqualFold(c.ContentType(), id) {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown format %q (want one of %s)", id, strings.Join(namesLocked(), ", "))
+}
+
+// All returns the registered codecs, JSON first.
+func All() []Codec {
+	mu.RLock()
+	defer mu.RUnlock()
+	return slices.Clone(registry)
+}
+
+// Names returns the names of the registered codecs.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return namesLocked()
+}
+
+func namesLocked() []string {
+	names := make([]string, len(registry))
+	for i, c := range registry {
+		names[i] = c.Name()
+	}
+	return names
+}
+
+// Negotiate returns the registered codec an HTTP Accept header prefers, by
+// quality then order, or JSON when it accepts anything or none of them.
+func Negotiate(accept string) Codec {
+	best, bestQ := JSON, 0.0
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mediaType == "*/*" {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		for _, c := range registry {
+			if c.ContentType() == mediaType && q > bestQ {
+				best, bestQ = c, q
+			}
+		}
+	}
+	return best
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                       { return "json" }
+func (jsonCodec) ContentType() string                { return "application/json" }
+func (jsonCodec) Binary() bool                       { return false }
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// ndjsonCodec writes a slice as one JSON value per line, which readers can
+// process as it streams in, and anything else as JSON.
+type ndjsonCodec struct{}
+
+func (ndjsonCodec) Name() string        { return "ndjson" }
+func (ndjsonCodec) ContentType() string { return "application/x-ndjson" }
+func (ndjsonCodec) Binary() bool        { return false }
+
+func (ndjsonCodec) Marshal(v any) ([]byte, error) {
+	list := reflect.ValueOf(v)
+	if list.Kind() != reflect.Slice || list.Type().Elem().Kind() == reflect.Uint8 {
+		return json.Marshal(v)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf) // Ends every value with a newline
+	for i := range list.Len() {
+		if err := enc.Encode(list.Index(i).Interface()); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (ndjsonCodec) Unmarshal(data []byte, v any) error {
+	target := reflect.ValueOf(v)
+	if target.Kind() != reflect.Pointer || target.Elem().Kind() != reflect.Slice || target.Elem().Type().Elem().Kind() == reflect.Uint8 {
+		return json.Unmarshal(data, v)
+	}
+	list := target.Elem()
+	list.SetLen(0)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for dec.More() {
+		item := reflect.New(list.Type().Elem())
+		if err := dec.Decode(item.Interface()); err != nil {
+			return err
+		}
+		list.Set(reflect.Append(list, item.Elem()))
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// On the feed connection, values in a binary format are sent as a frame:
+// a framePrefix line giving the length, then the data. Text formats send
+// each value on a line of its own, like the control lines.
+const framePrefix = "BIN "
+
+// AppendFrame appends data, encoded by c, to buf as one message of the
+// feed.
+func AppendFrame(buf []byte, c Codec, data []byte) []byte {
+	if !c.Binary() {
+		buf = append(buf, bytes.TrimRight(data, "\n")...)
+		return append(buf, '\n')
+	}
+	buf = append(buf, framePrefix...)
+	buf = strconv.AppendInt(buf, int64(len(data)), 10)
+	buf = append(buf, '\n')
+	return append(buf, data...)
+}
+
+// FrameLength returns the length of the data following line, when it is the
+// header of a binary frame. It fails for a header with no valid length.
+func FrameLength(line string) (int, bool, error) {
+	length, ok := strings.CutPrefix(strings.TrimSpace(line), framePrefix)
+	if !ok {
+		return 0, false, nil
+	}
+	n, err := strconv.Atoi(length)
+	if err != nil || n < 0 {
+		return 0, true, fmt.Errorf("invalid frame length %q", length)
+	}
+	return n, true, nil
+}
@@ -0,0 +1,39 @@
+package codec
+
+import "errors"
+
+// A stored value in a format other than JSON is marker, the length of the
+// content type in a byte, the content type, then the data, so readers need
+// no configuration and plain JSON values still read back. Plain JSON never
+// starts with marker, nor does a compressed value (see package compression).
+const marker = 0x01
+
+// Encode marshals v with c for storage, naming c in the value unless it is
+// JSON.
+func Encode(c Codec, v any) ([]byte, error) {
+	data, err := c.Marshal(v)
+	if err != nil || c == JSON {
+		return data, err
+	}
+	contentType := c.ContentType()
+	value := make([]byte, 0, 2+len(contentType)+len(data))
+	value = append(value, marker, byte(len(contentType)))
+	value = append(value, contentType...)
+	return append(value, data...), nil
+}
+
+// Decode unmarshals a value written by Encode, in whichever format it names.
+func Decode(value []byte, v any) error {
+	if len(value) < 2 || value[0] != marker {
+		return JSON.Unmarshal(value, v)
+	}
+	n := int(value[1])
+	if len(value) < 2+n {
+		return errors.New("truncated content type")
+	}
+	c, err := Lookup(string(value[2 : 2+n]))
+	if err != nil {
+		return err
+	}
+	return c.Unmarshal(value[2+n:], v)
+}
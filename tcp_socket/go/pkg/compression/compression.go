@@ -0,0 +1,78 @@
+// Package compression compresses the update JSON stored in Redis. A
+// compressed value starts with a marker naming its algorithm, so readers
+// need no configuration and values written before compression was enabled
+// (plain JSON) still read back.
+package compression
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Algorithms
+const (
+	None   = "none"
+	Snappy = "snappy" // Fast, modest savings
+	Zstd   = "zstd"   // Slower, better savings
+)
+
+// A compressed value is marker, then the algorithm's byte, then the data.
+// Plain JSON never starts with marker.
+const marker = 0x00
+
+const (
+	snappyID = 's'
+	zstdID   = 'z'
+)
+
+// zstd encoders and decoders are expensive to create but safe to share
+var (
+	zstdEncoder = sync.OnceValue(func() *zstd.Encoder {
+		encoder, _ := zstd.NewWriter(nil) // Only fails on invalid options
+		return encoder
+	})
+	zstdDecoder = sync.OnceValue(func() *zstd.Decoder {
+		decoder, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+		return decoder
+	})
+)
+
+// Valid reports whether algorithm is one Compress accepts.
+func Valid(algorithm string) bool {
+	return algorithm == None || algorithm == Snappy || algorithm == Zstd
+}
+
+// Compress returns data compressed with algorithm, or data itself for None.
+func Compress(algorithm string, data []byte) []byte {
+	switch algorithm {
+	case Snappy:
+		// snappy.Encode only reuses dst as scratch space, so the header is prepended
+		return append([]byte{marker, snappyID}, snappy.Encode(nil, data)...)
+	case Zstd:
+		return zstdEncoder().EncodeAll(data, []byte{marker, zstdID})
+	}
+	return data
+}
+
+// Decompress returns the original of a value written by Compress.
+func Decompress(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != marker {
+		return data, nil
+	}
+	switch data[1] {
+	case snappyID:
+		return snappy.Decode(nil, data[2:])
+	case zstdID:
+		return zstdDecoder().DecodeAll(data[2:], nil)
+	}
+	return nil, fmt.Errorf("unknown compression %q", data[1])
+}
+
+// DecompressString is Decompress for values read as strings.
+func DecompressString(value string) (string, error) {
+	data, err := Decompress([]byte(value))
+	return string(data), err
+}
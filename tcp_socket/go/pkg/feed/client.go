@@ -0,0 +1,136 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"ifin/internal/httpapi"
+	"ifin/pkg/feedclient"
+	"ifin/pkg/store"
+)
+
+// defaultRetention is the history kept when no store is given.
+const defaultRetention = time.Hour
+
+// Client is an embedded feed client, storing every update it receives, as
+// run by stockfeed consume without its caches, archives and gRPC service.
+type Client struct {
+	settings settings
+	store    store.Store
+	feed     *feedclient.Group
+	run      background
+}
+
+// NewClient returns a Client configured by opts; WithAddress,
+// WithAuthToken, WithTLS, WithLogger, WithSymbols, WithConnections,
+// WithStore and WithHTTP apply.
+func NewClient(opts ...Option) *Client {
+	s := newSettings("localhost:9501", opts)
+	st := s.store
+	if st == nil {
+		st = store.NewMemory(defaultRetention)
+	}
+	return &Client{settings: s, store: st}
+}
+
+// Start connects to the server and stores its updates in the background,
+// reconnecting whenever the connection drops, until ctx is done or Stop is
+// called. With WithHTTP it also serves the prices, and fails when the HTTP
+// address cannot be listened on.
+func (c *Client) Start(ctx context.Context) error {
+	if c.feed != nil {
+		return errors.New("feed: client already started")
+	}
+	opts := feedclient.Options{
+		Servers: []string{c.settings.addr},
+		Network: c.settings.network,
+		TLS:     c.settings.tls,
+		Symbols: c.settings.symbols,
+		Logger:  c.settings.logger,
+	}
+	if token := c.settings.token; token != "" {
+		opts.Token = func() string { return token }
+	}
+	group, err := feedclient.NewGroup(opts, c.settings.connections)
+	if err != nil {
+		return err
+	}
+
+	var listener net.Listener
+	if c.settings.httpAddr != "" {
+		if listener, err = net.Listen("tcp", c.settings.httpAddr); err != nil {
+			return err
+		}
+	}
+
+	c.feed = group
+	c.run.start(ctx, func(ctx context.Context) error {
+		g, ctx := errgroup.WithContext(ctx)
+		g.Go(func() error {
+			group.Run(ctx, feedclient.Chain(c.store.Put))
+			return nil
+		})
+		if listener != nil {
+			g.Go(func() error { return c.serveHTTP(ctx, listener) })
+		}
+		return g.Wait()
+	})
+	return nil
+}
+
+// serveHTTP serves the prices on listener until ctx is done, configured as
+// stockfeed consume is by default except that no other origin is allowed.
+func (c *Client) serveHTTP(ctx context.Context, listener net.Listener) error {
+	proxies, err := httpapi.NewProxyPolicy("", "")
+	if err != nil {
+		return err
+	}
+	cfg := httpapi.Config{
+		StaleAfter:      30 * time.Second,
+		SSEPingInterval: 15 * time.Second,
+		CORS:            httpapi.NewCORSPolicy("", "GET, POST, OPTIONS", "Content-Type,Last-Event-ID"),
+		Proxies:         proxies,
+		Logger:          c.settings.logger,
+		Metrics:         httpapi.NewMetrics(),
+	}
+	server := &http.Server{
+		Handler:     httpapi.NewRouter(cfg, httpapi.Endpoints(cfg, c.store)),
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	stop := context.AfterFunc(ctx, func() { server.Close() })
+	defer stop()
+	if err := server.Serve(listener); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Stop disconnects from the server, stops serving HTTP and waits for both,
+// returning why they stopped early, if they did.
+func (c *Client) Stop() error {
+	return c.run.stop()
+}
+
+// Store returns the store the updates are put in.
+func (c *Client) Store() store.Store {
+	return c.store
+}
+
+// Connected reports whether the client is connected to the server, over at
+// least one of its connections.
+func (c *Client) Connected() bool {
+	return c.feed != nil && c.feed.Connected() > 0
+}
+
+// Stats returns the counters of the connections, summed.
+func (c *Client) Stats() feedclient.Stats {
+	if c.feed == nil {
+		return feedclient.Stats{}
+	}
+	return c.feed.Stats()
+}
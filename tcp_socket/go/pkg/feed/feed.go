@@ -0,0 +1,140 @@
+// Package feed embeds the stock feed in other programs: a Server
+// broadcasting prices and a Client consuming them into a store, each
+// started and stopped as part of the program instead of exec-ing
+// stockfeed serve and stockfeed consume.
+//
+//	srv := feed.NewServer(feed.WithAddress("tcp", "127.0.0.1:0"))
+//	if err := srv.Start(ctx); err != nil { ... }
+//	defer srv.Stop()
+//
+//	c := feed.NewClient(feed.WithAddress("tcp", srv.Addr().String()))
+//	if err := c.Start(ctx); err != nil { ... }
+//	defer c.Stop()
+//	prices, err := c.Store().GetAll(ctx)
+package feed
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+
+	pricefeed "ifin/internal/feed"
+	"ifin/pkg/store"
+)
+
+// Option configures a Server or a Client. Options that only concern one of
+// them are ignored by the other.
+type Option func(*settings)
+
+// settings are what the options set, for both the Server and the Client.
+type settings struct {
+	network     string
+	addr        string
+	token       string
+	tls         *tls.Config
+	logger      *slog.Logger
+	source      pricefeed.PriceSource
+	journalSize int
+	symbols     []string
+	connections int
+	store       store.Store
+	httpAddr    string
+}
+
+func newSettings(addr string, opts []Option) settings {
+	s := settings{network: "tcp", addr: addr}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
+}
+
+// WithAddress sets where the Server listens, or the server the Client
+// connects to: a host:port for "tcp", a socket path for "unix". The
+// Server listens on :9501 and the Client connects to localhost:9501, over
+// TCP, by default.
+func WithAddress(network, addr string) Option {
+	return func(s *settings) { s.network, s.addr = network, addr }
+}
+
+// WithAuthToken sets the token the Server requires of clients, or the one
+// the Client presents. No token disables authentication.
+func WithAuthToken(token string) Option {
+	return func(s *settings) { s.token = token }
+}
+
+// WithTLS serves, or dials, the feed over TLS with cfg.
+func WithTLS(cfg *tls.Config) Option {
+	return func(s *settings) { s.tls = cfg }
+}
+
+// WithLogger sends the log lines of the Server or Client to logger instead
+// of the standard logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *settings) { s.logger = logger }
+}
+
+// WithSource makes the Server broadcast the updates of source instead of
+// simulated prices.
+func WithSource(source pricefeed.PriceSource) Option {
+	return func(s *settings) { s.source = source }
+}
+
+// WithJournalSize sets how many recent updates per symbol the Server keeps
+// to replay to clients that missed them (1000).
+func WithJournalSize(n int) Option {
+	return func(s *settings) { s.journalSize = n }
+}
+
+// WithSymbols subscribes the Client to symbols only, instead of every
+// symbol.
+func WithSymbols(symbols ...string) Option {
+	return func(s *settings) { s.symbols = symbols }
+}
+
+// WithConnections makes the Client read the feed over n connections, with
+// the symbols given to WithSymbols sharded between them.
+func WithConnections(n int) Option {
+	return func(s *settings) { s.connections = n }
+}
+
+// WithStore makes the Client store the prices in st instead of in memory,
+// with an hour of history.
+func WithStore(st store.Store) Option {
+	return func(s *settings) { s.store = st }
+}
+
+// WithHTTP makes the Client serve the prices it stores on addr, with the
+// endpoints of stockfeed consume: the streams, the REST API and GraphQL.
+func WithHTTP(addr string) Option {
+	return func(s *settings) { s.httpAddr = addr }
+}
+
+// background runs a Server or Client until its context is done or Stop is
+// called.
+type background struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// start runs run in a goroutine with a context derived from ctx.
+func (b *background) start(ctx context.Context, run func(ctx context.Context) error) {
+	ctx, b.cancel = context.WithCancel(ctx)
+	b.done = make(chan struct{})
+	go func() {
+		defer close(b.done)
+		b.err = run(ctx)
+	}()
+}
+
+// stop cancels the run and waits for it to return, returning its error. It
+// does nothing before start.
+func (b *background) stop() error {
+	if b.done == nil {
+		return nil
+	}
+	b.cancel()
+	<-b.done
+	return b.err
+}
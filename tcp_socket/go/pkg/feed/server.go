@@ -0,0 +1,76 @@
+package feed
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+
+	"ifin/internal/serve"
+)
+
+// Server is an embedded feed server, as run by stockfeed serve without its
+// metrics, debug and admin endpoints.
+type Server struct {
+	settings settings
+	listener net.Listener
+	srv      *serve.Server
+	run      background
+}
+
+// NewServer returns a Server configured by opts; WithAddress, WithAuthToken,
+// WithTLS, WithLogger, WithSource and WithJournalSize apply.
+func NewServer(opts ...Option) *Server {
+	return &Server{settings: newSettings(":9501", opts)}
+}
+
+// Start listens and serves the feed in the background until ctx is done or
+// Stop is called. It fails when the address cannot be listened on.
+func (s *Server) Start(ctx context.Context) error {
+	if s.srv != nil {
+		return errors.New("feed: server already started")
+	}
+	listener, err := net.Listen(s.settings.network, s.settings.addr)
+	if err != nil {
+		return err
+	}
+	if s.settings.tls != nil {
+		listener = tls.NewListener(listener, s.settings.tls)
+	}
+
+	opts := serve.Options{
+		JournalSize: s.settings.journalSize,
+		Source:      s.settings.source,
+		Logger:      s.settings.logger,
+	}
+	if token := s.settings.token; token != "" {
+		opts.AuthToken = func() string { return token }
+	}
+	s.listener = listener
+	s.srv = serve.New(opts)
+	s.run.start(ctx, func(ctx context.Context) error { return s.srv.Run(ctx, listener) })
+	return nil
+}
+
+// Stop closes the listener and every client connection and waits for the
+// server to stop, returning why it stopped early, if it did.
+func (s *Server) Stop() error {
+	return s.run.stop()
+}
+
+// Addr returns the address the server listens on, once started; useful
+// after WithAddress with port 0.
+func (s *Server) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Clients returns the number of clients connected, once started.
+func (s *Server) Clients() int {
+	if s.srv == nil {
+		return 0
+	}
+	return s.srv.Clients()
+}
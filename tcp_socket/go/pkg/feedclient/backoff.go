@@ -0,0 +1,37 @@
+package feedclient
+
+import (
+	"math/rand"
+	"time"
+)
+
+// backoff produces exponentially growing reconnect delays with jitter, so
+// clients that lost the server at the same moment don't retry in lockstep.
+type backoff struct {
+	base    time.Duration // Delay before the first retry
+	max     time.Duration // Cap on the delay
+	attempt int
+}
+
+func newBackoff(base, max time.Duration) *backoff {
+	return &backoff{base: base, max: max}
+}
+
+// Next returns the delay for the next attempt: half of base*2^attempt (capped
+// at max) plus a random amount up to the other half.
+func (b *backoff) Next() time.Duration {
+	delay := b.base
+	for i := 0; i < b.attempt && delay < b.max; i++ {
+		delay *= 2
+	}
+	delay = min(delay, b.max)
+	b.attempt++
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// Reset starts the sequence over, e.g. after a connection proved stable.
+func (b *backoff) Reset() {
+	b.attempt = 0
+}
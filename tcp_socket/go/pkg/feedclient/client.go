@@ -0,0 +1,494 @@
+// Package feedclient consumes the stock feed served by "stockfeed serve".
+// It dials the configured servers (failing over between them),
+// authenticates, keeps the connection alive with pings, reconnects with
+// backoff and hands every decoded update to a callback.
+package feedclient
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"ifin/pkg/codec"
+)
+
+// Update is one price update as sent by the server.
+type Update struct {
+	Symbol    string  `json:"symbol"`
+	Price     float64 `json:"price"`
+	Timestamp int64   `json:"ts,omitempty"`  // Server generation time, Unix milliseconds
+	Seq       uint64  `json:"seq,omitempty"` // Per-symbol sequence number
+	ID        string  `json:"id,omitempty"`  // Correlation ID the server gave the tick, for logs
+
+	TraceParent string `json:"traceparent,omitempty"` // W3C trace context, when the server traced the update
+}
+
+// Options configures a Client. Zero durations fall back to the defaults
+// noted on each field.
+type Options struct {
+	Servers          []string      // Feed server addresses, primary first
+	Failover         string        // FailoverPriority (default) or FailoverRoundRobin
+	FailbackInterval time.Duration // How often the primary is probed while on a backup (30s)
+	ReconnectDelay   time.Duration // First reconnect delay, doubled on each failure (5s)
+	ReconnectMax     time.Duration // Cap on the reconnect delay (1m)
+	ReconnectStable  time.Duration // Uptime after which the reconnect delay resets (30s)
+	PingInterval     time.Duration // How often to ping the server; 0 disables pings
+	PingTimeout      time.Duration // How long to wait for a PONG (5s)
+	MaxSilence       time.Duration // Reconnect when nothing arrives for this long; 0 waits forever
+
+	Network string        // "tcp" (default) or "unix", in which case Servers are socket paths
+	Dialer  ContextDialer // Opens connections, e.g. through a proxy (a net.Dialer)
+	TLS     *tls.Config   // Dial with TLS when set; ServerName defaults to the server's host
+
+	Token    func() string // Returns the auth token; nil or "" skips authentication
+	ClientID string        // Identity sent with AUTH (the hostname)
+	Symbols  []string      // Symbols to subscribe to on every connection; empty means all
+
+	GapRecovery bool   // Ask the server to replay updates skipped in the sequence
+	Format      string // Codec updates are sent in, by name or content type (see package codec); JSON when empty
+
+	OnDecodeError func(raw []byte, err error)      // Called for lines that are not valid updates
+	OnEvent       func(Event)                      // Called on every connection change
+	Logf          func(format string, args ...any) // Connection lifecycle and errors
+	Debugf        func(format string, args ...any) // Per-message detail
+	Logger        *slog.Logger                     // Receives the lines at Info and Debug instead when Logf and Debugf are nil; nothing is logged when all are
+}
+
+// Kinds of Event
+const (
+	EventConnected     = "connected"      // Authenticated and subscribed
+	EventConnectFailed = "connect_failed" // Dialing, authentication or subscription failed
+	EventDisconnected  = "disconnected"   // An established connection ended
+	EventReconnecting  = "reconnecting"   // Waiting Delay before the next attempt
+)
+
+// Event is a change in a client's connection, for keeping a record of them.
+type Event struct {
+	Kind   string
+	Server string        // Address concerned; empty for EventReconnecting
+	Err    error         // Why the connection failed or ended
+	Delay  time.Duration // EventReconnecting only
+}
+
+// ContextDialer opens connections. net.Dialer implements it, as do the
+// proxy dialers of golang.org/x/net/proxy.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Stats are the client's counters since it was created.
+type Stats struct {
+	Connects      uint64 // Successful connections
+	Messages      uint64 // Updates decoded
+	Bytes         uint64 // Bytes received, including control lines
+	DecodeErrors  uint64 // Lines that could not be decoded
+	HandlerErrors uint64 // Updates the handler returned an error for
+}
+
+// Reasons a connection is torn down from our side
+var (
+	errFailingBack = errors.New("failing back to the primary server")
+	errPingTimeout = errors.New("no PONG from server")
+)
+
+// Client consumes the feed. Create it with New and start it with Run.
+type Client struct {
+	opts  Options
+	pool  *serverPool
+	retry *backoff
+	seqs  *sequencer  // Nil unless GapRecovery is set
+	codec codec.Codec // Format asked for
+
+	connects      atomic.Uint64
+	messages      atomic.Uint64
+	bytes         atomic.Uint64
+	decodeErrors  atomic.Uint64
+	handlerErrors atomic.Uint64
+	connected     atomic.Bool
+}
+
+// New validates opts and fills in defaults.
+func New(opts Options) (*Client, error) {
+	if opts.Failover == "" {
+		opts.Failover = FailoverPriority
+	}
+	if opts.Network == "" {
+		opts.Network = "tcp"
+	}
+	if opts.Dialer == nil {
+		opts.Dialer = &net.Dialer{}
+	}
+	if opts.ReconnectDelay < 0 || opts.ReconnectMax < 0 {
+		return nil, errors.New("reconnect delays must not be negative")
+	}
+	if opts.FailbackInterval < 0 {
+		return nil, errors.New("failback interval must not be negative")
+	}
+	setDefault(&opts.FailbackInterval, 30*time.Second)
+	setDefault(&opts.ReconnectDelay, 5*time.Second)
+	setDefault(&opts.ReconnectMax, time.Minute)
+	setDefault(&opts.ReconnectStable, 30*time.Second)
+	setDefault(&opts.PingTimeout, 5*time.Second)
+	if opts.ClientID == "" {
+		opts.ClientID, _ = os.Hostname()
+	}
+	if opts.Logf == nil {
+		opts.Logf = slogf(opts.Logger, slog.LevelInfo)
+	}
+	if opts.Debugf == nil {
+		opts.Debugf = slogf(opts.Logger, slog.LevelDebug)
+	}
+	if opts.OnEvent == nil {
+		opts.OnEvent = func(Event) {}
+	}
+
+	format, err := codec.Lookup(opts.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{opts: opts, retry: newBackoff(opts.ReconnectDelay, opts.ReconnectMax), codec: format}
+	pool, err := newServerPool(opts.Servers, opts.Failover, opts.Logf)
+	if err != nil {
+		return nil, err
+	}
+	c.pool = pool
+	if opts.GapRecovery {
+		c.seqs = newSequencer(opts.Logf)
+	}
+	return c, nil
+}
+
+// slogf returns a printf-style function logging to logger at level, or one
+// discarding the lines when logger is nil.
+func slogf(logger *slog.Logger, level slog.Level) func(format string, args ...any) {
+	if logger == nil {
+		return func(string, ...any) {}
+	}
+	return func(format string, args ...any) {
+		logger.Log(context.Background(), level, fmt.Sprintf(format, args...))
+	}
+}
+
+func setDefault(d *time.Duration, value time.Duration) {
+	if *d == 0 {
+		*d = value
+	}
+}
+
+// Stats returns a snapshot of the counters.
+func (c *Client) Stats() Stats {
+	return Stats{
+		Connects:      c.connects.Load(),
+		Messages:      c.messages.Load(),
+		Bytes:         c.bytes.Load(),
+		DecodeErrors:  c.decodeErrors.Load(),
+		HandlerErrors: c.handlerErrors.Load(),
+	}
+}
+
+// Connected reports whether the client is connected to a server.
+func (c *Client) Connected() bool {
+	return c.connected.Load()
+}
+
+// Updates runs the client in the background and delivers updates on a
+// channel with room for size entries. When the consumer falls behind the
+// read loop blocks, applying backpressure to the connection. The channel is
+// closed after ctx is cancelled.
+func (c *Client) Updates(ctx context.Context, size int) <-chan Update {
+	updates := make(chan Update, size)
+	go func() {
+		defer close(updates)
+		c.Run(ctx, func(ctx context.Context, update Update) error {
+			select {
+			case updates <- update:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+	return updates
+}
+
+// Run connects and consumes the feed until ctx is cancelled, passing every
+// update to handle (see Chain for composing handlers). Handler errors are
+// logged and counted; they do not stop the feed. Servers are tried in turn;
+// once all of them have failed, attempts back off exponentially, and the
+// backoff resets once a connection has stayed up for ReconnectStable.
+func (c *Client) Run(ctx context.Context, handle Handler) {
+	for ctx.Err() == nil {
+		// Connect to the TCP server
+		address := c.pool.Next()
+		conn, err := c.dial(ctx, address)
+		if err != nil {
+			c.opts.Logf("Error connecting to server: %v", err)
+			c.opts.OnEvent(Event{Kind: EventConnectFailed, Server: address, Err: err})
+			if c.pool.Failed() {
+				c.waitToReconnect(ctx)
+			}
+			continue
+		}
+		connectedAt := time.Now()
+
+		// Cancelling connCtx (on shutdown, failback or ping timeout) closes the
+		// connection, which unblocks the read loop
+		connCtx, cancelConn := context.WithCancelCause(ctx)
+		context.AfterFunc(connCtx, func() { conn.Close() })
+
+		reader := bufio.NewReader(conn)
+		if err := c.authenticate(conn, reader); err != nil {
+			c.opts.Logf("Error authenticating with server: %v", err)
+			c.opts.OnEvent(Event{Kind: EventConnectFailed, Server: address, Err: err})
+			cancelConn(err)
+			if c.pool.Failed() {
+				c.waitToReconnect(ctx)
+			}
+			continue
+		}
+		if err := c.subscribe(conn); err != nil {
+			c.opts.Logf("Error subscribing: %v", err)
+			c.opts.OnEvent(Event{Kind: EventConnectFailed, Server: address, Err: err})
+			cancelConn(err)
+			if c.pool.Failed() {
+				c.waitToReconnect(ctx)
+			}
+			continue
+		}
+		c.pool.Connected()
+		c.connects.Add(1)
+		c.connected.Store(true)
+		c.opts.Logf("Connected to server %s", address)
+		c.opts.OnEvent(Event{Kind: EventConnected, Server: address})
+
+		if c.pool.OnBackup() {
+			go c.probePrimary(connCtx, c.pool.Primary(), func() { cancelConn(errFailingBack) })
+		}
+
+		reason := c.consume(ctx, connCtx, cancelConn, conn, reader, handle)
+		c.connected.Store(false)
+		c.pool.Dropped()
+		if ctx.Err() == nil {
+			c.opts.OnEvent(Event{Kind: EventDisconnected, Server: address, Err: reason})
+		}
+
+		if time.Since(connectedAt) >= c.opts.ReconnectStable {
+			c.retry.Reset()
+		}
+		if reason != errFailingBack {
+			c.waitToReconnect(ctx)
+		}
+	}
+}
+
+// consume reads the server's messages, one per line, until the connection
+// ends, and returns why it ended: errFailingBack when we are failing back,
+// nil on shutdown.
+func (c *Client) consume(ctx, connCtx context.Context, cancelConn context.CancelCauseFunc, conn net.Conn, reader *bufio.Reader, handle Handler) error {
+	defer cancelConn(nil) // Close the connection explicitly on the way out
+
+	if c.seqs != nil {
+		c.seqs.reset()
+	}
+
+	pongs := make(chan uint64, 1)
+	if c.opts.PingInterval > 0 {
+		go c.runPinger(connCtx, conn, pongs, func() { cancelConn(errPingTimeout) })
+	}
+
+	for {
+		// A server that stops sending while keeping the socket open would
+		// otherwise block this read forever
+		if c.opts.MaxSilence > 0 {
+			conn.SetReadDeadline(time.Now().Add(c.opts.MaxSilence))
+		}
+
+		line, err := reader.ReadString('\n')
+		c.bytes.Add(uint64(len(line)))
+		if err != nil {
+			var netErr net.Error
+			switch {
+			case ctx.Err() != nil: // Shutting down
+				return nil
+			case context.Cause(connCtx) == errFailingBack:
+				return errFailingBack
+			case errors.As(err, &netErr) && netErr.Timeout():
+				c.opts.Logf("Stream stalled, nothing received for %v, reconnecting...", c.opts.MaxSilence)
+				return fmt.Errorf("nothing received for %v", c.opts.MaxSilence)
+			default:
+				c.opts.Logf("Connection lost, reconnecting...")
+				if cause := context.Cause(connCtx); cause != nil {
+					return cause // The pinger closed the connection
+				}
+				return err
+			}
+		}
+
+		// Process the received message
+		message := strings.TrimSpace(line)
+		if id, ok := parsePong(message); ok {
+			select {
+			case pongs <- id:
+			default: // Nobody is waiting for it any more
+			}
+			continue
+		}
+		if message == "OK" {
+			continue // Acknowledges SUBSCRIBE
+		}
+		if reason, ok := strings.CutPrefix(message, "ERR "); ok {
+			c.opts.Logf("Server error: %s", reason)
+			if c.seqs != nil {
+				for _, update := range c.seqs.refused() {
+					c.deliver(ctx, handle, update)
+				}
+			}
+			continue
+		}
+		if c.seqs != nil {
+			if held, ok := c.seqs.control(message); ok {
+				if held != nil {
+					c.deliver(ctx, handle, *held)
+				}
+				continue
+			}
+		}
+		c.opts.Debugf("Server response: %s", message)
+
+		// Updates come on a line of JSON, or as a frame in a binary format
+		raw, format := []byte(message), codec.JSON
+		if n, framed, err := codec.FrameLength(message); framed {
+			if err != nil {
+				c.opts.Logf("Invalid frame from server: %v", err)
+				return err
+			}
+			raw = make([]byte, n)
+			read, err := io.ReadFull(reader, raw)
+			c.bytes.Add(uint64(read))
+			if err != nil {
+				continue // Reported by the next read
+			}
+			format = c.codec
+		}
+		var update Update
+		if err := format.Unmarshal(raw, &update); err != nil {
+			c.decodeErrors.Add(1)
+			if c.opts.OnDecodeError != nil {
+				c.opts.OnDecodeError(raw, err)
+			}
+			continue
+		}
+		c.messages.Add(1)
+		if c.seqs != nil {
+			deliver, replayFrom := c.seqs.check(update)
+			if replayFrom > 0 {
+				fmt.Fprintf(conn, "REPLAY %s %d\n", update.Symbol, replayFrom)
+			}
+			if !deliver {
+				continue
+			}
+		}
+		c.deliver(ctx, handle, update)
+	}
+}
+
+// deliver passes update to handle, logging and counting its error.
+func (c *Client) deliver(ctx context.Context, handle Handler, update Update) {
+	if err := handle(ctx, update); err != nil && ctx.Err() == nil {
+		c.handlerErrors.Add(1)
+		c.opts.Logf("Error handling update %s for %s: %v", update.ID, update.Symbol, err)
+	}
+}
+
+// dial connects to address, completing the TLS handshake when configured.
+func (c *Client) dial(ctx context.Context, address string) (net.Conn, error) {
+	conn, err := c.opts.Dialer.DialContext(ctx, c.opts.Network, address)
+	if err != nil || c.opts.TLS == nil {
+		return conn, err
+	}
+
+	config := c.opts.TLS
+	if config.ServerName == "" {
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			config = config.Clone()
+			config.ServerName = host
+		}
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// waitToReconnect sleeps for the next backoff delay, or until ctx is cancelled
+func (c *Client) waitToReconnect(ctx context.Context) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	delay := c.retry.Next()
+	c.opts.Logf("Retrying in %v...", delay.Round(time.Millisecond))
+	c.opts.OnEvent(Event{Kind: EventReconnecting, Delay: delay})
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// authenticate sends "AUTH <token> <client-id>" and waits for the server to
+// accept it. Nothing is sent when no token is configured.
+func (c *Client) authenticate(conn net.Conn, reader *bufio.Reader) error {
+	if c.opts.Token == nil {
+		return nil
+	}
+	token := c.opts.Token()
+	if token == "" {
+		return nil
+	}
+
+	if _, err := fmt.Fprintf(conn, "AUTH %s %s\n", token, c.opts.ClientID); err != nil {
+		return err
+	}
+
+	reply, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if reply = strings.TrimSpace(reply); reply != "OK" {
+		return fmt.Errorf("server replied %q", reply)
+	}
+	return nil
+}
+
+// subscribe asks the server for the configured format and only the
+// configured symbols. It is sent on every connection, so subscriptions
+// survive reconnects; the server's OKs are skipped by the read loop.
+func (c *Client) subscribe(conn net.Conn) error {
+	if c.codec != codec.JSON {
+		// Answered with OK, or with ERR by servers that cannot send it, which
+		// keep sending JSON
+		if _, err := fmt.Fprintf(conn, "FORMAT %s\n", c.codec.ContentType()); err != nil {
+			return err
+		}
+	}
+	if len(c.opts.Symbols) == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(conn, "SUBSCRIBE %s\n", strings.Join(c.opts.Symbols, ","))
+	return err
+}
@@ -0,0 +1,23 @@
+package feedclient
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewRejectsNegativeReconnectDelays(t *testing.T) {
+	for _, opts := range []Options{
+		{Servers: []string{"localhost:9501"}, ReconnectDelay: -time.Second},
+		{Servers: []string{"localhost:9501"}, ReconnectMax: -time.Second},
+	} {
+		if _, err := New(opts); err == nil {
+			t.Errorf("New accepted delay %v, max %v", opts.ReconnectDelay, opts.ReconnectMax)
+		}
+	}
+}
+
+func TestNewRejectsNegativeFailbackInterval(t *testing.T) {
+	if _, err := New(Options{Servers: []string{"localhost:9501", "localhost:9502"}, FailbackInterval: -time.Second}); err == nil {
+		t.Error("New accepted a negative failback interval")
+	}
+}
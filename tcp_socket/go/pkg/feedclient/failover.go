@@ -0,0 +1,124 @@
+package feedclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Failover strategies for Options.Failover
+const (
+	FailoverPriority   = "priority"    // Always prefer the first server, fail back to it when it recovers
+	FailoverRoundRobin = "round-robin" // Move on to the next server whenever a connection drops
+)
+
+// serverPool tracks the feed servers and decides which one to try next.
+type serverPool struct {
+	addrs    []string
+	strategy string
+	healthy  []bool // Outcome of the last attempt against each server
+	next     int    // Index of the server to try next
+	current  int    // Index of the server we are (or were last) connected to
+	failures int    // Consecutive failed attempts across all servers
+	logf     func(format string, args ...any)
+}
+
+func newServerPool(addrs []string, strategy string, logf func(string, ...any)) (*serverPool, error) {
+	p := &serverPool{strategy: strategy, logf: logf}
+	for _, addr := range addrs {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			p.addrs = append(p.addrs, addr)
+		}
+	}
+	if len(p.addrs) == 0 {
+		return nil, fmt.Errorf("no server addresses given")
+	}
+	if strategy != FailoverPriority && strategy != FailoverRoundRobin {
+		return nil, fmt.Errorf("unknown failover strategy %q", strategy)
+	}
+	p.healthy = make([]bool, len(p.addrs))
+	for i := range p.healthy {
+		p.healthy[i] = true // Innocent until proven otherwise
+	}
+	return p, nil
+}
+
+// Next returns the address to dial.
+func (p *serverPool) Next() string {
+	return p.addrs[p.next]
+}
+
+// Failed records a failed attempt against the last address returned by Next
+// and moves on. It reports true once every server has failed in a row, which
+// is when the caller should back off before trying again.
+func (p *serverPool) Failed() bool {
+	p.setHealthy(p.next, false)
+	p.failures++
+	p.next = (p.next + 1) % len(p.addrs)
+	return p.failures%len(p.addrs) == 0
+}
+
+// Connected records a successful connection to the last address returned by Next.
+func (p *serverPool) Connected() {
+	p.setHealthy(p.next, true)
+	p.failures = 0
+	p.current = p.next
+}
+
+// Dropped records that the current connection ended and picks where to go next.
+func (p *serverPool) Dropped() {
+	if p.strategy == FailoverRoundRobin {
+		p.next = (p.current + 1) % len(p.addrs)
+	} else {
+		p.next = 0
+	}
+}
+
+// OnBackup reports whether we are connected to a server other than the
+// primary while running the priority strategy, i.e. failback is worth probing.
+func (p *serverPool) OnBackup() bool {
+	return p.strategy == FailoverPriority && p.current != 0
+}
+
+// Primary returns the first configured address.
+func (p *serverPool) Primary() string {
+	return p.addrs[0]
+}
+
+func (p *serverPool) setHealthy(i int, healthy bool) {
+	if p.healthy[i] != healthy {
+		state := "down"
+		if healthy {
+			state = "up"
+		}
+		p.logf("Server %s is %s", p.addrs[i], state)
+	}
+	p.healthy[i] = healthy
+}
+
+// probePrimary dials addr every FailbackInterval and calls failBack once it
+// accepts a connection. It returns when ctx is cancelled or after failBack.
+func (c *Client) probePrimary(ctx context.Context, addr string, failBack func()) {
+	interval := c.opts.FailbackInterval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			dialCtx, cancel := context.WithTimeout(ctx, interval/2)
+			conn, err := c.opts.Dialer.DialContext(dialCtx, c.opts.Network, addr)
+			cancel()
+			if err != nil {
+				continue
+			}
+			conn.Close()
+			c.opts.Logf("Primary server %s is reachable again, failing back", addr)
+			failBack()
+			return
+		}
+	}
+}
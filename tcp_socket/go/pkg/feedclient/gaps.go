@@ -0,0 +1,146 @@
+package feedclient
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// replayTimeout is how long a requested replay may take to start before the
+// client gives up on it and takes the symbol's live updates again.
+const replayTimeout = 10 * time.Second
+
+// sequencer follows the per-symbol sequence numbers set by the server. When
+// one is skipped (typically across a reconnect) the client asks for a replay
+// of the missing range and holds back that symbol's live updates, which the
+// replay includes, until it has been received.
+type sequencer struct {
+	logf func(format string, args ...any)
+	now  func() time.Time
+
+	last map[string]uint64 // Symbol -> last sequence delivered; kept across reconnects
+
+	// Per connection
+	recovering map[string]*recovery // Symbol -> replay requested
+	replaying  string               // Symbol whose replay is being received
+	replayed   int                  // Updates delivered from that replay
+}
+
+// recovery is a replay requested for a symbol.
+type recovery struct {
+	from      uint64    // First sequence requested
+	requested time.Time // When it was requested
+	held      Update    // Latest live update held back meanwhile; Seq 0 if none
+}
+
+func newSequencer(logf func(format string, args ...any)) *sequencer {
+	return &sequencer{logf: logf, now: time.Now, last: make(map[string]uint64), recovering: make(map[string]*recovery)}
+}
+
+// reset forgets replays requested on a previous connection.
+func (s *sequencer) reset() {
+	clear(s.recovering)
+	s.replaying = ""
+}
+
+// check decides whether update should be delivered. When it reveals a gap,
+// it returns the sequence number the replay should start from.
+func (s *sequencer) check(update Update) (deliver bool, replayFrom uint64) {
+	if update.Seq == 0 {
+		return true, 0 // The server does not number updates
+	}
+
+	symbol := update.Symbol
+	if s.replaying == symbol {
+		if update.Seq <= s.last[symbol] {
+			return false, 0 // Already delivered
+		}
+		s.last[symbol] = update.Seq
+		s.replayed++
+		return true, 0
+	}
+	if r, ok := s.recovering[symbol]; ok {
+		if s.now().Sub(r.requested) < replayTimeout {
+			if update.Seq > r.held.Seq {
+				r.held = update
+			}
+			return false, 0 // Part of the replay on its way
+		}
+		s.logf("No replay of %s received in %v, giving up on it", symbol, replayTimeout)
+		delete(s.recovering, symbol)
+		s.release(symbol, r, 0) // Superseded by update
+	}
+
+	last, seen := s.last[symbol]
+	switch {
+	case !seen || update.Seq == last+1:
+	case update.Seq <= last:
+		s.logf("Sequence for %s restarted at %d (was %d), the server was probably restarted", symbol, update.Seq, last)
+	default:
+		s.logf("Missed %s updates %d-%d, requesting a replay", symbol, last+1, update.Seq-1)
+		s.recovering[symbol] = &recovery{from: last + 1, requested: s.now(), held: update}
+		return false, last + 1
+	}
+	s.last[symbol] = update.Seq
+	return true, 0
+}
+
+// control handles the REPLAYING/REPLAYED markers around a replay, reporting
+// whether line was one. Once a replay is over, it returns the update held
+// back meanwhile if the replay did not include it, to be delivered.
+func (s *sequencer) control(line string) (held *Update, ok bool) {
+	if rest, ok := strings.CutPrefix(line, "REPLAYING "); ok {
+		symbol, _, _ := strings.Cut(rest, " ")
+		s.replaying, s.replayed = symbol, 0
+		return nil, true
+	}
+
+	rest, ok := strings.CutPrefix(line, "REPLAYED ")
+	if !ok {
+		return nil, false
+	}
+	symbol, lastText, _ := strings.Cut(rest, " ")
+	last, _ := strconv.ParseUint(lastText, 10, 64)
+	r := s.recovering[symbol]
+	delete(s.recovering, symbol)
+	s.replaying = ""
+	if r == nil {
+		return nil, true // Not requested on this connection
+	}
+
+	if want := int(last) - int(r.from) + 1; last >= r.from && s.replayed < want {
+		s.logf("Recovered %d of %d missed %s updates, the rest are no longer journaled", s.replayed, want, symbol)
+	} else {
+		s.logf("Recovered %d missed %s updates", s.replayed, symbol)
+	}
+	return s.release(symbol, r, last), true
+}
+
+// refused gives up on the replays not started yet after the server answered
+// a REPLAY with an error, returning the updates held back for them.
+func (s *sequencer) refused() []Update {
+	var held []Update
+	for symbol, r := range s.recovering {
+		if symbol == s.replaying {
+			continue
+		}
+		s.logf("Replay of %s refused, %s updates from %d are lost", symbol, symbol, r.from)
+		delete(s.recovering, symbol)
+		if update := s.release(symbol, r, 0); update != nil {
+			held = append(held, *update)
+		}
+	}
+	return held
+}
+
+// release moves the last sequence of symbol past the replay that ended at
+// last and past the update held back for it, returning that update unless
+// it was delivered already.
+func (s *sequencer) release(symbol string, r *recovery, last uint64) *Update {
+	s.last[symbol] = max(s.last[symbol], last)
+	if r.held.Seq <= s.last[symbol] {
+		return nil
+	}
+	s.last[symbol] = r.held.Seq
+	return &r.held
+}
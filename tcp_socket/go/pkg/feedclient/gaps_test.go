@@ -0,0 +1,88 @@
+package feedclient
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestSequencer returns a sequencer on a clock the test moves, which has
+// delivered AAPL up to seq 1.
+func newTestSequencer(t *testing.T) (*sequencer, *time.Time) {
+	t.Helper()
+	now := time.UnixMilli(1_700_000_000_000)
+	s := newSequencer(t.Logf)
+	s.now = func() time.Time { return now }
+	if deliver, _ := s.check(Update{Symbol: "AAPL", Seq: 1}); !deliver {
+		t.Fatal("the first update was held back")
+	}
+	return s, &now
+}
+
+// gap makes s miss AAPL 2-3, checking that 4 is held back for a replay from 2.
+func gap(t *testing.T, s *sequencer) {
+	t.Helper()
+	if deliver, from := s.check(Update{Symbol: "AAPL", Seq: 4}); deliver || from != 2 {
+		t.Fatalf("after a gap: deliver %v, replay from %d; want it held back for a replay from 2", deliver, from)
+	}
+	if deliver, from := s.check(Update{Symbol: "AAPL", Seq: 5}); deliver || from != 0 {
+		t.Fatalf("while recovering: deliver %v, replay from %d; want it held back", deliver, from)
+	}
+}
+
+func TestSequencerReplaysGap(t *testing.T) {
+	s, _ := newTestSequencer(t)
+	gap(t, s)
+
+	if _, ok := s.control("REPLAYING AAPL 2"); !ok {
+		t.Fatal("REPLAYING not handled")
+	}
+	for seq := uint64(2); seq <= 5; seq++ {
+		if deliver, _ := s.check(Update{Symbol: "AAPL", Seq: seq}); !deliver {
+			t.Fatalf("replayed update %d was not delivered", seq)
+		}
+	}
+	if held, ok := s.control("REPLAYED AAPL 5"); !ok || held != nil {
+		t.Fatalf("REPLAYED gave %+v, %v; want nothing more to deliver", held, ok)
+	}
+	if deliver, from := s.check(Update{Symbol: "AAPL", Seq: 6}); !deliver || from != 0 {
+		t.Errorf("after the replay: deliver %v, replay from %d; want 6 delivered", deliver, from)
+	}
+}
+
+func TestSequencerEmptyReplayReleasesHeldUpdate(t *testing.T) {
+	s, _ := newTestSequencer(t)
+	gap(t, s)
+
+	// A server journaling nothing replays nothing
+	s.control("REPLAYING AAPL 2")
+	held, ok := s.control("REPLAYED AAPL 0")
+	if !ok || held == nil || held.Seq != 5 {
+		t.Fatalf("REPLAYED gave %+v, %v; want the held back update 5", held, ok)
+	}
+	if deliver, from := s.check(Update{Symbol: "AAPL", Seq: 6}); !deliver || from != 0 {
+		t.Errorf("after the replay: deliver %v, replay from %d; want 6 delivered", deliver, from)
+	}
+}
+
+func TestSequencerRefusedReplayReleasesHeldUpdate(t *testing.T) {
+	s, _ := newTestSequencer(t)
+	gap(t, s)
+
+	held := s.refused()
+	if len(held) != 1 || held[0].Seq != 5 {
+		t.Fatalf("refused gave %+v, want the held back update 5", held)
+	}
+	if deliver, from := s.check(Update{Symbol: "AAPL", Seq: 6}); !deliver || from != 0 {
+		t.Errorf("after the refusal: deliver %v, replay from %d; want 6 delivered", deliver, from)
+	}
+}
+
+func TestSequencerGivesUpOnReplayAfterTimeout(t *testing.T) {
+	s, now := newTestSequencer(t)
+	gap(t, s)
+
+	*now = now.Add(replayTimeout)
+	if deliver, from := s.check(Update{Symbol: "AAPL", Seq: 6}); !deliver || from != 0 {
+		t.Errorf("after the timeout: deliver %v, replay from %d; want 6 delivered", deliver, from)
+	}
+}
@@ -0,0 +1,87 @@
+package feedclient
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Group reads the feed over several connections at once, each subscribed to
+// a shard of the symbols, for more throughput than one connection can read.
+type Group struct {
+	clients []*Client
+}
+
+// NewGroup creates a Group of up to connections Clients sharing opts, with
+// opts.Symbols dealt out between them. Sharding needs an explicit symbol
+// list; with a single connection the Group behaves like a plain Client.
+func NewGroup(opts Options, connections int) (*Group, error) {
+	if connections <= 1 {
+		c, err := New(opts)
+		if err != nil {
+			return nil, err
+		}
+		return &Group{clients: []*Client{c}}, nil
+	}
+	if len(opts.Symbols) == 0 {
+		return nil, errors.New("parallel connections need an explicit list of symbols to shard")
+	}
+
+	connections = min(connections, len(opts.Symbols))
+	shards := make([][]string, connections)
+	for i, symbol := range opts.Symbols {
+		shards[i%connections] = append(shards[i%connections], symbol)
+	}
+
+	g := &Group{}
+	for _, shard := range shards {
+		shardOpts := opts
+		shardOpts.Symbols = shard
+		c, err := New(shardOpts)
+		if err != nil {
+			return nil, err
+		}
+		g.clients = append(g.clients, c)
+	}
+	return g, nil
+}
+
+// Run runs every connection until ctx is cancelled, merging their updates
+// into handle. handle is called concurrently from each connection, though
+// the updates of any one symbol always come from the same connection.
+func (g *Group) Run(ctx context.Context, handle Handler) {
+	var wg sync.WaitGroup
+	for _, c := range g.clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Run(ctx, handle)
+		}()
+	}
+	wg.Wait()
+}
+
+// Stats returns the counters summed over all connections.
+func (g *Group) Stats() Stats {
+	var total Stats
+	for _, c := range g.clients {
+		s := c.Stats()
+		total.Connects += s.Connects
+		total.Messages += s.Messages
+		total.Bytes += s.Bytes
+		total.DecodeErrors += s.DecodeErrors
+		total.HandlerErrors += s.HandlerErrors
+	}
+	return total
+}
+
+// Connected returns how many of the connections are up.
+func (g *Group) Connected() int {
+	n := 0
+	for _, c := range g.clients {
+		if c.Connected() {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,23 @@
+package feedclient
+
+import "context"
+
+// Handler processes one decoded update. It is called from the read loop, so
+// it should return quickly; a returned error is logged and counted but does
+// not stop the feed.
+type Handler func(ctx context.Context, update Update) error
+
+// Middleware wraps a Handler to add processing before or after it, such as
+// logging, enrichment or forwarding. It may also decide not to call next.
+type Middleware func(next Handler) Handler
+
+// Chain wraps handle in middleware. The first middleware is the outermost,
+// so it sees each update first:
+//
+//	Chain(store, logUpdates, enrich) // logUpdates -> enrich -> store
+func Chain(handle Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handle = middleware[i](handle)
+	}
+	return handle
+}
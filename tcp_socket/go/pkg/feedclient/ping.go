@@ -0,0 +1,73 @@
+package feedclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runPinger sends "PING <n>" every PingInterval and waits for the matching
+// PONG, which the read loop forwards on pongs. When a reply doesn't arrive
+// within PingTimeout the connection is considered dead and teardown is
+// called, instead of waiting for a read error that may take minutes to surface.
+func (c *Client) runPinger(ctx context.Context, w io.Writer, pongs <-chan uint64, teardown func()) {
+	timeout := c.opts.PingTimeout
+	ticker := time.NewTicker(c.opts.PingInterval)
+	defer ticker.Stop()
+
+	var seq uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		seq++
+		sentAt := time.Now()
+		if _, err := fmt.Fprintf(w, "PING %d\n", seq); err != nil {
+			return // The read loop will notice the broken connection
+		}
+
+		if !awaitPong(ctx, seq, timeout, pongs) {
+			if ctx.Err() == nil {
+				c.opts.Logf("No PONG within %v, reconnecting...", timeout)
+				teardown()
+			}
+			return
+		}
+		c.opts.Debugf("Ping latency: %v", time.Since(sentAt).Round(time.Microsecond))
+	}
+}
+
+// awaitPong waits for the PONG carrying seq, skipping stale replies.
+func awaitPong(ctx context.Context, seq uint64, timeout time.Duration, pongs <-chan uint64) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-deadline.C:
+			return false
+		case id := <-pongs:
+			if id == seq {
+				return true
+			}
+		}
+	}
+}
+
+// parsePong extracts the id from a "PONG <n>" line.
+func parsePong(line string) (uint64, bool) {
+	rest, ok := strings.CutPrefix(line, "PONG ")
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(rest, 10, 64)
+	return id, err == nil
+}
@@ -0,0 +1,8 @@
+// Package feedpb holds the code generated from proto/feed/v1/feed.proto: the
+// messages, the PriceFeed gRPC service served by the client with -grpc-addr,
+// and its grpc-gateway reverse proxy, routed by feed_gateway.yaml, behind
+// the client's /v1/ endpoints. Regenerate it with go generate after editing
+// either file.
+package feedpb
+
+//go:generate protoc -I ../../proto --go_out=../.. --go_opt=module=ifin --go-grpc_out=../.. --go-grpc_opt=module=ifin --grpc-gateway_out=../.. --grpc-gateway_opt=module=ifin --grpc-gateway_opt=grpc_api_configuration=../../proto/feed/v1/feed_gateway.yaml feed/v1/feed.proto
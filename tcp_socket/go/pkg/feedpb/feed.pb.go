@@ -0,0 +1,434 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v5.29.3
+// source: feed/v1/feed.proto
+
+package feedpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Price is one update of a symbol.
+type Price struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Symbol string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	Price  float64                `protobuf:"fixed64,2,opt,name=price,proto3" json:"price,omitempty"`
+	// Generation time, Unix milliseconds
+	Ts int64 `protobuf:"varint,3,opt,name=ts,proto3" json:"ts,omitempty"`
+	// Per-symbol sequence number
+	Seq uint64 `protobuf:"varint,4,opt,name=seq,proto3" json:"seq,omitempty"`
+	// Older than -stale-after
+	Stale         bool `protobuf:"varint,5,opt,name=stale,proto3" json:"stale,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Price) Reset() {
+	*x = Price{}
+	mi := &file_feed_v1_feed_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Price) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Price) ProtoMessage() {}
+
+func (x *Price) ProtoReflect() protoreflect.Message {
+	mi := &file_feed_v1_feed_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Price.ProtoReflect.Descriptor instead.
+func (*Price) Descriptor() ([]byte, []int) {
+	return file_feed_v1_feed_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Price) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *Price) GetPrice() float64 {
+	if x != nil {
+		return x.Price
+	}
+	return 0
+}
+
+func (x *Price) GetTs() int64 {
+	if x != nil {
+		return x.Ts
+	}
+	return 0
+}
+
+func (x *Price) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *Price) GetStale() bool {
+	if x != nil {
+		return x.Stale
+	}
+	return false
+}
+
+type GetLatestRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Symbols to return; every symbol when empty
+	Symbols       []string `protobuf:"bytes,1,rep,name=symbols,proto3" json:"symbols,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetLatestRequest) Reset() {
+	*x = GetLatestRequest{}
+	mi := &file_feed_v1_feed_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetLatestRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetLatestRequest) ProtoMessage() {}
+
+func (x *GetLatestRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_feed_v1_feed_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetLatestRequest.ProtoReflect.Descriptor instead.
+func (*GetLatestRequest) Descriptor() ([]byte, []int) {
+	return file_feed_v1_feed_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetLatestRequest) GetSymbols() []string {
+	if x != nil {
+		return x.Symbols
+	}
+	return nil
+}
+
+type GetLatestResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Sorted by symbol
+	Prices        []*Price `protobuf:"bytes,1,rep,name=prices,proto3" json:"prices,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetLatestResponse) Reset() {
+	*x = GetLatestResponse{}
+	mi := &file_feed_v1_feed_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetLatestResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetLatestResponse) ProtoMessage() {}
+
+func (x *GetLatestResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_feed_v1_feed_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetLatestResponse.ProtoReflect.Descriptor instead.
+func (*GetLatestResponse) Descriptor() ([]byte, []int) {
+	return file_feed_v1_feed_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetLatestResponse) GetPrices() []*Price {
+	if x != nil {
+		return x.Prices
+	}
+	return nil
+}
+
+type GetHistoryRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Symbol string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	// Start of the range, Unix milliseconds; 0 for the oldest kept
+	From int64 `protobuf:"varint,2,opt,name=from,proto3" json:"from,omitempty"`
+	// End of the range, Unix milliseconds; 0 for the newest
+	To int64 `protobuf:"varint,3,opt,name=to,proto3" json:"to,omitempty"`
+	// Most updates to return; 0 for the default of 1000
+	Limit         int32 `protobuf:"varint,4,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetHistoryRequest) Reset() {
+	*x = GetHistoryRequest{}
+	mi := &file_feed_v1_feed_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetHistoryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetHistoryRequest) ProtoMessage() {}
+
+func (x *GetHistoryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_feed_v1_feed_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetHistoryRequest.ProtoReflect.Descriptor instead.
+func (*GetHistoryRequest) Descriptor() ([]byte, []int) {
+	return file_feed_v1_feed_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetHistoryRequest) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *GetHistoryRequest) GetFrom() int64 {
+	if x != nil {
+		return x.From
+	}
+	return 0
+}
+
+func (x *GetHistoryRequest) GetTo() int64 {
+	if x != nil {
+		return x.To
+	}
+	return 0
+}
+
+func (x *GetHistoryRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type GetHistoryResponse struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Prices []*Price               `protobuf:"bytes,1,rep,name=prices,proto3" json:"prices,omitempty"`
+	// The from of the next page; 0 on the last
+	Next          int64 `protobuf:"varint,2,opt,name=next,proto3" json:"next,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetHistoryResponse) Reset() {
+	*x = GetHistoryResponse{}
+	mi := &file_feed_v1_feed_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetHistoryResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetHistoryResponse) ProtoMessage() {}
+
+func (x *GetHistoryResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_feed_v1_feed_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetHistoryResponse.ProtoReflect.Descriptor instead.
+func (*GetHistoryResponse) Descriptor() ([]byte, []int) {
+	return file_feed_v1_feed_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GetHistoryResponse) GetPrices() []*Price {
+	if x != nil {
+		return x.Prices
+	}
+	return nil
+}
+
+func (x *GetHistoryResponse) GetNext() int64 {
+	if x != nil {
+		return x.Next
+	}
+	return 0
+}
+
+type StreamTicksRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Symbols to stream; every symbol when empty
+	Symbols       []string `protobuf:"bytes,1,rep,name=symbols,proto3" json:"symbols,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamTicksRequest) Reset() {
+	*x = StreamTicksRequest{}
+	mi := &file_feed_v1_feed_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamTicksRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamTicksRequest) ProtoMessage() {}
+
+func (x *StreamTicksRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_feed_v1_feed_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamTicksRequest.ProtoReflect.Descriptor instead.
+func (*StreamTicksRequest) Descriptor() ([]byte, []int) {
+	return file_feed_v1_feed_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *StreamTicksRequest) GetSymbols() []string {
+	if x != nil {
+		return x.Symbols
+	}
+	return nil
+}
+
+var File_feed_v1_feed_proto protoreflect.FileDescriptor
+
+const file_feed_v1_feed_proto_rawDesc = "" +
+	"\n\x12feed/v1/feed.proto\x12\afeed.v1" +
+	"\"m\n\x05Price\x12\x16\n\x06symbol\x18\x01 \x01(\tR\x06symbol\x12\x14\n\x05price\x18\x02 \x01(\x01R\x05price\x12\x0e\n\x02ts\x18\x03 \x01(\x03R\x02ts\x12\x10\n\x03seq\x18\x04 \x01(\x04R\x03seq\x12\x14\n\x05stale\x18\x05 \x01(\bR\x05stale" +
+	"\",\n\x10GetLatestRequest\x12\x18\n\asymbols\x18\x01 \x03(\tR\asymbols" +
+	"\";\n\x11GetLatestResponse\x12&\n\x06prices\x18\x01 \x03(\v2\x0e.feed.v1.PriceR\x06prices" +
+	"\"e\n\x11GetHistoryRequest\x12\x16\n\x06symbol\x18\x01 \x01(\tR\x06symbol\x12\x12\n\x04from\x18\x02 \x01(\x03R\x04from\x12\x0e\n\x02to\x18\x03 \x01(\x03R\x02to\x12\x14\n\x05limit\x18\x04 \x01(\x05R\x05limit" +
+	"\"P\n\x12GetHistoryResponse\x12&\n\x06prices\x18\x01 \x03(\v2\x0e.feed.v1.PriceR\x06prices\x12\x12\n\x04next\x18\x02 \x01(\x03R\x04next" +
+	"\".\n\x12StreamTicksRequest\x12\x18\n\asymbols\x18\x01 \x03(\tR\asymbols" +
+	"2\xd4\x01\n\tPriceFeed\x12B\n\tGetLatest\x12\x19.feed.v1.GetLatestRequest\x1a\x1a.feed.v1.GetLatestResponse\x12E\n\nGetHistory\x12\x1a.feed.v1.GetHistoryRequest\x1a\x1b.feed.v1.GetHistoryResponse\x12<\n\vStreamTicks\x12\x1b.feed.v1.StreamTicksRequest\x1a\x0e.feed.v1.Price0\x01B\x18Z\x16ifin/pkg/feedpb;feedpbb\x06proto3"
+
+var (
+	file_feed_v1_feed_proto_rawDescOnce sync.Once
+	file_feed_v1_feed_proto_rawDescData []byte
+)
+
+func file_feed_v1_feed_proto_rawDescGZIP() []byte {
+	file_feed_v1_feed_proto_rawDescOnce.Do(func() {
+		file_feed_v1_feed_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_feed_v1_feed_proto_rawDesc), len(file_feed_v1_feed_proto_rawDesc)))
+	})
+	return file_feed_v1_feed_proto_rawDescData
+}
+
+var file_feed_v1_feed_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_feed_v1_feed_proto_goTypes = []any{
+	(*Price)(nil),              // 0: feed.v1.Price
+	(*GetLatestRequest)(nil),   // 1: feed.v1.GetLatestRequest
+	(*GetLatestResponse)(nil),  // 2: feed.v1.GetLatestResponse
+	(*GetHistoryRequest)(nil),  // 3: feed.v1.GetHistoryRequest
+	(*GetHistoryResponse)(nil), // 4: feed.v1.GetHistoryResponse
+	(*StreamTicksRequest)(nil), // 5: feed.v1.StreamTicksRequest
+}
+var file_feed_v1_feed_proto_depIdxs = []int32{
+	0, // 0: feed.v1.GetLatestResponse.prices:type_name -> feed.v1.Price
+	0, // 1: feed.v1.GetHistoryResponse.prices:type_name -> feed.v1.Price
+	1, // 2: feed.v1.PriceFeed.GetLatest:input_type -> feed.v1.GetLatestRequest
+	3, // 3: feed.v1.PriceFeed.GetHistory:input_type -> feed.v1.GetHistoryRequest
+	5, // 4: feed.v1.PriceFeed.StreamTicks:input_type -> feed.v1.StreamTicksRequest
+	2, // 5: feed.v1.PriceFeed.GetLatest:output_type -> feed.v1.GetLatestResponse
+	4, // 6: feed.v1.PriceFeed.GetHistory:output_type -> feed.v1.GetHistoryResponse
+	0, // 7: feed.v1.PriceFeed.StreamTicks:output_type -> feed.v1.Price
+	5, // [5:8] is the sub-list for method output_type
+	2, // [2:5] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_feed_v1_feed_proto_init() }
+func file_feed_v1_feed_proto_init() {
+	if File_feed_v1_feed_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_feed_v1_feed_proto_rawDesc), len(file_feed_v1_feed_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_feed_v1_feed_proto_goTypes,
+		DependencyIndexes: file_feed_v1_feed_proto_depIdxs,
+		MessageInfos:      file_feed_v1_feed_proto_msgTypes,
+	}.Build()
+	File_feed_v1_feed_proto = out.File
+	file_feed_v1_feed_proto_goTypes = nil
+	file_feed_v1_feed_proto_depIdxs = nil
+}
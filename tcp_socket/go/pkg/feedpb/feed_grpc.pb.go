@@ -0,0 +1,215 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: feed/v1/feed.proto
+
+package feedpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	PriceFeed_GetLatest_FullMethodName   = "/feed.v1.PriceFeed/GetLatest"
+	PriceFeed_GetHistory_FullMethodName  = "/feed.v1.PriceFeed/GetHistory"
+	PriceFeed_StreamTicks_FullMethodName = "/feed.v1.PriceFeed/StreamTicks"
+)
+
+// PriceFeedClient is the client API for PriceFeed service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// PriceFeed serves the prices the client has stored.
+type PriceFeedClient interface {
+	// GetLatest returns the latest price of every symbol, or of the symbols
+	// asked for.
+	GetLatest(ctx context.Context, in *GetLatestRequest, opts ...grpc.CallOption) (*GetLatestResponse, error)
+	// GetHistory returns a page of a symbol's history, oldest first.
+	GetHistory(ctx context.Context, in *GetHistoryRequest, opts ...grpc.CallOption) (*GetHistoryResponse, error)
+	// StreamTicks sends every update, or those of the symbols asked for, as it
+	// arrives.
+	StreamTicks(ctx context.Context, in *StreamTicksRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Price], error)
+}
+
+type priceFeedClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPriceFeedClient(cc grpc.ClientConnInterface) PriceFeedClient {
+	return &priceFeedClient{cc}
+}
+
+func (c *priceFeedClient) GetLatest(ctx context.Context, in *GetLatestRequest, opts ...grpc.CallOption) (*GetLatestResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetLatestResponse)
+	err := c.cc.Invoke(ctx, PriceFeed_GetLatest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *priceFeedClient) GetHistory(ctx context.Context, in *GetHistoryRequest, opts ...grpc.CallOption) (*GetHistoryResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetHistoryResponse)
+	err := c.cc.Invoke(ctx, PriceFeed_GetHistory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *priceFeedClient) StreamTicks(ctx context.Context, in *StreamTicksRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Price], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &PriceFeed_ServiceDesc.Streams[0], PriceFeed_StreamTicks_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamTicksRequest, Price]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PriceFeed_StreamTicksClient = grpc.ServerStreamingClient[Price]
+
+// PriceFeedServer is the server API for PriceFeed service.
+// All implementations must embed UnimplementedPriceFeedServer
+// for forward compatibility.
+//
+// PriceFeed serves the prices the client has stored.
+type PriceFeedServer interface {
+	// GetLatest returns the latest price of every symbol, or of the symbols
+	// asked for.
+	GetLatest(context.Context, *GetLatestRequest) (*GetLatestResponse, error)
+	// GetHistory returns a page of a symbol's history, oldest first.
+	GetHistory(context.Context, *GetHistoryRequest) (*GetHistoryResponse, error)
+	// StreamTicks sends every update, or those of the symbols asked for, as it
+	// arrives.
+	StreamTicks(*StreamTicksRequest, grpc.ServerStreamingServer[Price]) error
+	mustEmbedUnimplementedPriceFeedServer()
+}
+
+// UnimplementedPriceFeedServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedPriceFeedServer struct{}
+
+func (UnimplementedPriceFeedServer) GetLatest(context.Context, *GetLatestRequest) (*GetLatestResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLatest not implemented")
+}
+func (UnimplementedPriceFeedServer) GetHistory(context.Context, *GetHistoryRequest) (*GetHistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetHistory not implemented")
+}
+func (UnimplementedPriceFeedServer) StreamTicks(*StreamTicksRequest, grpc.ServerStreamingServer[Price]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamTicks not implemented")
+}
+func (UnimplementedPriceFeedServer) mustEmbedUnimplementedPriceFeedServer() {}
+func (UnimplementedPriceFeedServer) testEmbeddedByValue()                   {}
+
+// UnsafePriceFeedServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PriceFeedServer will
+// result in compilation errors.
+type UnsafePriceFeedServer interface {
+	mustEmbedUnimplementedPriceFeedServer()
+}
+
+func RegisterPriceFeedServer(s grpc.ServiceRegistrar, srv PriceFeedServer) {
+	// If the following call pancis, it indicates UnimplementedPriceFeedServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&PriceFeed_ServiceDesc, srv)
+}
+
+func _PriceFeed_GetLatest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLatestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PriceFeedServer).GetLatest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PriceFeed_GetLatest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PriceFeedServer).GetLatest(ctx, req.(*GetLatestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PriceFeed_GetHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PriceFeedServer).GetHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PriceFeed_GetHistory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PriceFeedServer).GetHistory(ctx, req.(*GetHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PriceFeed_StreamTicks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamTicksRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PriceFeedServer).StreamTicks(m, &grpc.GenericServerStream[StreamTicksRequest, Price]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PriceFeed_StreamTicksServer = grpc.ServerStreamingServer[Price]
+
+// PriceFeed_ServiceDesc is the grpc.ServiceDesc for PriceFeed service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PriceFeed_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "feed.v1.PriceFeed",
+	HandlerType: (*PriceFeedServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetLatest",
+			Handler:    _PriceFeed_GetLatest_Handler,
+		},
+		{
+			MethodName: "GetHistory",
+			Handler:    _PriceFeed_GetHistory_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamTicks",
+			Handler:       _PriceFeed_StreamTicks_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "feed/v1/feed.proto",
+}
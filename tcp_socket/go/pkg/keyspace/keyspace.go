@@ -0,0 +1,58 @@
+// Package keyspace names the Redis keys used for the price feed. Every name
+// starts with a configurable prefix, so several client instances can share
+// one Redis without colliding.
+package keyspace
+
+// DefaultPrefix is the prefix used when none is configured
+const DefaultPrefix = "tcp"
+
+// Namespace builds key names under Prefix, e.g. tcp.data or
+// tcp.history.AAPL. With HashTags set, as needed on Redis Cluster, the
+// symbol in per-symbol keys becomes a hash tag (tcp.history.{AAPL}) so all
+// of a symbol's keys live in the same slot.
+type Namespace struct {
+	Prefix   string
+	HashTags bool
+}
+
+// Default is the namespace of a client with no prefix configured
+var Default = Namespace{Prefix: DefaultPrefix}
+
+// Key returns name within the namespace, e.g. tcp.updates.
+func (n Namespace) Key(name string) string {
+	return n.Prefix + "." + name
+}
+
+// Symbol returns the key of kind (data, history, stream, ...) for symbol.
+func (n Namespace) Symbol(kind, symbol string) string {
+	if n.HashTags {
+		symbol = "{" + symbol + "}"
+	}
+	return n.Key(kind) + "." + symbol
+}
+
+// Pattern matches the keys of kind for every symbol, for SCAN.
+func (n Namespace) Pattern(kind string) string {
+	return n.Key(kind) + ".*"
+}
+
+// Data is the hash of latest prices, with a field per symbol.
+func (n Namespace) Data() string {
+	return n.Key("data")
+}
+
+// Latest is the key holding symbol's latest price when each symbol has its
+// own key.
+func (n Namespace) Latest(symbol string) string {
+	return n.Symbol("data", symbol)
+}
+
+// History is the sorted set of symbol's past updates.
+func (n Namespace) History(symbol string) string {
+	return n.Symbol("history", symbol)
+}
+
+// Stream is the Redis Stream of symbol's past updates.
+func (n Namespace) Stream(symbol string) string {
+	return n.Symbol("stream", symbol)
+}
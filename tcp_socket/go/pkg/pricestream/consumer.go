@@ -0,0 +1,99 @@
+package pricestream
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"ifin/pkg/feedclient"
+	"ifin/pkg/keyspace"
+)
+
+// Consumer reads symbol streams as a member of a consumer group. Every entry
+// is delivered to one member of the group and acknowledged once the handler
+// succeeds; entries whose handler failed stay pending and are delivered
+// again when the consumer restarts.
+type Consumer struct {
+	rdb     redis.UniversalClient
+	keys    keyspace.Namespace
+	group   string
+	name    string
+	symbols []string
+
+	Block time.Duration // How long one read waits for new entries (5s)
+	Count int64         // Entries fetched per read (100)
+}
+
+// NewConsumer creates a Consumer named name in group, reading the streams
+// of symbols in keys. On Redis Cluster the streams are read with one command, so
+// they must share a hash slot: use a Consumer per symbol there.
+func NewConsumer(rdb redis.UniversalClient, keys keyspace.Namespace, group, name string, symbols []string) *Consumer {
+	return &Consumer{rdb: rdb, keys: keys, group: group, name: name, symbols: symbols, Block: 5 * time.Second, Count: 100}
+}
+
+// Run creates the group where needed (starting from the oldest entry kept)
+// and consumes until ctx is cancelled. Entries left pending by an earlier
+// run are handled first.
+func (c *Consumer) Run(ctx context.Context, handle feedclient.Handler) error {
+	for _, symbol := range c.symbols {
+		err := c.rdb.XGroupCreateMkStream(ctx, c.keys.Stream(symbol), c.group, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return err
+		}
+	}
+
+	start := "0" // Our pending entries; ">" once they are all handled
+	for ctx.Err() == nil {
+		streams, err := c.read(ctx, start)
+		if err != nil {
+			if errors.Is(err, redis.Nil) || ctx.Err() != nil {
+				continue // Nothing new within Block
+			}
+			return err
+		}
+
+		received, acked := 0, 0
+		for _, stream := range streams {
+			for _, entry := range stream.Messages {
+				received++
+				update, err := decode(entry)
+				if err == nil {
+					err = handle(ctx, update)
+				}
+				if err != nil {
+					continue // Stays pending
+				}
+				if err := c.rdb.XAck(ctx, stream.Stream, c.group, entry.ID).Err(); err != nil {
+					return err
+				}
+				acked++
+			}
+		}
+		// Move on to new entries once the backlog is done, or only entries
+		// that keep failing are left in it
+		if start == "0" && (received < int(c.Count) || acked == 0) {
+			start = ">"
+		}
+	}
+	return nil
+}
+
+func (c *Consumer) read(ctx context.Context, start string) ([]redis.XStream, error) {
+	streams := make([]string, 0, 2*len(c.symbols))
+	for _, symbol := range c.symbols {
+		streams = append(streams, c.keys.Stream(symbol))
+	}
+	for range c.symbols {
+		streams = append(streams, start)
+	}
+	return c.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    c.group,
+		Consumer: c.name,
+		Streams:  streams,
+		Count:    c.Count,
+		Block:    c.Block,
+	}).Result()
+}
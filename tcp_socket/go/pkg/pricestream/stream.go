@@ -0,0 +1,70 @@
+// Package pricestream keeps the history of each symbol in a Redis Stream and
+// reads it back, either directly or through a consumer group so that several
+// SSE servers or downstream processors can share it reliably.
+package pricestream
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+
+	"ifin/pkg/codec"
+	"ifin/pkg/compression"
+	"ifin/pkg/feedclient"
+	"ifin/pkg/keyspace"
+)
+
+// dataField is the stream entry field holding the encoded update
+const dataField = "data"
+
+// adder is satisfied by both redis.UniversalClient and redis.Pipeliner.
+type adder interface {
+	XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd
+}
+
+// Add appends message, the update encoded by codec.Encode (and possibly
+// compressed, see package compression), to symbol's stream in keys, trimming
+// the stream to roughly maxLen entries.
+func Add(ctx context.Context, rdb adder, keys keyspace.Namespace, symbol, message string, maxLen int64) *redis.StringCmd {
+	return rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: keys.Stream(symbol),
+		MaxLen: maxLen,
+		Approx: true, // Let Redis trim whole nodes, which is much cheaper
+		Values: map[string]any{dataField: message},
+	})
+}
+
+// History returns up to count of the most recent updates in symbol's stream
+// in keys, newest first.
+func History(ctx context.Context, rdb redis.UniversalClient, keys keyspace.Namespace, symbol string, count int64) ([]feedclient.Update, error) {
+	entries, err := rdb.XRevRangeN(ctx, keys.Stream(symbol), "+", "-", count).Result()
+	if err != nil {
+		return nil, err
+	}
+	updates := make([]feedclient.Update, 0, len(entries))
+	for _, entry := range entries {
+		update, err := decode(entry)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, update)
+	}
+	return updates, nil
+}
+
+func decode(entry redis.XMessage) (feedclient.Update, error) {
+	var update feedclient.Update
+	data, ok := entry.Values[dataField].(string)
+	if !ok {
+		return update, fmt.Errorf("stream entry %s has no %s field", entry.ID, dataField)
+	}
+	raw, err := compression.Decompress([]byte(data))
+	if err != nil {
+		return update, fmt.Errorf("stream entry %s: %w", entry.ID, err)
+	}
+	if err := codec.Decode(raw, &update); err != nil {
+		return update, fmt.Errorf("stream entry %s: %w", entry.ID, err)
+	}
+	return update, nil
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"ifin/pkg/feedclient"
+)
+
+// maxPendingTicks is the most updates held while a database is unreachable;
+// beyond it the oldest are dropped
+const maxPendingTicks = 100000
+
+// tickBatch collects updates between the batched inserts of a SQL store.
+type tickBatch struct {
+	mu      sync.Mutex
+	pending []feedclient.Update
+}
+
+func (b *tickBatch) add(update feedclient.Update) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.pending) >= maxPendingTicks {
+		b.pending = b.pending[1:]
+	}
+	b.pending = append(b.pending, update)
+}
+
+// flush hands the pending updates to insert. When that fails they are put
+// back, ahead of anything added meanwhile, for the next attempt.
+func (b *tickBatch) flush(insert func([]feedclient.Update) error) error {
+	b.mu.Lock()
+	updates := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+	if len(updates) == 0 {
+		return nil
+	}
+
+	err := insert(updates)
+	if err != nil {
+		b.mu.Lock()
+		b.pending = append(updates, b.pending...)
+		if excess := len(b.pending) - maxPendingTicks; excess > 0 {
+			b.pending = b.pending[excess:]
+		}
+		b.mu.Unlock()
+	}
+	return err
+}
+
+// runFlushes calls flush every interval until ctx is done, reporting
+// failures to onError.
+func runFlushes(ctx context.Context, interval time.Duration, flush func(context.Context) error, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := flush(ctx); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"ifin/pkg/feedclient"
+)
+
+// Buckets of a Bolt store
+var (
+	latestBucket  = []byte("latest")  // Symbol -> update JSON
+	historyBucket = []byte("history") // A bucket per symbol: timestamp and sequence -> update JSON
+)
+
+// Bolt keeps prices in a local BoltDB file, so they survive restarts with
+// no database server to run. Only one process can open the file at a time.
+type Bolt struct {
+	db        *bolt.DB
+	retention time.Duration // 0 keeps no history
+	hub       hub
+}
+
+// OpenBolt opens (creating if needed) the Bolt store in path.
+func OpenBolt(path string, retention time.Duration) (*Bolt, error) {
+	// Fail rather than wait forever when another process holds the file
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(latestBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(historyBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Bolt{db: db, retention: retention}, nil
+}
+
+// Close closes the file.
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
+
+func (b *Bolt) Put(ctx context.Context, update feedclient.Update) error {
+	value, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+
+	// Batch lets concurrent Puts share one transaction and fsync
+	err = b.db.Batch(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(latestBucket).Put([]byte(update.Symbol), value); err != nil {
+			return err
+		}
+		if b.retention <= 0 {
+			return nil
+		}
+
+		history, err := tx.Bucket(historyBucket).CreateBucketIfNotExists([]byte(update.Symbol))
+		if err != nil {
+			return err
+		}
+		seq, err := history.NextSequence()
+		if err != nil {
+			return err
+		}
+		if err := history.Put(historyKey(update.Timestamp, seq), value); err != nil {
+			return err
+		}
+
+		// Drop what fell out of the retention period
+		cutoff := historyKey(time.UnixMilli(update.Timestamp).Add(-b.retention).UnixMilli(), 0)
+		cursor := history.Cursor()
+		for k, _ := cursor.First(); k != nil && bytes.Compare(k, cutoff) < 0; k, _ = cursor.Next() {
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	b.hub.publish(update)
+	return nil
+}
+
+func (b *Bolt) GetLatest(ctx context.Context, symbol string) (feedclient.Update, bool, error) {
+	var update feedclient.Update
+	found := false
+	err := b.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(latestBucket).Get([]byte(symbol))
+		if value == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(value, &update)
+	})
+	return update, found, err
+}
+
+func (b *Bolt) GetAll(ctx context.Context) ([]feedclient.Update, error) {
+	var updates []feedclient.Update
+	err := b.db.View(func(tx *bolt.Tx) error {
+		// Keys are symbols and Bolt iterates in key order, so no sorting is needed
+		return tx.Bucket(latestBucket).ForEach(func(_, value []byte) error {
+			var update feedclient.Update
+			if err := json.Unmarshal(value, &update); err != nil {
+				return err
+			}
+			updates = append(updates, update)
+			return nil
+		})
+	})
+	return updates, err
+}
+
+func (b *Bolt) History(ctx context.Context, symbol string, from, to time.Time) ([]feedclient.Update, error) {
+	var updates []feedclient.Update
+	err := b.db.View(func(tx *bolt.Tx) error {
+		history := tx.Bucket(historyBucket).Bucket([]byte(symbol))
+		if history == nil {
+			return nil
+		}
+
+		cursor := history.Cursor()
+		k, value := cursor.First()
+		if !from.IsZero() {
+			k, value = cursor.Seek(historyKey(from.UnixMilli(), 0))
+		}
+		for ; k != nil; k, value = cursor.Next() {
+			var update feedclient.Update
+			if err := json.Unmarshal(value, &update); err != nil {
+				return err
+			}
+			if !inRange(update, from, to) {
+				break // Past to, as keys are in timestamp order
+			}
+			updates = append(updates, update)
+		}
+		return nil
+	})
+	return updates, err
+}
+
+func (b *Bolt) Subscribe(ctx context.Context) (<-chan feedclient.Update, error) {
+	return b.hub.subscribe(ctx), nil
+}
+
+// historyKey orders history entries by timestamp; seq keeps entries with
+// the same timestamp apart.
+func historyKey(timestamp int64, seq uint64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, uint64(timestamp))
+	binary.BigEndian.PutUint64(key[8:], seq)
+	return key
+}
@@ -0,0 +1,38 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"ifin/pkg/feedclient"
+)
+
+// broadcaster publishes the updates Put through it in this process, for
+// stores that cannot notify of updates themselves.
+type broadcaster struct {
+	Store
+	hub hub
+}
+
+// Broadcast wraps st so Subscribe works whether or not st supports it: when
+// st returns ErrUnsupported, subscribers are sent the updates Put through
+// the wrapper instead. Updates written by other processes are then missed.
+func Broadcast(st Store) Store {
+	return &broadcaster{Store: st}
+}
+
+func (b *broadcaster) Put(ctx context.Context, update feedclient.Update) error {
+	if err := b.Store.Put(ctx, update); err != nil {
+		return err
+	}
+	b.hub.publish(update)
+	return nil
+}
+
+func (b *broadcaster) Subscribe(ctx context.Context) (<-chan feedclient.Update, error) {
+	updates, err := b.Store.Subscribe(ctx)
+	if errors.Is(err, ErrUnsupported) {
+		return b.hub.subscribe(ctx), nil
+	}
+	return updates, err
+}
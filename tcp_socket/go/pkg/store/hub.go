@@ -0,0 +1,50 @@
+package store
+
+import (
+	"context"
+	"sync"
+
+	"ifin/pkg/feedclient"
+)
+
+// subscriberBuffer is how many updates a subscriber may fall behind by
+// before it starts missing them
+const subscriberBuffer = 64
+
+// hub fans updates out to subscribers in this process. A subscriber that
+// falls behind misses updates rather than blocking Put.
+type hub struct {
+	mu          sync.Mutex
+	subscribers map[chan feedclient.Update]struct{}
+}
+
+// subscribe registers a subscriber until ctx is done.
+func (h *hub) subscribe(ctx context.Context) <-chan feedclient.Update {
+	ch := make(chan feedclient.Update, subscriberBuffer)
+	h.mu.Lock()
+	if h.subscribers == nil {
+		h.subscribers = make(map[chan feedclient.Update]struct{})
+	}
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+
+	context.AfterFunc(ctx, func() {
+		h.mu.Lock()
+		delete(h.subscribers, ch)
+		h.mu.Unlock()
+		close(ch)
+	})
+	return ch
+}
+
+// publish delivers update to every subscriber with room for it.
+func (h *hub) publish(update feedclient.Update) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- update:
+		default:
+		}
+	}
+}
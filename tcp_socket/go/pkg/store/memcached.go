@@ -0,0 +1,185 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+
+	"ifin/pkg/feedclient"
+	"ifin/pkg/keyspace"
+)
+
+// casAttempts bounds the retries of a read-modify-write that keeps losing
+// to other writers
+const casAttempts = 10
+
+// Memcached keeps prices in memcached, named like the Redis keys. As
+// memcached cannot list keys, the known symbols are kept in an index key,
+// and each symbol's history is one JSON array trimmed to the retention
+// period. Both are updated with compare-and-swap, so several clients can
+// share the servers. Memcached may evict anything under memory pressure.
+type Memcached struct {
+	mc        *memcache.Client
+	keys      keyspace.Namespace
+	retention time.Duration // 0 keeps no history
+	hub       hub
+
+	mu      sync.Mutex
+	indexed map[string]bool // Symbols known to be in the index
+}
+
+// NewMemcached uses the memcached servers, with keys named in keys.
+func NewMemcached(servers []string, keys keyspace.Namespace, retention time.Duration) *Memcached {
+	return &Memcached{mc: memcache.New(servers...), keys: keys, retention: retention, indexed: make(map[string]bool)}
+}
+
+// Close closes the connections.
+func (m *Memcached) Close() error {
+	return m.mc.Close()
+}
+
+func (m *Memcached) symbolsKey() string {
+	return m.keys.Key("symbols")
+}
+
+func (m *Memcached) Put(ctx context.Context, update feedclient.Update) error {
+	value, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+	if err := m.mc.Set(&memcache.Item{Key: m.keys.Latest(update.Symbol), Value: value}); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	indexed := m.indexed[update.Symbol]
+	m.mu.Unlock()
+	if !indexed {
+		err := casUpdate(m.mc, m.symbolsKey(), func(symbols []string) []string {
+			if !slices.Contains(symbols, update.Symbol) {
+				symbols = append(symbols, update.Symbol)
+			}
+			return symbols
+		})
+		if err != nil {
+			return err
+		}
+		m.mu.Lock()
+		m.indexed[update.Symbol] = true
+		m.mu.Unlock()
+	}
+
+	if m.retention > 0 {
+		cutoff := time.UnixMilli(update.Timestamp).Add(-m.retention).UnixMilli()
+		err := casUpdate(m.mc, m.keys.History(update.Symbol), func(history []feedclient.Update) []feedclient.Update {
+			history = slices.DeleteFunc(history, func(u feedclient.Update) bool { return u.Timestamp < cutoff })
+			return append(history, update)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	m.hub.publish(update)
+	return nil
+}
+
+func (m *Memcached) GetLatest(ctx context.Context, symbol string) (feedclient.Update, bool, error) {
+	var update feedclient.Update
+	item, err := m.mc.Get(m.keys.Latest(symbol))
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return update, false, nil
+	}
+	if err != nil {
+		return update, false, err
+	}
+	return update, true, json.Unmarshal(item.Value, &update)
+}
+
+func (m *Memcached) GetAll(ctx context.Context) ([]feedclient.Update, error) {
+	var symbols []string
+	if err := m.get(m.symbolsKey(), &symbols); err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(symbols))
+	for i, symbol := range symbols {
+		keys[i] = m.keys.Latest(symbol)
+	}
+
+	items, err := m.mc.GetMulti(keys)
+	if err != nil {
+		return nil, err
+	}
+	updates := make([]feedclient.Update, 0, len(items))
+	for _, item := range items {
+		var update feedclient.Update
+		if json.Unmarshal(item.Value, &update) == nil {
+			updates = append(updates, update)
+		}
+	}
+	SortBySymbol(updates)
+	return updates, nil
+}
+
+func (m *Memcached) History(ctx context.Context, symbol string, from, to time.Time) ([]feedclient.Update, error) {
+	var history []feedclient.Update
+	if err := m.get(m.keys.History(symbol), &history); err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(history, func(u feedclient.Update) bool { return !inRange(u, from, to) }), nil
+}
+
+func (m *Memcached) Subscribe(ctx context.Context) (<-chan feedclient.Update, error) {
+	return m.hub.subscribe(ctx), nil
+}
+
+// get decodes the JSON in key into v, leaving v alone when key is missing.
+func (m *Memcached) get(key string, v any) error {
+	item, err := m.mc.Get(key)
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(item.Value, v)
+}
+
+// casUpdate replaces the JSON value in key by change applied to it, with
+// compare-and-swap so concurrent writers do not undo each other's changes.
+func casUpdate[T any](mc *memcache.Client, key string, change func(T) T) error {
+	for range casAttempts {
+		var value T
+		item, err := mc.Get(key)
+		switch {
+		case errors.Is(err, memcache.ErrCacheMiss):
+			item = nil
+		case err != nil:
+			return err
+		default:
+			if err := json.Unmarshal(item.Value, &value); err != nil {
+				return err
+			}
+		}
+
+		data, err := json.Marshal(change(value))
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			err = mc.Add(&memcache.Item{Key: key, Value: data})
+		} else {
+			item.Value = data
+			err = mc.CompareAndSwap(item)
+		}
+		if !errors.Is(err, memcache.ErrCASConflict) && !errors.Is(err, memcache.ErrNotStored) {
+			return err
+		}
+	}
+	return errors.New("memcache: too many concurrent updates of " + key)
+}
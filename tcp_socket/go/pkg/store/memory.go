@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"ifin/pkg/feedclient"
+)
+
+// Memory keeps prices in process memory only; everything is lost on exit.
+// History is kept for the retention period, measured back from each
+// symbol's newest update.
+type Memory struct {
+	retention time.Duration // 0 keeps no history
+	hub       hub
+
+	mu      sync.RWMutex
+	latest  map[string]feedclient.Update
+	history map[string][]feedclient.Update // Symbol -> updates, oldest first
+}
+
+// NewMemory creates an empty Memory store.
+func NewMemory(retention time.Duration) *Memory {
+	return &Memory{
+		retention: retention,
+		latest:    make(map[string]feedclient.Update),
+		history:   make(map[string][]feedclient.Update),
+	}
+}
+
+func (m *Memory) Put(ctx context.Context, update feedclient.Update) error {
+	m.mu.Lock()
+	m.latest[update.Symbol] = update
+	if m.retention > 0 {
+		history := append(m.history[update.Symbol], update)
+		cutoff := time.UnixMilli(update.Timestamp).Add(-m.retention).UnixMilli()
+		expired := 0
+		for expired < len(history) && history[expired].Timestamp < cutoff {
+			expired++
+		}
+		m.history[update.Symbol] = history[expired:]
+	}
+	m.mu.Unlock()
+
+	m.hub.publish(update)
+	return nil
+}
+
+func (m *Memory) GetLatest(ctx context.Context, symbol string) (feedclient.Update, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	update, ok := m.latest[symbol]
+	return update, ok, nil
+}
+
+func (m *Memory) GetAll(ctx context.Context) ([]feedclient.Update, error) {
+	m.mu.RLock()
+	updates := make([]feedclient.Update, 0, len(m.latest))
+	for _, update := range m.latest {
+		updates = append(updates, update)
+	}
+	m.mu.RUnlock()
+
+	SortBySymbol(updates)
+	return updates, nil
+}
+
+func (m *Memory) History(ctx context.Context, symbol string, from, to time.Time) ([]feedclient.Update, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var updates []feedclient.Update
+	for _, update := range m.history[symbol] {
+		if inRange(update, from, to) {
+			updates = append(updates, update)
+		}
+	}
+	return updates, nil
+}
+
+func (m *Memory) Subscribe(ctx context.Context) (<-chan feedclient.Update, error) {
+	return m.hub.subscribe(ctx), nil
+}
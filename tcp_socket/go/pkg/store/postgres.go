@@ -0,0 +1,151 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ifin/pkg/feedclient"
+)
+
+// postgresSchema creates the ticks table. Rows are keyed by generation time
+// so a TimescaleDB hypertable can be partitioned on it.
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS ticks (
+	time   timestamptz      NOT NULL,
+	symbol text             NOT NULL,
+	price  double precision NOT NULL,
+	seq    bigint           NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS ticks_symbol_time ON ticks (symbol, time DESC);`
+
+// Postgres writes every update as a row of the ticks table, for SQL
+// analytics, turning it into a hypertable when the TimescaleDB extension is
+// installed. Rows are collected and inserted in batches with COPY by Run,
+// so the latest updates only become visible to queries after a flush.
+type Postgres struct {
+	pool  *pgxpool.Pool
+	batch tickBatch
+	hub   hub
+}
+
+// OpenPostgres connects to the database at dsn, creating the schema if
+// needed.
+func OpenPostgres(ctx context.Context, dsn string) (*Postgres, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := createSchema(ctx, pool); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return &Postgres{pool: pool}, nil
+}
+
+func createSchema(ctx context.Context, pool *pgxpool.Pool) error {
+	if _, err := pool.Exec(ctx, postgresSchema); err != nil {
+		return err
+	}
+
+	var timescale bool
+	err := pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb')`).Scan(&timescale)
+	if err != nil || !timescale {
+		return err
+	}
+	_, err = pool.Exec(ctx, `SELECT create_hypertable('ticks', 'time', if_not_exists => TRUE, migrate_data => TRUE)`)
+	return err
+}
+
+// Close closes the connections. Call Flush first to keep pending rows.
+func (p *Postgres) Close() {
+	p.pool.Close()
+}
+
+func (p *Postgres) Put(ctx context.Context, update feedclient.Update) error {
+	p.batch.add(update)
+	p.hub.publish(update)
+	return nil
+}
+
+// Flush inserts the pending rows with one COPY. On failure they are kept
+// for the next attempt.
+func (p *Postgres) Flush(ctx context.Context) error {
+	return p.batch.flush(func(updates []feedclient.Update) error {
+		rows := make([][]any, len(updates))
+		for i, update := range updates {
+			rows[i] = []any{time.UnixMilli(update.Timestamp), update.Symbol, update.Price, int64(update.Seq)}
+		}
+		_, err := p.pool.CopyFrom(ctx, pgx.Identifier{"ticks"}, []string{"time", "symbol", "price", "seq"}, pgx.CopyFromRows(rows))
+		return err
+	})
+}
+
+// Run flushes every interval until ctx is done, reporting failures to
+// onError.
+func (p *Postgres) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	runFlushes(ctx, interval, p.Flush, onError)
+}
+
+func (p *Postgres) GetLatest(ctx context.Context, symbol string) (feedclient.Update, bool, error) {
+	row := p.pool.QueryRow(ctx, `SELECT time, symbol, price, seq FROM ticks WHERE symbol = $1 ORDER BY time DESC LIMIT 1`, symbol)
+	update, err := scanTick(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return update, false, nil
+	}
+	return update, err == nil, err
+}
+
+func (p *Postgres) GetAll(ctx context.Context) ([]feedclient.Update, error) {
+	return p.query(ctx, `SELECT DISTINCT ON (symbol) time, symbol, price, seq FROM ticks ORDER BY symbol, time DESC`)
+}
+
+func (p *Postgres) History(ctx context.Context, symbol string, from, to time.Time) ([]feedclient.Update, error) {
+	var fromArg, toArg any // NULL leaves that end open
+	if !from.IsZero() {
+		fromArg = from
+	}
+	if !to.IsZero() {
+		toArg = to
+	}
+	return p.query(ctx, `SELECT time, symbol, price, seq FROM ticks
+		WHERE symbol = $1 AND ($2::timestamptz IS NULL OR time >= $2) AND ($3::timestamptz IS NULL OR time <= $3)
+		ORDER BY time`, symbol, fromArg, toArg)
+}
+
+func (p *Postgres) Subscribe(ctx context.Context) (<-chan feedclient.Update, error) {
+	return p.hub.subscribe(ctx), nil
+}
+
+func (p *Postgres) query(ctx context.Context, sql string, args ...any) ([]feedclient.Update, error) {
+	rows, err := p.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var updates []feedclient.Update
+	for rows.Next() {
+		update, err := scanTick(rows)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, update)
+	}
+	return updates, rows.Err()
+}
+
+func scanTick(row pgx.Row) (feedclient.Update, error) {
+	var update feedclient.Update
+	var generated time.Time
+	var seq int64
+	if err := row.Scan(&generated, &update.Symbol, &update.Price, &seq); err != nil {
+		return update, err
+	}
+	update.Timestamp = generated.UnixMilli()
+	update.Seq = uint64(seq)
+	return update, nil
+}
@@ -0,0 +1,173 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	_ "modernc.org/sqlite" // Pure Go driver, so no C toolchain or library is needed
+
+	"ifin/pkg/feedclient"
+)
+
+// sqliteSchema keeps the latest price per symbol apart from the history, so
+// snapshots do not scan the ticks.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS latest (
+	symbol TEXT PRIMARY KEY,
+	time   INTEGER NOT NULL,
+	price  REAL    NOT NULL,
+	seq    INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS ticks (
+	symbol TEXT    NOT NULL,
+	time   INTEGER NOT NULL,
+	price  REAL    NOT NULL,
+	seq    INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS ticks_symbol_time ON ticks (symbol, time);`
+
+// SQLite keeps prices in a local SQLite database file, in WAL mode so HTTP
+// readers are not blocked by writes. Updates are inserted in batches, one
+// transaction each, by Run; until then they are only visible to
+// subscribers.
+type SQLite struct {
+	db        *sql.DB
+	retention time.Duration // 0 keeps no history
+	batch     tickBatch
+	hub       hub
+}
+
+// OpenSQLite opens (creating if needed) the database in path.
+func OpenSQLite(ctx context.Context, path string, retention time.Duration) (*SQLite, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLite{db: db, retention: retention}, nil
+}
+
+// Close closes the database. Call Flush first to keep pending updates.
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLite) Put(ctx context.Context, update feedclient.Update) error {
+	s.batch.add(update)
+	s.hub.publish(update)
+	return nil
+}
+
+// Flush writes the pending updates in one transaction. On failure they are
+// kept for the next attempt.
+func (s *SQLite) Flush(ctx context.Context) error {
+	return s.batch.flush(func(updates []feedclient.Update) error {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback() // No-op after Commit
+
+		latest, err := tx.PrepareContext(ctx, `INSERT INTO latest (symbol, time, price, seq) VALUES (?, ?, ?, ?)
+			ON CONFLICT (symbol) DO UPDATE SET time = excluded.time, price = excluded.price, seq = excluded.seq`)
+		if err != nil {
+			return err
+		}
+		defer latest.Close()
+		ticks, err := tx.PrepareContext(ctx, `INSERT INTO ticks (symbol, time, price, seq) VALUES (?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer ticks.Close()
+
+		newest := int64(0)
+		for _, update := range updates {
+			args := []any{update.Symbol, update.Timestamp, update.Price, int64(update.Seq)}
+			if _, err := latest.ExecContext(ctx, args...); err != nil {
+				return err
+			}
+			if s.retention > 0 {
+				if _, err := ticks.ExecContext(ctx, args...); err != nil {
+					return err
+				}
+			}
+			newest = max(newest, update.Timestamp)
+		}
+
+		if s.retention > 0 {
+			cutoff := time.UnixMilli(newest).Add(-s.retention).UnixMilli()
+			if _, err := tx.ExecContext(ctx, `DELETE FROM ticks WHERE time < ?`, cutoff); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+}
+
+// Run flushes every interval until ctx is done, reporting failures to
+// onError.
+func (s *SQLite) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	runFlushes(ctx, interval, s.Flush, onError)
+}
+
+func (s *SQLite) GetLatest(ctx context.Context, symbol string) (feedclient.Update, bool, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT symbol, time, price, seq FROM latest WHERE symbol = ?`, symbol)
+	update, err := scanSQLiteTick(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return update, false, nil
+	}
+	return update, err == nil, err
+}
+
+func (s *SQLite) GetAll(ctx context.Context) ([]feedclient.Update, error) {
+	return s.query(ctx, `SELECT symbol, time, price, seq FROM latest ORDER BY symbol`)
+}
+
+func (s *SQLite) History(ctx context.Context, symbol string, from, to time.Time) ([]feedclient.Update, error) {
+	var fromArg, toArg any // NULL leaves that end open
+	if !from.IsZero() {
+		fromArg = from.UnixMilli()
+	}
+	if !to.IsZero() {
+		toArg = to.UnixMilli()
+	}
+	return s.query(ctx, `SELECT symbol, time, price, seq FROM ticks
+		WHERE symbol = ? AND (?2 IS NULL OR time >= ?2) AND (?3 IS NULL OR time <= ?3)
+		ORDER BY time`, symbol, fromArg, toArg)
+}
+
+func (s *SQLite) Subscribe(ctx context.Context) (<-chan feedclient.Update, error) {
+	return s.hub.subscribe(ctx), nil
+}
+
+func (s *SQLite) query(ctx context.Context, query string, args ...any) ([]feedclient.Update, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var updates []feedclient.Update
+	for rows.Next() {
+		update, err := scanSQLiteTick(rows)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, update)
+	}
+	return updates, rows.Err()
+}
+
+// scanSQLiteTick reads a row of symbol, time, price and seq.
+func scanSQLiteTick(row interface{ Scan(...any) error }) (feedclient.Update, error) {
+	var update feedclient.Update
+	var seq int64
+	err := row.Scan(&update.Symbol, &update.Timestamp, &update.Price, &seq)
+	update.Seq = uint64(seq)
+	return update, err
+}
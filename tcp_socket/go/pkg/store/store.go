@@ -0,0 +1,52 @@
+// Package store defines where received prices are kept, so the client and
+// its HTTP layer do not depend on a particular database. Besides the Redis
+// cache in internal/consume, prices can be kept in memory (for demos, with
+// no storage at all), in a local BoltDB or SQLite file, or in PostgreSQL.
+package store
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"ifin/pkg/feedclient"
+)
+
+// ErrUnsupported is returned by Subscribe when a store cannot notify of new
+// updates, e.g. a Redis cache with Pub/Sub disabled. Readers then poll.
+var ErrUnsupported = errors.New("store: not supported")
+
+// Store keeps the latest price of every symbol and its recent history.
+type Store interface {
+	// Put records an update as its symbol's latest price and in its history.
+	Put(ctx context.Context, update feedclient.Update) error
+
+	// GetLatest returns symbol's latest price; ok is false when it has none.
+	GetLatest(ctx context.Context, symbol string) (update feedclient.Update, ok bool, err error)
+
+	// GetAll returns the latest price of every symbol, ordered by symbol.
+	GetAll(ctx context.Context) ([]feedclient.Update, error)
+
+	// History returns symbol's updates generated between from and to, oldest
+	// first. A zero from or to leaves that end of the range open.
+	History(ctx context.Context, symbol string, from, to time.Time) ([]feedclient.Update, error)
+
+	// Subscribe delivers every update Put from now on until ctx is done, when
+	// the channel is closed.
+	Subscribe(ctx context.Context) (<-chan feedclient.Update, error)
+}
+
+// SortBySymbol orders updates by symbol, as GetAll returns them.
+func SortBySymbol(updates []feedclient.Update) {
+	sort.Slice(updates, func(i, j int) bool { return updates[i].Symbol < updates[j].Symbol })
+}
+
+// inRange reports whether update was generated between from and to, either
+// of which may be zero for an open end.
+func inRange(update feedclient.Update, from, to time.Time) bool {
+	if !from.IsZero() && update.Timestamp < from.UnixMilli() {
+		return false
+	}
+	return to.IsZero() || update.Timestamp <= to.UnixMilli()
+}